@@ -14,7 +14,10 @@ import (
 	"github.com/sukalov/mshkbot/internal/handlers/admingroup"
 	"github.com/sukalov/mshkbot/internal/handlers/maingroup"
 	"github.com/sukalov/mshkbot/internal/handlers/privatechat"
+	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/schedule"
 	"github.com/sukalov/mshkbot/internal/utils"
+	"github.com/sukalov/mshkbot/internal/waitlist"
 )
 
 func main() {
@@ -23,6 +26,10 @@ func main() {
 		"BOT_TOKEN",
 		"MAIN_GROUP_ID",
 		"ADMIN_GROUP_ID",
+		"TURSO_DATABASE_URL",
+		"TURSO_AUTH_TOKEN",
+		"REDIS_URL",
+		"REDIS_PASSWORD",
 	})
 	if err != nil {
 		log.Fatalf("failed to load env: %v", err)
@@ -39,14 +46,41 @@ func main() {
 		log.Fatalf("invalid ADMIN_GROUP_ID: %v", err)
 	}
 
-	// create bot instance
-	botInstance, err := bot.New("mshkbot", env["BOT_TOKEN"], mainGroupID, adminGroupID)
+	// connect storage
+	if err := db.Connect(env["TURSO_DATABASE_URL"], env["TURSO_AUTH_TOKEN"]); err != nil {
+		log.Fatalf("database initialization failed: %v", err)
+	}
+	if err := redis.Connect(env["REDIS_URL"], env["REDIS_PASSWORD"]); err != nil {
+		log.Fatalf("redis initialization failed: %v", err)
+	}
+	storage := bot.Storage{
+		Tournaments:    redis.Tournaments{},
+		Users:          db.NewSQLUsers(db.Database),
+		AdminProcesses: redis.AdminProcesses{},
+		RatingsCache:   redis.RatingsCache{},
+		Jobs:           redis.Jobs{},
+	}
+
+	// create bot instance, TELEGRAM_API_URL points it at another Bot API server
+	botInstance, err := bot.New("mshkbot", env["BOT_TOKEN"], os.Getenv("TELEGRAM_API_URL"), mainGroupID, adminGroupID, storage)
 	if err != nil {
 		log.Fatalf("failed to create bot: %v", err)
 	}
 
+	// mirror the audit log to a channel if one is configured
+	if channel := os.Getenv("AUDIT_CHANNEL_ID"); channel != "" {
+		auditChannelID, err := strconv.ParseInt(channel, 10, 64)
+		if err != nil {
+			log.Fatalf("invalid AUDIT_CHANNEL_ID: %v", err)
+		}
+		botInstance.SetAuditChannel(auditChannelID)
+	}
+
+	// register waitlist jobs and schedule them for players promoted or checked out before a restart
+	waitlist.Resume(botInstance)
+
 	// create scheduler
-	scheduler := cron.New(botInstance, mainGroupID)
+	scheduler := cron.New(botInstance, mainGroupID, schedule.RealClock())
 
 	// get handlers from each package
 	mainGroupHandlers := maingroup.GetHandlers()
@@ -67,5 +101,6 @@ func main() {
 	scheduler.Stop()
 	botInstance.Stop()
 	db.Close()
+	redis.Close()
 	log.Println("shutdown complete")
 }
@@ -1,6 +1,10 @@
 package bot
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
 	"sync"
 	"time"
 )
@@ -12,57 +16,192 @@ const (
 	ProcessTypeBan          AdminProcessType = "ban"
 	ProcessTypeUnban        AdminProcessType = "unban"
 	ProcessTypeAdmitToGreen AdminProcessType = "admit_to_green"
+	ProcessTypeEditUser     AdminProcessType = "edit_user"
 )
 
+// adminProcessTimeout is how long a multi-step admin flow waits for the next answer
+const adminProcessTimeout = 10 * time.Minute
+
+// AdminProcess is a multi-step admin flow waiting for the next message of the admin in the chat
 type AdminProcess struct {
-	Type      AdminProcessType
-	AdminID   int64
-	Duration  string
-	CreatedAt time.Time
+	Type            AdminProcessType `json:"type"`
+	ChatID          int64            `json:"chat_id"`
+	AdminID         int64            `json:"admin_id"`
+	Duration        string           `json:"duration,omitempty"`
+	TargetID        int64            `json:"target_id,omitempty"`
+	Field           string           `json:"field,omitempty"`
+	PromptMessageID int              `json:"prompt_message_id,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	ExpiresAt       time.Time        `json:"expires_at"`
+}
+
+// ProcessBackend keeps admin processes so flows survive a restart.
+// keys are "<chat id>:<admin id>", Expired lists keys whose expiresAt has passed
+type ProcessBackend interface {
+	Load(ctx context.Context, key string) ([]byte, bool, error)
+	Save(ctx context.Context, key string, data []byte, expiresAt time.Time) error
+	Delete(ctx context.Context, key string) error
+	Expired(ctx context.Context, now time.Time) ([]string, error)
 }
 
+// AdminProcessStore keeps admin processes scoped by chat and admin in a backend.
+// backend errors are logged and the process is treated as missing
 type AdminProcessStore struct {
-	processes map[int64]*AdminProcess
-	mu        sync.RWMutex
+	backend ProcessBackend
+	timeout time.Duration
 }
 
-func NewAdminProcessStore() *AdminProcessStore {
-	return &AdminProcessStore{
-		processes: make(map[int64]*AdminProcess),
+func NewAdminProcessStore(backend ProcessBackend) *AdminProcessStore {
+	return &AdminProcessStore{backend: backend, timeout: adminProcessTimeout}
+}
+
+func processKey(chatID, adminID int64) string {
+	return fmt.Sprintf("%d:%d", chatID, adminID)
+}
+
+// Set starts a process, replacing any other process of the admin in that chat
+func (s *AdminProcessStore) Set(p AdminProcess) {
+	p.CreatedAt = time.Now()
+	s.save(&p)
+}
+
+func (s *AdminProcessStore) save(p *AdminProcess) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p.ExpiresAt = time.Now().Add(s.timeout)
+	data, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("failed to encode admin process of %d: %v", p.AdminID, err)
+		return
+	}
+	if err := s.backend.Save(ctx, processKey(p.ChatID, p.AdminID), data, p.ExpiresAt); err != nil {
+		log.Printf("failed to save admin process of %d: %v", p.AdminID, err)
+	}
+}
+
+// Get returns the running process of the admin in the chat; timed out processes are not returned
+func (s *AdminProcessStore) Get(chatID, adminID int64) (*AdminProcess, bool) {
+	p, exists := s.load(processKey(chatID, adminID))
+	if !exists || time.Now().After(p.ExpiresAt) {
+		return nil, false
+	}
+	return p, true
+}
+
+func (s *AdminProcessStore) load(key string) (*AdminProcess, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, exists, err := s.backend.Load(ctx, key)
+	if err != nil {
+		log.Printf("failed to load admin process %s: %v", key, err)
+		return nil, false
+	}
+	if !exists {
+		return nil, false
+	}
+
+	var p AdminProcess
+	if err := json.Unmarshal(data, &p); err != nil {
+		log.Printf("failed to decode admin process %s: %v", key, err)
+		return nil, false
 	}
+	return &p, true
 }
 
-func (s *AdminProcessStore) Set(adminID int64, processType AdminProcessType, duration string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.processes[adminID] = &AdminProcess{
-		Type:      processType,
-		AdminID:   adminID,
-		Duration:  duration,
-		CreatedAt: time.Now(),
+// Update changes a running process and gives it a fresh timeout, reports false if there is none
+func (s *AdminProcessStore) Update(chatID, adminID int64, fn func(p *AdminProcess)) bool {
+	p, exists := s.Get(chatID, adminID)
+	if !exists {
+		return false
 	}
+	fn(p)
+	s.save(p)
+	return true
+}
+
+func (s *AdminProcessStore) Clear(chatID, adminID int64) {
+	s.delete(processKey(chatID, adminID))
+}
+
+func (s *AdminProcessStore) delete(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.backend.Delete(ctx, key); err != nil {
+		log.Printf("failed to delete admin process %s: %v", key, err)
+	}
+}
+
+// TakeExpired removes the processes that timed out and returns them
+func (s *AdminProcessStore) TakeExpired(now time.Time) []AdminProcess {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keys, err := s.backend.Expired(ctx, now)
+	if err != nil {
+		log.Printf("failed to list expired admin processes: %v", err)
+		return nil
+	}
+
+	var expired []AdminProcess
+	for _, key := range keys {
+		p, exists := s.load(key)
+		// the admin may have started a new process under the same key in the meantime
+		if exists && p.ExpiresAt.After(now) {
+			continue
+		}
+		s.delete(key)
+		if exists {
+			expired = append(expired, *p)
+		}
+	}
+	return expired
+}
+
+// MemoryProcesses keeps admin processes in memory, for tests and local runs
+type MemoryProcesses struct {
+	mu        sync.Mutex
+	data      map[string][]byte
+	expiresAt map[string]time.Time
+}
+
+func NewMemoryProcesses() *MemoryProcesses {
+	return &MemoryProcesses{data: make(map[string][]byte), expiresAt: make(map[string]time.Time)}
+}
+
+func (m *MemoryProcesses) Load(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, exists := m.data[key]
+	return data, exists, nil
 }
 
-func (s *AdminProcessStore) Get(adminID int64) (*AdminProcess, bool) {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	p, exists := s.processes[adminID]
-	return p, exists
+func (m *MemoryProcesses) Save(_ context.Context, key string, data []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+	m.expiresAt[key] = expiresAt
+	return nil
 }
 
-func (s *AdminProcessStore) Clear(adminID int64) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	delete(s.processes, adminID)
+func (m *MemoryProcesses) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	delete(m.expiresAt, key)
+	return nil
 }
 
-func (s *AdminProcessStore) CleanupExpired(maxAge time.Duration) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	now := time.Now()
-	for id, p := range s.processes {
-		if now.Sub(p.CreatedAt) > maxAge {
-			delete(s.processes, id)
+func (m *MemoryProcesses) Expired(_ context.Context, now time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for key, expiresAt := range m.expiresAt {
+		if !expiresAt.After(now) {
+			keys = append(keys, key)
 		}
 	}
+	return keys, nil
 }
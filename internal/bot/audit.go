@@ -0,0 +1,26 @@
+package bot
+
+import (
+	"log"
+
+	"github.com/sukalov/mshkbot/internal/db"
+)
+
+// SetAuditChannel makes Audit mirror every event to a channel or chat; 0 turns mirroring off
+func (b *Bot) SetAuditChannel(chatID int64) {
+	b.auditChannelID = chatID
+}
+
+// Audit records an admin or state-changing action and mirrors it to the audit channel.
+// the change has already happened by then, so failures are only logged
+func (b *Bot) Audit(event db.AuditEvent) {
+	if err := db.RecordAudit(event); err != nil {
+		return
+	}
+	if b.auditChannelID == 0 {
+		return
+	}
+	if err := b.SendMessage(b.auditChannelID, event.String()); err != nil {
+		log.Printf("failed to mirror audit event %s to channel: %v", event.Action, err)
+	}
+}
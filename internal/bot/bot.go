@@ -1,32 +1,34 @@
 package bot
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"sync"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/jobs"
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/telegram"
 	"github.com/sukalov/mshkbot/internal/tournament"
 )
 
+// ratingsTTL is how long fetched peak ratings are reused
+const ratingsTTL = 6 * time.Hour
+
 // reactionType represents a reaction type for telegram API
 type reactionType struct {
 	Type  string `json:"type"`
 	Emoji string `json:"emoji,omitempty"`
 }
 
-type setMessageReactionRequest struct {
-	ChatID    int64          `json:"chat_id"`
-	MessageID int            `json:"message_id"`
-	Reaction  []reactionType `json:"reaction,omitempty"`
-	IsBig     bool           `json:"is_big,omitempty"`
-}
-
 type Bot struct {
 	Client         *tgbotapi.BotAPI
+	api            *telegram.Client
 	updateChan     tgbotapi.UpdatesChannel
 	stopChan       chan struct{}
 	name           string
@@ -36,33 +38,73 @@ type Bot struct {
 	adminUserIDs   map[int64]bool
 	adminMu        sync.RWMutex
 	Tournament     *tournament.TournamentManager
+	Users          db.UserRepository
+	Ratings        ratings.Providers
+	Jobs           *jobs.Queue
 	adminProcesses *AdminProcessStore
+	scheduleReload chan struct{}
+	auditChannelID int64
+}
+
+// Storage holds the backends the bot keeps its state in.
+// RatingsCache may be nil, then rating histories are fetched every time; the others are required
+type Storage struct {
+	Tournaments    tournament.TournamentStore
+	Users          db.UserRepository
+	AdminProcesses ProcessBackend
+	RatingsCache   ratings.Cache
+	Jobs           jobs.Backend
 }
 
-// creates a new bot instance
-func New(name, token string, mainGroupID, adminGroupID int64) (*Bot, error) {
-	botClient, err := tgbotapi.NewBotAPI(token)
+// creates a new bot instance. apiURL points it at another Bot API server, empty for telegram itself
+func New(name, token, apiURL string, mainGroupID, adminGroupID int64, storage Storage) (*Bot, error) {
+	api, err := telegram.New(token, apiURL)
 	if err != nil {
 		return nil, err
 	}
 
 	updateConfig := tgbotapi.NewUpdate(0)
 	updateConfig.Timeout = 60
-	updateChan := botClient.GetUpdatesChan(updateConfig)
+	updateChan := api.API.GetUpdatesChan(updateConfig)
+
+	// restore tournaments before anything (e.g. the scheduler catch-up) looks at them
+	tournaments := tournament.NewManager(storage.Tournaments)
+	if err := tournaments.Init(); err != nil {
+		log.Printf("[%s] failed to initialize tournament: %v", name, err)
+	}
 
 	return &Bot{
-		Client:         botClient,
+		Client:         api.API,
+		api:            api,
 		updateChan:     updateChan,
 		stopChan:       make(chan struct{}),
 		name:           name,
 		mainGroupID:    mainGroupID,
 		adminGroupID:   adminGroupID,
 		adminUserIDs:   make(map[int64]bool),
-		Tournament:     &tournament.TournamentManager{},
-		adminProcesses: NewAdminProcessStore(),
+		Tournament:     tournaments,
+		Users:          storage.Users,
+		Ratings:        newRatingProviders(storage.RatingsCache),
+		Jobs:           jobs.NewQueue(storage.Jobs),
+		adminProcesses: NewAdminProcessStore(storage.AdminProcesses),
+		scheduleReload: make(chan struct{}, 1),
 	}, nil
 }
 
+// newRatingProviders shares one http client between the sites and caches peaks in cache
+func newRatingProviders(cache ratings.Cache) ratings.Providers {
+	client := ratings.NewHTTPClient()
+	lichess := ratings.NewLichess(ratings.LichessURL, client)
+	chessCom := ratings.NewChessCom(ratings.ChessComURL, client)
+	if cache == nil {
+		return ratings.Providers{Lichess: lichess, ChessCom: chessCom}
+	}
+	return ratings.Providers{
+		Lichess:  ratings.NewCached(lichess, cache, ratingsTTL),
+		ChessCom: ratings.NewCached(chessCom, cache, ratingsTTL),
+	}
+}
+
 // HandlerSet contains handlers for a specific chat type
 type HandlerSet struct {
 	Commands  map[string]func(b *Bot, update tgbotapi.Update) error
@@ -77,12 +119,11 @@ func (b *Bot) Start(
 	privateHandlers HandlerSet,
 ) {
 	log.Printf("[%s] authorized on account %s", b.name, b.Client.Self.UserName)
-	if err := b.Tournament.Init(); err != nil {
-		log.Printf("[%s] failed to initialize tournament: %v", b.name, err)
-	}
-	log.Printf("[%s] tournament initialized: %v", b.name, b.Tournament)
+	log.Printf("[%s] tournaments initialized: %d open", b.name, len(b.Tournament.Open()))
 	// fetch admin list on startup
 	b.refreshAdminList()
+	go b.expireAdminProcesses()
+	go b.Jobs.Run(b.stopChan)
 
 	for {
 		select {
@@ -98,6 +139,50 @@ func (b *Bot) GetMainGroupID() int64 {
 	return b.mainGroupID
 }
 
+// UpdateAnnouncementMessage re-renders the pinned registration list of a tournament in the main group
+func (b *Bot) UpdateAnnouncementMessage(tournamentID string) error {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists || t.Metadata.AnnouncementMessageID == 0 {
+		return nil
+	}
+
+	return ignoreNotModified(b.EditMessage(b.mainGroupID, t.Metadata.AnnouncementMessageID, t.ListMessage()))
+}
+
+// RenamePlayer changes the name of the player in every tournament they are in
+func (b *Bot) RenamePlayer(playerID int, newName string) error {
+	ctx := context.Background()
+
+	for _, tournamentID := range b.Tournament.TournamentsOf(playerID) {
+		if err := b.Tournament.SetPlayerName(ctx, tournamentID, playerID, newName); err != nil {
+			return fmt.Errorf("failed to update player in tournament: %w", err)
+		}
+
+		log.Printf("updated player %d name to %s in tournament %s", playerID, newName, tournamentID)
+
+		if err := b.UpdateAnnouncementMessage(tournamentID); err != nil {
+			return fmt.Errorf("failed to update announcement message: %w", err)
+		}
+
+		log.Printf("updated announcement message after name change")
+	}
+
+	return nil
+}
+
+// ReloadSchedule tells the scheduler that recurring events were edited
+func (b *Bot) ReloadSchedule() {
+	select {
+	case b.scheduleReload <- struct{}{}:
+	default:
+	}
+}
+
+// ScheduleReloads delivers a signal every time the schedule was edited
+func (b *Bot) ScheduleReloads() <-chan struct{} {
+	return b.scheduleReload
+}
+
 func (b *Bot) refreshAdminList() {
 	config := tgbotapi.ChatAdministratorsConfig{
 		ChatConfig: tgbotapi.ChatConfig{
@@ -105,7 +190,11 @@ func (b *Bot) refreshAdminList() {
 		},
 	}
 
-	admins, err := b.Client.GetChatAdministrators(config)
+	resp, err := b.api.Request(config)
+	var admins []tgbotapi.ChatMember
+	if err == nil {
+		err = json.Unmarshal(resp.Result, &admins)
+	}
 	if err != nil {
 		log.Printf("[%s] failed to get admin list: %v", b.name, err)
 		return
@@ -155,7 +244,9 @@ func (b *Bot) routeUpdate(
 
 	switch {
 	case chatID == b.mainGroupID:
-		log.Printf("[%s] main group message: %s", b.name, update.Message.Text)
+		if update.Message != nil {
+			log.Printf("[%s] main group message: %s", b.name, update.Message.Text)
+		}
 		handlers = mainGroupHandlers
 		chatType = "main group"
 	case chatID == b.adminGroupID:
@@ -201,7 +292,8 @@ func (b *Bot) processUpdate(update tgbotapi.Update, handlers HandlerSet) error {
 
 		if handler, exists := handlers.Callbacks[query]; exists {
 			if err := handler(b, update); err != nil {
-				return b.SendMessage(update.Message.From.ID, "ошибка")
+				log.Printf("[%s] callback %s error: %v", b.name, query, err)
+				return b.SendMessage(update.CallbackQuery.From.ID, "ошибка")
 			}
 			return nil
 		}
@@ -227,20 +319,21 @@ func (b *Bot) processUpdate(update tgbotapi.Update, handlers HandlerSet) error {
 func (b *Bot) Stop() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+	b.Client.StopReceivingUpdates()
 	close(b.stopChan)
 }
 
 func (b *Bot) SendMessage(chatID int64, text string) error {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.DisableWebPagePreview = true
-	_, err := b.Client.Send(msg)
+	_, err := b.api.Send(msg)
 	return err
 }
 
 func (b *Bot) SendMessageAndGetID(chatID int64, text string) (int, error) {
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.DisableWebPagePreview = true
-	sentMsg, err := b.Client.Send(msg)
+	sentMsg, err := b.api.Send(msg)
 	if err != nil {
 		return 0, err
 	}
@@ -251,7 +344,7 @@ func (b *Bot) SendMessageWithMarkdown(chatID int64, text string, disableLinks bo
 	msg := tgbotapi.NewMessage(chatID, text)
 	msg.ParseMode = "Markdown"
 	msg.DisableWebPagePreview = disableLinks
-	_, err := b.Client.Send(msg)
+	_, err := b.api.Send(msg)
 	return err
 }
 
@@ -265,205 +358,120 @@ func (b *Bot) SendMessageWithButtons(
 	msg.ParseMode = "Markdown"
 	msg.DisableWebPagePreview = true
 
-	_, err := b.Client.Send(msg)
+	_, err := b.api.Send(msg)
 	return err
 }
 
+// Send sends any message config through the shared client
+func (b *Bot) Send(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	return b.api.Send(c)
+}
+
 func (b *Bot) Request(c tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
-	return b.Client.Request(c)
+	return b.api.Request(c)
 }
 
-// removeReaction removes all reactions from a message
+// RemoveReaction removes all reactions from a message
 func (b *Bot) RemoveReaction(chatID int64, messageID int) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/setMessageReaction", b.Client.Token)
-
-	reqBody := setMessageReactionRequest{
-		ChatID:    chatID,
-		MessageID: messageID,
-		Reaction:  []reactionType{}, // empty array removes reactions
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
-
-	return nil
+	return b.setReaction(chatID, messageID, []reactionType{}) // empty array removes reactions
 }
 
-// giveReaction sends a reaction to a message using direct telegram API call
+// GiveReaction puts an emoji reaction on a message
 func (b *Bot) GiveReaction(chatID int64, messageID int, emoji string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/setMessageReaction", b.Client.Token)
-
-	reqBody := setMessageReactionRequest{
-		ChatID:    chatID,
-		MessageID: messageID,
-		Reaction: []reactionType{
-			{
-				Type:  "emoji",
-				Emoji: emoji,
-			},
-		},
-		IsBig: false,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+	return b.setReaction(chatID, messageID, []reactionType{{Type: "emoji", Emoji: emoji}})
+}
 
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
+// setReaction calls setMessageReaction which the library has no config for
+func (b *Bot) setReaction(chatID int64, messageID int, reaction []reactionType) error {
+	params := tgbotapi.Params{}
+	params.AddNonZero64("chat_id", chatID)
+	params.AddNonZero("message_id", messageID)
+	if err := params.AddInterface("reaction", reaction); err != nil {
+		return fmt.Errorf("failed to encode reaction: %w", err)
 	}
-
-	return nil
+	_, err := b.api.Call(chatID, "setMessageReaction", params)
+	return err
 }
 
-// replyToMessage sends a text message as a reply to a specific message
+// ReplyToMessage sends a text message as a reply to a specific message
 func (b *Bot) ReplyToMessage(chatID int64, messageID int, text string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", b.Client.Token)
-
-	reqBody := map[string]interface{}{
-		"chat_id": chatID,
-		"text":    text,
-		"reply_parameters": map[string]interface{}{
-			"message_id": messageID,
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
-
-	return nil
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyToMessageID = messageID
+	msg.DisableWebPagePreview = true
+	_, err := b.api.Send(msg)
+	return err
 }
 
 func (b *Bot) PinMessage(chatID int64, messageID int) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/pinChatMessage", b.Client.Token)
-
-	reqBody := map[string]interface{}{
-		"chat_id":    chatID,
-		"message_id": messageID,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
-
-	return nil
+	_, err := b.api.Request(tgbotapi.PinChatMessageConfig{ChatID: chatID, MessageID: messageID})
+	return err
 }
 
 func (b *Bot) EditMessage(chatID int64, messageID int, text string) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/editMessageText", b.Client.Token)
-
-	reqBody := map[string]interface{}{
-		"chat_id":    chatID,
-		"message_id": messageID,
-		"text":       text,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+	_, err := b.api.Send(tgbotapi.NewEditMessageText(chatID, messageID, text))
+	return err
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+// ignoreNotModified drops the error telegram returns when a re-render produced the same text
+func ignoreNotModified(err error) error {
+	if errors.Is(err, telegram.ErrMessageNotModified) {
+		return nil
 	}
-	defer resp.Body.Close()
+	return err
+}
 
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
-	}
+func (b *Bot) UnpinMessage(chatID int64, messageID int) error {
+	_, err := b.api.Request(tgbotapi.UnpinChatMessageConfig{ChatID: chatID, MessageID: messageID})
+	return err
+}
 
-	return nil
+// StartAdminProcess begins a multi-step admin flow, see AdminProcess
+func (b *Bot) StartAdminProcess(p AdminProcess) {
+	b.adminProcesses.Set(p)
 }
 
-func (b *Bot) UnpinMessage(chatID int64, messageID int) error {
-	url := fmt.Sprintf("https://api.telegram.org/bot%s/unpinChatMessage", b.Client.Token)
+func (b *Bot) GetAdminProcess(chatID, adminID int64) (*AdminProcess, bool) {
+	return b.adminProcesses.Get(chatID, adminID)
+}
 
-	reqBody := map[string]interface{}{
-		"chat_id":    chatID,
-		"message_id": messageID,
-	}
+func (b *Bot) UpdateAdminProcess(chatID, adminID int64, fn func(p *AdminProcess)) bool {
+	return b.adminProcesses.Update(chatID, adminID, fn)
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
+func (b *Bot) ClearAdminProcess(chatID, adminID int64) {
+	b.adminProcesses.Clear(chatID, adminID)
+}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+// PromptAdmin asks the admin for the next answer of their process. the prompt is
+// remembered so it can be marked as cancelled if the admin never answers
+func (b *Bot) PromptAdmin(chatID, adminID int64, text string) error {
+	messageID, err := b.SendMessageAndGetID(chatID, text)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		var result map[string]interface{}
-		json.NewDecoder(resp.Body).Decode(&result)
-		return fmt.Errorf("telegram api error: %v", result)
+		return err
 	}
-
+	b.adminProcesses.Update(chatID, adminID, func(p *AdminProcess) { p.PromptMessageID = messageID })
 	return nil
 }
 
-func (b *Bot) SetAdminProcess(adminChatID int64, processType AdminProcessType, duration string) {
-	b.adminProcesses.Set(adminChatID, processType, duration)
-}
-
-func (b *Bot) GetAdminProcess(adminChatID int64) (*AdminProcess, bool) {
-	return b.adminProcesses.Get(adminChatID)
-}
+// expireAdminProcesses cancels admin flows that waited too long for an answer
+func (b *Bot) expireAdminProcesses() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-func (b *Bot) ClearAdminProcess(adminChatID int64) {
-	b.adminProcesses.Clear(adminChatID)
+	for {
+		select {
+		case <-ticker.C:
+			for _, p := range b.adminProcesses.TakeExpired(time.Now()) {
+				log.Printf("[%s] admin process %s of %d timed out", b.name, p.Type, p.AdminID)
+				if p.PromptMessageID == 0 {
+					continue
+				}
+				if err := b.EditMessage(p.ChatID, p.PromptMessageID, "отменено по таймауту"); err != nil {
+					log.Printf("[%s] failed to mark admin prompt as timed out: %v", b.name, err)
+				}
+			}
+		case <-b.stopChan:
+			return
+		}
+	}
 }
@@ -0,0 +1,75 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/schedule"
+	"github.com/sukalov/mshkbot/internal/telegram"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// NotifyPromoted tells a player who moved up from the queue that they are in the tournament.
+// if the bot cannot write to them, the player is mentioned in the main group and admins are told
+func (b *Bot) NotifyPromoted(tournamentID string, player types.Player) {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return
+	}
+
+	text := fmt.Sprintf("освободилось место, и вы прошли из очереди в турнир «%s»", t.DisplayName())
+	if !t.Metadata.StartsAt.IsZero() {
+		text += fmt.Sprintf(". начало в %s", t.Metadata.StartsAt.In(schedule.Moscow()).Format("15:04"))
+	}
+
+	err := b.SendMessage(int64(player.ID), text)
+	if err == nil {
+		log.Printf("notified promoted player %d about tournament %s", player.ID, tournamentID)
+		return
+	}
+	log.Printf("failed to notify promoted player %d: %v", player.ID, err)
+
+	mention := tgbotapi.NewMessage(b.mainGroupID, fmt.Sprintf("%s, %s", mentionOf(player), html.EscapeString(text)))
+	mention.ParseMode = tgbotapi.ModeHTML
+	if _, err := b.Send(mention); err != nil {
+		log.Printf("failed to mention promoted player %d in main group: %v", player.ID, err)
+	}
+
+	reason := "не получилось написать"
+	if isBlocked(err) {
+		reason = "бот заблокирован у"
+	}
+	notice := fmt.Sprintf("%s %s (%d): игрок прошёл из очереди в турнир «%s», но не знает об этом", reason, playerLabel(player), player.ID, t.DisplayName())
+	if err := b.SendMessage(b.adminGroupID, notice); err != nil {
+		log.Printf("failed to send promotion fallback to admins: %v", err)
+	}
+}
+
+// NotifyAdmins posts a notice to the admin group
+func (b *Bot) NotifyAdmins(text string) error {
+	return b.SendMessage(b.adminGroupID, text)
+}
+
+// isBlocked reports whether telegram refused a private message because the user blocked the bot
+// or never started it
+func isBlocked(err error) bool {
+	return errors.Is(err, telegram.ErrBlocked)
+}
+
+func playerLabel(player types.Player) string {
+	if player.Username != "" {
+		return "@" + player.Username
+	}
+	return player.SavedName
+}
+
+func mentionOf(player types.Player) string {
+	name := player.SavedName
+	if name == "" {
+		name = player.Username
+	}
+	return fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, player.ID, html.EscapeString(name))
+}
@@ -0,0 +1,106 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// result codes used in callback data of the result buttons
+var resultCodes = map[pairing.Result]string{
+	pairing.WhiteWins: "w",
+	pairing.Draw:      "d",
+	pairing.BlackWins: "b",
+}
+
+// ResultFromCode turns callback data of a result button back into a result
+func ResultFromCode(code string) (pairing.Result, bool) {
+	for result, c := range resultCodes {
+		if c == code {
+			return result, true
+		}
+	}
+	return pairing.NoResult, false
+}
+
+// PostPairings sends the pairings of a round to the main group with result buttons
+func (b *Bot) PostPairings(tournamentID string, round types.Round) (int, error) {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return 0, fmt.Errorf("tournament %s does not exist", tournamentID)
+	}
+
+	msg := tgbotapi.NewMessage(b.mainGroupID, t.PairingsMessage(round))
+	if keyboard, ok := pairingsKeyboard(tournamentID, round); ok {
+		msg.ReplyMarkup = keyboard
+	}
+	sent, err := b.Send(msg)
+	if err != nil {
+		return 0, err
+	}
+	return sent.MessageID, nil
+}
+
+// UpdatePairingsMessage re-renders the pairings of a round after a result changed
+func (b *Bot) UpdatePairingsMessage(tournamentID string, number int) error {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists || number < 1 || number > len(t.Rounds) {
+		return nil
+	}
+	round := t.Rounds[number-1]
+	if round.MessageID == 0 {
+		return nil
+	}
+
+	keyboard, ok := pairingsKeyboard(tournamentID, round)
+	if !ok {
+		keyboard = tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(b.mainGroupID, round.MessageID, t.PairingsMessage(round), keyboard)
+	_, err := b.Request(edit)
+	return ignoreNotModified(err)
+}
+
+// UpdateStandingsMessage edits the pinned table of a tournament, posting and pinning it the first time
+func (b *Bot) UpdateStandingsMessage(tournamentID string) error {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return nil
+	}
+
+	if t.Metadata.StandingsMessageID != 0 {
+		return ignoreNotModified(b.EditMessage(b.mainGroupID, t.Metadata.StandingsMessageID, t.StandingsMessage()))
+	}
+
+	messageID, err := b.SendMessageAndGetID(b.mainGroupID, t.StandingsMessage())
+	if err != nil {
+		return err
+	}
+	if err := b.Tournament.SetStandingsMessageID(context.Background(), tournamentID, messageID); err != nil {
+		return err
+	}
+	return b.PinMessage(b.mainGroupID, messageID)
+}
+
+// pairingsKeyboard has a row of result buttons for every game without a final result
+func pairingsKeyboard(tournamentID string, round types.Round) (tgbotapi.InlineKeyboardMarkup, bool) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, game := range round.Games {
+		if game.IsBye() || game.Result != pairing.NoResult {
+			continue
+		}
+		var row []tgbotapi.InlineKeyboardButton
+		for _, result := range []pairing.Result{pairing.WhiteWins, pairing.Draw, pairing.BlackWins} {
+			data := fmt.Sprintf("result:%s:%d:%d:%s", tournamentID, round.Number, game.Board, resultCodes[result])
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d: %s", game.Board, result), data))
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return tgbotapi.InlineKeyboardMarkup{}, false
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(rows...), true
+}
@@ -0,0 +1,27 @@
+package cron
+
+import (
+	"context"
+
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/jobs"
+)
+
+// liftRestrictions is the handler of the restriction expiry job: it lifts what ran out
+// and schedules the job again for the next restriction to end
+func (s *Scheduler) liftRestrictions(_ context.Context, _ jobs.Job) error {
+	if err := s.liftExpiredRestrictions(); err != nil {
+		return err
+	}
+	return eligibility.ScheduleRestrictionExpiry(s.bot)
+}
+
+// liftExpiredRestrictions clears bans and green suspensions that ran out and tells the users
+func (s *Scheduler) liftExpiredRestrictions() error {
+	lifted, err := s.bot.Users.LiftExpiredRestrictions(s.clock.Now().UTC())
+	if err != nil {
+		return err
+	}
+	eligibility.AnnounceLifted(s.bot, lifted)
+	return nil
+}
@@ -2,10 +2,16 @@ package cron
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/jobs"
+	"github.com/sukalov/mshkbot/internal/schedule"
+	"github.com/sukalov/mshkbot/internal/types"
 )
 
 type Scheduler struct {
@@ -13,52 +19,47 @@ type Scheduler struct {
 	mainGroupID int64
 	stopChan    chan struct{}
 	timezone    *time.Location
+	clock       schedule.Clock
 }
 
-// scheduledTask represents a task that runs at a specific time each week
-type scheduledTask struct {
-	weekday time.Weekday
-	hour    int
-	minute  int
-	handler func()
-}
-
-func New(bot *bot.Bot, mainGroupID int64) *Scheduler {
-	// moscow timezone (utc+3)
-	moscowTZ := time.FixedZone("moscow", 3*60*60)
-
-	return &Scheduler{
+// New creates the scheduler of the main group; clock is schedule.RealClock() outside of tests
+func New(bot *bot.Bot, mainGroupID int64, clock schedule.Clock) *Scheduler {
+	s := &Scheduler{
 		bot:         bot,
 		mainGroupID: mainGroupID,
 		stopChan:    make(chan struct{}),
-		timezone:    moscowTZ,
+		timezone:    schedule.Moscow(),
+		clock:       clock,
 	}
+	bot.Jobs.Handle(jobs.KindRestrictionExpiry, s.liftRestrictions)
+	bot.Jobs.Handle(jobs.KindTournamentEnd, s.endTournament)
+	return s
 }
 
 func (s *Scheduler) Start() {
 	log.Println("starting cron scheduler")
 
-	s.scheduleWeekly(time.Monday, 15, 35, func() {
-		s.scheduledTournamentStart(26, 0, 0, "запись на южный турнир открыта. нажмите /checkin чтобы записаться")
-	})
-	s.scheduleWeekly(time.Monday, 21, 00, func() {
-		s.scheduledTournamentEnd()
-	})
-
-	s.scheduleWeekly(time.Tuesday, 12, 00, func() {
-		s.scheduledTournamentStart(24, 1600, 1400, "открыта запись на зелёный турнир. нажмите /checkin чтобы записаться")
-	})
-
-	s.scheduleWeekly(time.Tuesday, 21, 00, func() {
-		s.scheduledTournamentEnd()
-	})
-
-	s.scheduleWeekly(time.Wednesday, 12, 00, func() {
-		s.scheduledTournamentStart(24, 0, 0, "можно записываться на турнир в ладье. нажмите /checkin чтобы записаться")
-	})
-	s.scheduleWeekly(time.Wednesday, 21, 00, func() {
-		s.scheduledTournamentEnd()
-	})
+	if err := db.SeedScheduledEvents(schedule.DefaultEvents()); err != nil {
+		log.Printf("failed to seed schedule: %v", err)
+	}
+
+	s.catchUp()
+
+	runner := &schedule.Runner{
+		Location: s.timezone,
+		Clock:    s.clock,
+		Load:     db.GetScheduledEvents,
+		Execute:  s.execute,
+		Reload:   s.bot.ScheduleReloads(),
+		Reloaded: s.catchUp,
+		Stop:     s.stopChan,
+	}
+	go runner.Run()
+
+	// restrictions set before the job queue existed have no job yet
+	if err := eligibility.ScheduleRestrictionExpiry(s.bot); err != nil {
+		log.Printf("failed to schedule restriction expiry: %v", err)
+	}
 }
 
 func (s *Scheduler) Stop() {
@@ -66,106 +67,179 @@ func (s *Scheduler) Stop() {
 	close(s.stopChan)
 }
 
-// scheduleWeekly creates a goroutine that runs a task at the specified weekday and time
-func (s *Scheduler) scheduleWeekly(weekday time.Weekday, hour, minute int, handler func()) {
-	go func() {
-		task := scheduledTask{
-			weekday: weekday,
-			hour:    hour,
-			minute:  minute,
-			handler: handler,
+// catchUp brings tournaments in line with the schedule after a restart or an edit:
+// windows that are open right now get their tournament opened or its announcement restored,
+// tournaments whose window closed while the bot was down are closed.
+// a tournament whose event was paused or deleted keeps its registration until the planned close
+func (s *Scheduler) catchUp() {
+	events, err := db.GetScheduledEvents()
+	if err != nil {
+		log.Printf("failed to load schedule for catch-up: %v", err)
+		return
+	}
+
+	now := s.clock.Now()
+	for _, event := range events {
+		t, isOpen := s.bot.Tournament.Get(event.Key)
+		active := schedule.IsActive(event, now, s.timezone)
+
+		switch {
+		case active && !isOpen:
+			log.Printf("catch-up: opening missed tournament %s", event.Key)
+			s.scheduledTournamentStart(event.Metadata(now, s.timezone))
+		case active && t.Metadata.AnnouncementMessageID == 0:
+			log.Printf("catch-up: restoring announcement of tournament %s", event.Key)
+			s.postAnnouncement(event.Key)
+		case !active && isOpen && t.Metadata.CreatedAt.Before(schedule.LastClose(event, now, s.timezone)):
+			log.Printf("catch-up: closing overdue tournament %s", event.Key)
+			s.scheduledTournamentEnd(event.Key)
 		}
+	}
+
+	s.closeOrphans(events, now)
+}
+
+// closeOrphans ends the scheduled tournaments that the runner no longer closes
+// because their event is paused or gone
+func (s *Scheduler) closeOrphans(events []schedule.Event, now time.Time) {
+	byKey := make(map[string]schedule.Event, len(events))
+	for _, event := range events {
+		byKey[event.Key] = event
+	}
 
-		// calculate initial delay
-		ticker := time.NewTicker(s.timeUntilNext(task))
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				log.Printf("executing task for %s at %02d:%02d", weekday, hour, minute)
-				handler()
-				// reset ticker for next week
-				ticker.Reset(7 * 24 * time.Hour)
-			case <-s.stopChan:
-				return
+	for _, t := range s.bot.Tournament.Open() {
+		id := t.Metadata.ID
+		// tournaments created by hand have no planned close
+		if t.Metadata.StartsAt.IsZero() {
+			continue
+		}
+		if event, ok := byKey[id]; ok && !event.Paused {
+			// the runner closes an active window, a close planned while the event was paused is stale
+			if schedule.IsActive(event, now, s.timezone) {
+				if err := s.bot.Jobs.Cancel(endJobID(id)); err != nil {
+					log.Printf("failed to cancel the end of tournament %s: %v", id, err)
+				}
 			}
+			continue
+		}
+		if !t.Metadata.StartsAt.After(now) {
+			log.Printf("catch-up: closing tournament %s of a paused or deleted event", id)
+			s.scheduledTournamentEnd(id)
+			continue
 		}
-	}()
+		s.scheduleEnd(id, t.Metadata.StartsAt)
+	}
 }
 
-// timeUntilNext calculates duration until the next occurrence of the scheduled task
-func (s *Scheduler) timeUntilNext(task scheduledTask) time.Duration {
-	now := time.Now().In(s.timezone)
-
-	// calculate days until target weekday
-	currentWeekday := int(now.Weekday())
-	targetWeekday := int(task.weekday)
-	daysUntil := (targetWeekday - currentWeekday + 7) % 7
+func (s *Scheduler) execute(action schedule.Action) {
+	log.Printf("executing %s for %s at %s", action.Kind, action.Event.Key, action.At.In(s.timezone).Format("15:04"))
+	switch action.Kind {
+	case schedule.ActionOpen:
+		s.scheduledTournamentStart(action.Event.Metadata(action.At, s.timezone))
+	case schedule.ActionClose:
+		s.scheduledTournamentEnd(action.Event.Key)
+	}
+}
 
-	// create target time
-	targetTime := time.Date(
-		now.Year(), now.Month(), now.Day()+daysUntil,
-		task.hour, task.minute, 0, 0, s.timezone,
-	)
+func (s *Scheduler) scheduledTournamentStart(metadata types.TournamentMetadata) {
+	ctx := context.Background()
 
-	// if target time is in the past, schedule for next week
-	if targetTime.Before(now) || targetTime.Equal(now) {
-		targetTime = targetTime.AddDate(0, 0, 7)
+	if err := s.bot.Tournament.CreateTournament(ctx, metadata); err != nil {
+		log.Printf("failed to create tournament %s: %v", metadata.ID, err)
+		return
 	}
 
-	duration := targetTime.Sub(now)
-	log.Printf("next %s task in %v (at %s)", task.weekday, duration, targetTime.Format("2006-01-02 15:04:05"))
+	s.postAnnouncement(metadata.ID)
 
-	return duration
+	log.Printf("tournament %s started: limit=%d, lichess_limit=%d, chesscom_limit=%d, intro=%s", metadata.ID, metadata.Limit, metadata.LichessRatingLimit, metadata.ChesscomRatingLimit, metadata.AnnouncementIntro)
 }
 
-func (s *Scheduler) scheduledTournamentStart(limit int, lichessRatingLimit int, chesscomRatingLimit int, announcementIntro string) {
+// postAnnouncement sends and pins the registration list of a tournament
+func (s *Scheduler) postAnnouncement(tournamentID string) {
 	ctx := context.Background()
 
-	if err := s.bot.Tournament.CreateTournament(ctx, limit, lichessRatingLimit, chesscomRatingLimit, announcementIntro); err != nil {
-		log.Printf("failed to create tournament: %v", err)
+	t, exists := s.bot.Tournament.Get(tournamentID)
+	if !exists {
 		return
 	}
 
-	announcementMessage := announcementIntro + "\n\nучастники:\nпока никого нет"
-
-	messageID, err := s.bot.SendMessageAndGetID(s.mainGroupID, announcementMessage)
+	messageID, err := s.bot.SendMessageAndGetID(s.mainGroupID, t.ListMessage())
 	if err != nil {
 		log.Printf("failed to send message: %v", err)
 		return
 	}
 
-	if err := s.bot.Tournament.SetAnnouncementMessageID(ctx, messageID); err != nil {
+	if err := s.bot.Tournament.SetAnnouncementMessageID(ctx, tournamentID, messageID); err != nil {
 		log.Printf("failed to store announcement message ID: %v", err)
 	}
 
 	if err := s.bot.PinMessage(s.mainGroupID, messageID); err != nil {
 		log.Printf("failed to pin message: %v", err)
 	}
+}
+
+// scheduledTournamentEnd closes the tournament, or leaves it open and retries through the job queue
+// if it could not be archived
+func (s *Scheduler) scheduledTournamentEnd(tournamentID string) {
+	err := s.closeTournament(context.Background(), tournamentID)
+	if err == nil {
+		return
+	}
 
-	log.Printf("tournament started: limit=%d, lichess_limit=%d, chesscom_limit=%d, intro=%s", limit, lichessRatingLimit, chesscomRatingLimit, announcementIntro)
+	log.Printf("failed to end tournament %s, retrying later: %v", tournamentID, err)
+	s.scheduleEnd(tournamentID, s.clock.Now().Add(time.Minute))
 }
 
-func (s *Scheduler) scheduledTournamentEnd() {
-	ctx := context.Background()
+// scheduleEnd closes the tournament at the given time through the job queue
+func (s *Scheduler) scheduleEnd(tournamentID string, at time.Time) {
+	job := jobs.Job{
+		ID:           endJobID(tournamentID),
+		Kind:         jobs.KindTournamentEnd,
+		RunAt:        at,
+		TournamentID: tournamentID,
+	}
+	if err := s.bot.Jobs.Schedule(job); err != nil {
+		log.Printf("failed to schedule the end of tournament %s: %v", tournamentID, err)
+	}
+}
 
-	if !s.bot.Tournament.Metadata.Exists {
-		log.Printf("no tournament to end")
-		return
+func endJobID(tournamentID string) string {
+	return fmt.Sprintf("%s:%s", jobs.KindTournamentEnd, tournamentID)
+}
+
+// endTournament is the handler of the retry job of scheduledTournamentEnd
+func (s *Scheduler) endTournament(ctx context.Context, job jobs.Job) error {
+	return s.closeTournament(ctx, job.TournamentID)
+}
+
+// closeTournament archives the tournament and only then removes it and unpins its messages,
+// so a failed archive keeps the tournament and its history
+func (s *Scheduler) closeTournament(ctx context.Context, tournamentID string) error {
+	t, exists := s.bot.Tournament.Get(tournamentID)
+	if !exists {
+		log.Printf("no tournament %s to end", tournamentID)
+		return nil
 	}
 
-	announcementMessageID := s.bot.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID != 0 {
-		if err := s.bot.UnpinMessage(s.mainGroupID, announcementMessageID); err != nil {
-			log.Printf("failed to unpin message: %v", err)
-		}
+	if _, err := db.ArchiveTournament(t.Metadata, t.AllPlayers(), t.Rounds, s.clock.Now()); err != nil {
+		return err
 	}
 
-	if err := s.bot.Tournament.RemoveTournament(ctx); err != nil {
-		log.Printf("failed to remove tournament: %v", err)
-		return
+	if err := s.bot.Tournament.RemoveTournament(ctx, tournamentID); err != nil {
+		// the tournament is archived already, a retry would archive it twice
+		log.Printf("failed to remove archived tournament %s: %v", tournamentID, err)
+		return nil
+	}
+
+	for _, messageID := range []int{t.Metadata.AnnouncementMessageID, t.Metadata.StandingsMessageID} {
+		if messageID == 0 {
+			continue
+		}
+		if err := s.bot.UnpinMessage(s.mainGroupID, messageID); err != nil {
+			log.Printf("failed to unpin message: %v", err)
+		}
 	}
 
-	log.Printf("tournament ended and removed")
+	log.Printf("tournament %s ended and removed", tournamentID)
+	return nil
 }
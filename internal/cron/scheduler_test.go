@@ -0,0 +1,122 @@
+package cron
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/jobs"
+	"github.com/sukalov/mshkbot/internal/schedule"
+	"github.com/sukalov/mshkbot/internal/telegramtest"
+	"github.com/sukalov/mshkbot/internal/tournament"
+)
+
+const mainGroupID = -100
+
+// fixedClock stands still, so the runner never fires and only the catch-up runs
+type fixedClock struct {
+	now time.Time
+}
+
+func (c fixedClock) Now() time.Time {
+	return c.now
+}
+
+func (c fixedClock) After(time.Duration) <-chan time.Time {
+	return nil
+}
+
+func newBot(t *testing.T) (*bot.Bot, *telegramtest.Server) {
+	t.Helper()
+	if err := db.OpenFile(":memory:"); err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+
+	b, err := bot.New("test", telegramtest.Token, server.URL, mainGroupID, -200, bot.Storage{
+		Tournaments:    tournament.NewMemoryStore(),
+		Users:          db.NewSQLUsers(db.Database),
+		AdminProcesses: bot.NewMemoryProcesses(),
+		Jobs:           jobs.NewMemoryBackend(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+	return b, server
+}
+
+// monday returns a time on the monday of the south event
+func monday(hour, minute int) time.Time {
+	return time.Date(2026, 10, 19, hour, minute, 0, 0, schedule.Moscow())
+}
+
+func TestRestartInsideTheWindowOpensTheTournament(t *testing.T) {
+	b, server := newBot(t)
+
+	s := New(b, mainGroupID, fixedClock{now: monday(16, 0)})
+	s.Start()
+	defer s.Stop()
+
+	south, open := b.Tournament.Get("south")
+	if !open {
+		t.Fatalf("tournament south was not opened")
+	}
+	if want := monday(21, 0); !south.Metadata.StartsAt.Equal(want) {
+		t.Errorf("starts at %v, want %v", south.Metadata.StartsAt, want)
+	}
+
+	announcement, ok := server.Message(mainGroupID, south.Metadata.AnnouncementMessageID)
+	if !ok || !announcement.Pinned || !strings.Contains(announcement.Text, "южный") {
+		t.Errorf("no pinned announcement, got %+v", server.Messages(mainGroupID))
+	}
+
+	if _, open := b.Tournament.Get("green"); open {
+		t.Errorf("tournament green was opened outside of its window")
+	}
+}
+
+func TestRestartAfterTheCloseTimeClosesTheTournament(t *testing.T) {
+	b, server := newBot(t)
+
+	metadata := schedule.DefaultEvents()[0].Metadata(monday(16, 0), schedule.Moscow())
+	metadata.CreatedAt = monday(16, 0)
+	if err := b.Tournament.CreateTournament(context.Background(), metadata); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+	messageID, err := b.SendMessageAndGetID(mainGroupID, "анонс")
+	if err != nil {
+		t.Fatalf("failed to send announcement: %v", err)
+	}
+	if err := b.Tournament.SetAnnouncementMessageID(context.Background(), "south", messageID); err != nil {
+		t.Fatalf("failed to store announcement: %v", err)
+	}
+	if err := b.PinMessage(mainGroupID, messageID); err != nil {
+		t.Fatalf("failed to pin announcement: %v", err)
+	}
+
+	s := New(b, mainGroupID, fixedClock{now: monday(22, 0)})
+	s.Start()
+	defer s.Stop()
+
+	if _, open := b.Tournament.Get("south"); open {
+		t.Fatalf("tournament south is still open")
+	}
+
+	var archived []db.Tournament
+	if err := db.Database.Where("key = ?", "south").Find(&archived).Error; err != nil {
+		t.Fatalf("failed to load archive: %v", err)
+	}
+	if len(archived) != 1 || !archived[0].ClosedAt.Equal(monday(22, 0)) {
+		t.Errorf("unexpected archive: %+v", archived)
+	}
+
+	if announcement, _ := server.Message(mainGroupID, messageID); announcement.Pinned {
+		t.Errorf("announcement is still pinned")
+	}
+}
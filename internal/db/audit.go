@@ -0,0 +1,97 @@
+// audit.go
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// RecordAudit writes an audit event. a failure is logged and returned,
+// callers usually go on since the change itself already happened
+func RecordAudit(event AuditEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := Database.WithContext(ctx).Create(&event).Error; err != nil {
+		log.Printf("failed to record audit event %s by %d: %v", event.Action, event.ActorID, err)
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// AuditFilter narrows GetAuditEvents; zero fields match everything
+type AuditFilter struct {
+	UserID int64
+	Action string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+}
+
+// GetAuditEvents returns matching events, newest first. UserID matches both the actor
+// and the target, Action matches as a prefix so "user." finds every user change
+func GetAuditEvents(filter AuditFilter) ([]AuditEvent, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx := Database.WithContext(ctx).Model(&AuditEvent{})
+	if filter.UserID != 0 {
+		tx = tx.Where("actor_id = ? OR target_id = ?", filter.UserID, filter.UserID)
+	}
+	if filter.Action != "" {
+		tx = tx.Where("action LIKE ?", filter.Action+"%")
+	}
+	if !filter.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		tx = tx.Where("created_at < ?", filter.Until)
+	}
+	if filter.Limit > 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+
+	var events []AuditEvent
+	if err := tx.Order("created_at DESC, id DESC").Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to get audit events: %w", err)
+	}
+	return events, nil
+}
+
+// maxAuditValue keeps long values like a whole deleted record from flooding chats
+const maxAuditValue = 200
+
+func (e AuditEvent) String() string {
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+	actor := fmt.Sprintf("админ %d", e.ActorID)
+	if e.ActorID == 0 {
+		actor = "бот"
+	}
+	s := fmt.Sprintf("%s %s, %s", e.CreatedAt.In(moscowTZ).Format("02.01.2006 15:04"), e.Action, actor)
+
+	target := e.Target
+	if e.TargetID != 0 {
+		target = strings.TrimSpace(fmt.Sprintf("%d %s", e.TargetID, e.Target))
+	}
+	if target != "" {
+		s += ", цель: " + target
+	}
+	if e.Before != "" || e.After != "" {
+		s += fmt.Sprintf(": %s → %s", shortAuditValue(e.Before), shortAuditValue(e.After))
+	}
+	return s
+}
+
+func shortAuditValue(value string) string {
+	if value == "" {
+		return "—"
+	}
+	runes := []rune(value)
+	if len(runes) > maxAuditValue {
+		return string(runes[:maxAuditValue]) + "…"
+	}
+	return value
+}
@@ -5,72 +5,81 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
-	"sync"
 	"time"
 
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
-
-	"github.com/sukalov/mshkbot/internal/utils"
 )
 
-var (
-	Database *gorm.DB
-	once     sync.Once
-	initErr  error
-)
+var Database *gorm.DB
 
-func init() {
-	once.Do(func() {
-		env, err := utils.LoadEnv([]string{"TURSO_DATABASE_URL", "TURSO_AUTH_TOKEN"})
-		if err != nil {
-			initErr = fmt.Errorf("failed to load db env: %w", err)
-			log.Fatalf("database initialization failed: %v", initErr)
-		}
-		url := fmt.Sprintf("%s?authToken=%s", env["TURSO_DATABASE_URL"], env["TURSO_AUTH_TOKEN"])
+// Connect opens the turso database and migrates the schema
+func Connect(url, authToken string) error {
+	// open connection with database/sql first
+	sqlDB, err := sql.Open("libsql", fmt.Sprintf("%s?authToken=%s", url, authToken))
+	if err != nil {
+		return fmt.Errorf("failed to open db: %w", err)
+	}
 
-		// open connection with database/sql first
-		sqlDB, err := sql.Open("libsql", url)
-		if err != nil {
-			log.Fatalf("failed to open db: %v", err)
-		}
+	// connection pool configuration
+	sqlDB.SetMaxOpenConns(25)
+	sqlDB.SetMaxIdleConns(25)
+	sqlDB.SetConnMaxLifetime(5 * time.Minute)
 
-		// connection pool configuration
-		sqlDB.SetMaxOpenConns(25)
-		sqlDB.SetMaxIdleConns(25)
-		sqlDB.SetConnMaxLifetime(5 * time.Minute)
+	// verifying database connection
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return fmt.Errorf("failed to ping database: %w", err)
+	}
 
-		// verifying database connection
-		if pingErr := sqlDB.Ping(); pingErr != nil {
-			log.Fatalf("failed to ping database: %v", pingErr)
-		}
+	return open(sqlite.Dialector{Conn: sqlDB}, logger.Info)
+}
 
-		// wrap with gorm
-		Database, initErr = gorm.Open(sqlite.Dialector{
-			Conn: sqlDB,
-		}, &gorm.Config{
-			Logger: logger.Default.LogMode(logger.Info),
-			NowFunc: func() time.Time {
-				return time.Now().UTC()
-			},
-		})
-		if initErr != nil {
-			log.Fatalf("failed to initialize gorm: %v", initErr)
-		}
+// OpenFile opens a local sqlite file, ":memory:" keeps the database in memory
+// for as long as the process runs. queries are not logged; the sqlite driver needs cgo
+func OpenFile(path string) error {
+	sqlDB, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return fmt.Errorf("failed to open db: %w", err)
+	}
+	// every connection to :memory: is a separate database
+	sqlDB.SetMaxOpenConns(1)
 
-		// run auto migrations
-		if err := Database.AutoMigrate(
-			&User{},
-			// add other models here as you create them
-		); err != nil {
-			log.Fatalf("failed to auto migrate: %v", err)
-		}
+	return open(sqlite.Dialector{Conn: sqlDB}, logger.Silent)
+}
 
-		log.Println("database connected and schema migrated successfully")
+func open(dialector gorm.Dialector, logLevel logger.LogLevel) error {
+	database, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.Default.LogMode(logLevel),
+		NowFunc: func() time.Time {
+			return time.Now().UTC()
+		},
 	})
-	
+	if err != nil {
+		return fmt.Errorf("failed to initialize gorm: %w", err)
+	}
+
+	// run auto migrations
+	if err := database.AutoMigrate(
+		&User{},
+		&Tournament{},
+		&Registration{},
+		&RegistrationPeak{},
+		&ScheduledEvent{},
+		&Game{},
+		&RatingChange{},
+		&AuditEvent{},
+		&Setting{},
+		// add other models here as you create them
+	); err != nil {
+		return fmt.Errorf("failed to auto migrate: %w", err)
+	}
+
+	Database = database
+	log.Println("database connected and schema migrated successfully")
+	return nil
 }
 
 // closes the database connection safely
@@ -0,0 +1,97 @@
+// ratings.go
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/rating"
+	"gorm.io/gorm"
+)
+
+// applyClubRatings rates the games of an archived tournament and writes the rating history
+func applyClubRatings(tx *gorm.DB, tournament Tournament) error {
+	if len(tournament.Games) == 0 {
+		return nil
+	}
+
+	games := make([]rating.Game, 0, len(tournament.Games))
+	ids := make(map[int64]bool)
+	for _, g := range tournament.Games {
+		games = append(games, rating.Game{
+			White: int(g.WhiteID),
+			Black: int(g.BlackID),
+			Score: pairing.Game{White: int(g.WhiteID), Black: int(g.BlackID), Result: pairing.Result(g.Result)}.Points(int(g.WhiteID)),
+		})
+		ids[g.WhiteID], ids[g.BlackID] = true, true
+	}
+
+	chatIDs := make([]int64, 0, len(ids))
+	for id := range ids {
+		chatIDs = append(chatIDs, id)
+	}
+	var users []User
+	if err := tx.Where("chat_id IN ?", chatIDs).Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to load players for rating: %w", err)
+	}
+
+	before := make(map[int]rating.Player, len(users))
+	for _, u := range users {
+		before[int(u.ChatID)] = clubRating(u)
+	}
+
+	for id, after := range rating.Apply(before, games) {
+		if _, known := before[id]; !known {
+			// games of people who never registered with the bot are not rated
+			continue
+		}
+		if err := tx.Model(&User{}).
+			Where("chat_id = ?", id).
+			Updates(map[string]interface{}{"club_rating": after.Rating, "club_games": after.Games}).Error; err != nil {
+			return fmt.Errorf("failed to update club rating: %w", err)
+		}
+		change := RatingChange{
+			UserID:       int64(id),
+			TournamentID: tournament.ID,
+			Before:       before[id].Rating,
+			After:        after.Rating,
+			Games:        after.Games - before[id].Games,
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return fmt.Errorf("failed to write rating history: %w", err)
+		}
+	}
+	return nil
+}
+
+// clubRating returns the user's club rating, Initial for players without rated games
+func clubRating(u User) rating.Player {
+	if u.ClubGames == 0 {
+		return rating.Player{Rating: rating.Initial}
+	}
+	return rating.Player{Rating: u.ClubRating, Games: u.ClubGames}
+}
+
+// ClubRating returns the current club rating of a user and whether it is based on any games
+func ClubRating(u User) (int, bool) {
+	return clubRating(u).Rating, u.ClubGames > 0
+}
+
+// GetRatingHistory returns the latest club rating changes of a user, newest first
+func GetRatingHistory(chatID int64, limit int) ([]RatingChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var changes []RatingChange
+	result := Database.WithContext(ctx).
+		Where("user_id = ?", chatID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&changes)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get rating history: %w", result.Error)
+	}
+	return changes, nil
+}
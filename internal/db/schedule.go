@@ -0,0 +1,194 @@
+// schedule.go
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/rejoin"
+	"github.com/sukalov/mshkbot/internal/schedule"
+	"gorm.io/gorm"
+)
+
+func eventFromModel(m ScheduledEvent) schedule.Event {
+	policy, err := ratings.ParsePolicy(m.PeakPolicy)
+	if err != nil {
+		log.Printf("invalid peak policy %q of scheduled event %s: %v", m.PeakPolicy, m.Key, err)
+	}
+	rejoinPolicy, err := rejoin.ParsePolicy(m.RejoinPolicy)
+	if err != nil {
+		log.Printf("invalid rejoin policy %q of scheduled event %s: %v", m.RejoinPolicy, m.Key, err)
+	}
+	return schedule.Event{
+		ID:                  m.ID,
+		Key:                 m.Key,
+		Name:                m.Name,
+		Weekday:             time.Weekday(m.Weekday),
+		OpenHour:            m.OpenHour,
+		OpenMinute:          m.OpenMinute,
+		CloseHour:           m.CloseHour,
+		CloseMinute:         m.CloseMinute,
+		Limit:               m.Limit,
+		LichessRatingLimit:  m.LichessRatingLimit,
+		ChesscomRatingLimit: m.ChesscomRatingLimit,
+		ClubRatingLimit:     m.ClubRatingLimit,
+		AnnouncementIntro:   m.AnnouncementIntro,
+		ConfirmationMinutes: m.ConfirmationMinutes,
+		PeakPolicy:          policy,
+		RejoinPolicy:        rejoinPolicy,
+		RequireVerified:     m.RequireVerified,
+		Paused:              m.Paused,
+	}
+}
+
+func modelFromEvent(e schedule.Event) ScheduledEvent {
+	return ScheduledEvent{
+		ID:                  e.ID,
+		Key:                 e.Key,
+		Name:                e.Name,
+		Weekday:             int(e.Weekday),
+		OpenHour:            e.OpenHour,
+		OpenMinute:          e.OpenMinute,
+		CloseHour:           e.CloseHour,
+		CloseMinute:         e.CloseMinute,
+		Limit:               e.Limit,
+		LichessRatingLimit:  e.LichessRatingLimit,
+		ChesscomRatingLimit: e.ChesscomRatingLimit,
+		ClubRatingLimit:     e.ClubRatingLimit,
+		AnnouncementIntro:   e.AnnouncementIntro,
+		ConfirmationMinutes: e.ConfirmationMinutes,
+		PeakPolicy:          e.PeakPolicy.Spec(),
+		RejoinPolicy:        e.RejoinPolicy.Spec(),
+		RequireVerified:     e.RequireVerified,
+		Paused:              e.Paused,
+	}
+}
+
+// GetScheduledEvents returns all recurring events ordered by weekday and time
+func GetScheduledEvents() ([]schedule.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var models []ScheduledEvent
+	result := Database.WithContext(ctx).
+		Order("weekday, open_hour, open_minute").
+		Find(&models)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get scheduled events: %w", result.Error)
+	}
+
+	events := make([]schedule.Event, 0, len(models))
+	for _, m := range models {
+		events = append(events, eventFromModel(m))
+	}
+	return events, nil
+}
+
+func GetScheduledEvent(key string) (schedule.Event, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var m ScheduledEvent
+	result := Database.WithContext(ctx).Where("key = ?", key).First(&m)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return schedule.Event{}, fmt.Errorf("scheduled event not found: %s", key)
+		}
+		return schedule.Event{}, fmt.Errorf("failed to get scheduled event: %w", result.Error)
+	}
+
+	return eventFromModel(m), nil
+}
+
+func CreateScheduledEvent(e schedule.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := modelFromEvent(e)
+	m.ID = 0
+	if err := Database.WithContext(ctx).Create(&m).Error; err != nil {
+		return fmt.Errorf("failed to create scheduled event: %w", err)
+	}
+	return nil
+}
+
+// SaveScheduledEvent overwrites every field of an existing event
+func SaveScheduledEvent(e schedule.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	m := modelFromEvent(e)
+	result := Database.WithContext(ctx).
+		Model(&ScheduledEvent{}).
+		Where("key = ?", e.Key).
+		Select("*").
+		Omit("id").
+		Updates(&m)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update scheduled event: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("scheduled event not found: %s", e.Key)
+	}
+	return nil
+}
+
+func DeleteScheduledEvent(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := Database.WithContext(ctx).Where("key = ?", key).Delete(&ScheduledEvent{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete scheduled event: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("scheduled event not found: %s", key)
+	}
+	return nil
+}
+
+// scheduleSeededKey marks that the default schedule was seeded,
+// so deleting every event does not bring the defaults back
+const scheduleSeededKey = "schedule_seeded"
+
+// SeedScheduledEvents fills the schedule with the given events once.
+// a schedule that already has events counts as seeded
+func SeedScheduledEvents(events []schedule.Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return Database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var marker Setting
+		err := tx.Where("key = ?", scheduleSeededKey).First(&marker).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("failed to read schedule seed marker: %w", err)
+		}
+
+		var count int64
+		if err := tx.Model(&ScheduledEvent{}).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count scheduled events: %w", err)
+		}
+		if count == 0 {
+			models := make([]ScheduledEvent, 0, len(events))
+			for _, e := range events {
+				models = append(models, modelFromEvent(e))
+			}
+			if err := tx.Create(&models).Error; err != nil {
+				return fmt.Errorf("failed to seed scheduled events: %w", err)
+			}
+			log.Printf("seeded %d scheduled events", len(models))
+		}
+
+		if err := tx.Create(&Setting{Key: scheduleSeededKey, Value: "1"}).Error; err != nil {
+			return fmt.Errorf("failed to mark schedule as seeded: %w", err)
+		}
+		return nil
+	})
+}
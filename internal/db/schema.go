@@ -9,17 +9,24 @@ import (
 
 // User represents a telegram user
 type User struct {
-	ChatID        int64      `gorm:"primaryKey;column:chat_id"`
-	Username      string     `gorm:"column:username;index"`
-	TgName        string     `gorm:"column:tg_name"`
-	SavedName     string     `gorm:"column:saved_name"`
-	Lichess       *string    `gorm:"column:lichess;unique"`
-	ChessCom      *string    `gorm:"column:chesscom;unique"`
-	BannedUntil   *time.Time `gorm:"column:banned_until"`
-	NotGreenUntil *time.Time `gorm:"column:not_green_until"`
-	TimesPlayed   int        `gorm:"column:times_played;default:0"`
-	State         State      `gorm:"column:state"`
-	AddedAt       time.Time  `gorm:"column:added_at;autoCreateTime"`
+	ChatID            int64      `gorm:"primaryKey;column:chat_id"`
+	Username          string     `gorm:"column:username;index"`
+	TgName            string     `gorm:"column:tg_name"`
+	SavedName         string     `gorm:"column:saved_name"`
+	Lichess           *string    `gorm:"column:lichess;unique"`
+	ChessCom          *string    `gorm:"column:chesscom;unique"`
+	LichessVerified   bool       `gorm:"column:lichess_verified;default:false"`
+	ChessComVerified  bool       `gorm:"column:chesscom_verified;default:false"`
+	VerificationToken string     `gorm:"column:verification_token"`
+	BannedUntil       *time.Time `gorm:"column:banned_until"`
+	BanReason         string     `gorm:"column:ban_reason"`
+	NotGreenUntil     *time.Time `gorm:"column:not_green_until"`
+	NotGreenReason    string     `gorm:"column:not_green_reason"`
+	TimesPlayed       int        `gorm:"column:times_played;default:0"`
+	ClubRating        int        `gorm:"column:club_rating;default:0"`
+	ClubGames         int        `gorm:"column:club_games;default:0"`
+	State             State      `gorm:"column:state"`
+	AddedAt           time.Time  `gorm:"column:added_at;autoCreateTime"`
 }
 
 type State string
@@ -47,6 +54,154 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// Tournament is an archived tournament written when it closes
+type Tournament struct {
+	ID                  uint           `gorm:"primaryKey;autoIncrement;column:id"`
+	Key                 string         `gorm:"column:key;index"`
+	Name                string         `gorm:"column:name"`
+	Limit               int            `gorm:"column:player_limit"`
+	LichessRatingLimit  int            `gorm:"column:lichess_rating_limit"`
+	ChesscomRatingLimit int            `gorm:"column:chesscom_rating_limit"`
+	ClubRatingLimit     int            `gorm:"column:club_rating_limit;default:0"`
+	AnnouncementIntro   string         `gorm:"column:announcement_intro"`
+	OpenedAt            time.Time      `gorm:"column:opened_at"`
+	ClosedAt            time.Time      `gorm:"column:closed_at;index"`
+	Registrations       []Registration `gorm:"foreignKey:TournamentID"`
+	Games               []Game         `gorm:"foreignKey:TournamentID"`
+}
+
+// TableName specifies the table name for Tournament model
+func (Tournament) TableName() string {
+	return "tournaments"
+}
+
+// Registration is one stint of a player in an archived tournament
+type Registration struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement;column:id"`
+	TournamentID uint       `gorm:"column:tournament_id;index;not null"`
+	UserID       int64      `gorm:"column:user_id;index;not null"`
+	Username     string     `gorm:"column:username"`
+	SavedName    string     `gorm:"column:saved_name"`
+	FinalState   string     `gorm:"column:final_state"`
+	CheckedInAt  time.Time  `gorm:"column:checked_in_at"`
+	CheckedOutAt *time.Time `gorm:"column:checked_out_at"`
+	PeakSite     string     `gorm:"column:peak_site"`
+	PeakUsername string     `gorm:"column:peak_username"`
+	PeakBlitz    int        `gorm:"column:peak_blitz"`
+	// Peaks holds every linked account, PeakSite and the fields after it repeat the one with the highest blitz peak
+	Peaks []RegistrationPeak `gorm:"foreignKey:RegistrationID"`
+}
+
+// TableName specifies the table name for Registration model
+func (Registration) TableName() string {
+	return "registrations"
+}
+
+// RegistrationPeak is the snapshot of one linked account taken at check-in
+type RegistrationPeak struct {
+	ID             uint   `gorm:"primaryKey;autoIncrement;column:id"`
+	RegistrationID uint   `gorm:"column:registration_id;index;not null"`
+	Site           string `gorm:"column:site"`
+	SiteUsername   string `gorm:"column:site_username"`
+	BlitzPeak      int    `gorm:"column:blitz_peak"`
+	// Peaks is the json of the peaks per time control
+	Peaks string `gorm:"column:peaks;type:text"`
+}
+
+// TableName specifies the table name for RegistrationPeak model
+func (RegistrationPeak) TableName() string {
+	return "registration_peaks"
+}
+
+// Game is a finished game of an archived tournament
+type Game struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement;column:id"`
+	TournamentID uint   `gorm:"column:tournament_id;index;not null"`
+	Round        int    `gorm:"column:round"`
+	Board        int    `gorm:"column:board"`
+	WhiteID      int64  `gorm:"column:white_id;index"`
+	BlackID      int64  `gorm:"column:black_id;index"`
+	Result       string `gorm:"column:result"`
+}
+
+// TableName specifies the table name for Game model
+func (Game) TableName() string {
+	return "games"
+}
+
+// RatingChange is one step of a user's club rating history
+type RatingChange struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement;column:id"`
+	UserID       int64     `gorm:"column:user_id;index;not null"`
+	TournamentID uint      `gorm:"column:tournament_id;index"`
+	Before       int       `gorm:"column:rating_before"`
+	After        int       `gorm:"column:rating_after"`
+	Games        int       `gorm:"column:games"`
+	CreatedAt    time.Time `gorm:"column:created_at;autoCreateTime"`
+}
+
+// TableName specifies the table name for RatingChange model
+func (RatingChange) TableName() string {
+	return "rating_changes"
+}
+
+// ScheduledEvent is a recurring weekly tournament edited from the admin group
+type ScheduledEvent struct {
+	ID                  uint      `gorm:"primaryKey;autoIncrement;column:id"`
+	Key                 string    `gorm:"column:key;uniqueIndex;not null"`
+	Name                string    `gorm:"column:name"`
+	Weekday             int       `gorm:"column:weekday"`
+	OpenHour            int       `gorm:"column:open_hour"`
+	OpenMinute          int       `gorm:"column:open_minute"`
+	CloseHour           int       `gorm:"column:close_hour"`
+	CloseMinute         int       `gorm:"column:close_minute"`
+	Limit               int       `gorm:"column:player_limit"`
+	LichessRatingLimit  int       `gorm:"column:lichess_rating_limit"`
+	ChesscomRatingLimit int       `gorm:"column:chesscom_rating_limit"`
+	ClubRatingLimit     int       `gorm:"column:club_rating_limit;default:0"`
+	AnnouncementIntro   string    `gorm:"column:announcement_intro"`
+	ConfirmationMinutes int       `gorm:"column:confirmation_minutes;default:0"`
+	RequireVerified     bool      `gorm:"column:require_verified;default:false"`
+	PeakPolicy          string    `gorm:"column:peak_policy;default:''"`
+	RejoinPolicy        string    `gorm:"column:rejoin_policy;default:''"`
+	Paused              bool      `gorm:"column:paused;default:false"`
+	UpdatedAt           time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+// TableName specifies the table name for ScheduledEvent model
+func (ScheduledEvent) TableName() string {
+	return "scheduled_events"
+}
+
+// AuditEvent records who changed what; Before and After hold the old and new values
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement;column:id"`
+	ActorID   int64     `gorm:"column:actor_id;index"`
+	Action    string    `gorm:"column:action;index"`
+	TargetID  int64     `gorm:"column:target_id;index"`
+	Target    string    `gorm:"column:target"`
+	Before    string    `gorm:"column:before;type:text"`
+	After     string    `gorm:"column:after;type:text"`
+	CreatedAt time.Time `gorm:"column:created_at;index;autoCreateTime"`
+}
+
+// TableName specifies the table name for AuditEvent model
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// Setting is a named value the bot keeps between restarts, such as one-time migration markers
+type Setting struct {
+	Key       string    `gorm:"primaryKey;column:key"`
+	Value     string    `gorm:"column:value"`
+	UpdatedAt time.Time `gorm:"column:updated_at;autoUpdateTime"`
+}
+
+// TableName specifies the table name for Setting model
+func (Setting) TableName() string {
+	return "settings"
+}
+
 // add more models below as your project grows
 // example:
 // type Message struct {
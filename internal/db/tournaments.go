@@ -0,0 +1,154 @@
+// tournaments.go
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/types"
+	"gorm.io/gorm"
+)
+
+// ArchiveTournament writes a closing tournament, every registration and every finished game
+// in one transaction and updates club ratings from those games
+func ArchiveTournament(metadata types.TournamentMetadata, players []types.Player, rounds []types.Round, closedAt time.Time) (Tournament, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tournament := Tournament{
+		Key:                 metadata.ID,
+		Name:                metadata.Name,
+		Limit:               metadata.Limit,
+		LichessRatingLimit:  metadata.LichessRatingLimit,
+		ChesscomRatingLimit: metadata.ChesscomRatingLimit,
+		ClubRatingLimit:     metadata.ClubRatingLimit,
+		AnnouncementIntro:   metadata.AnnouncementIntro,
+		OpenedAt:            metadata.CreatedAt,
+		ClosedAt:            closedAt.UTC(),
+	}
+
+	for _, player := range players {
+		tournament.Registrations = append(tournament.Registrations, newRegistration(player))
+	}
+	for _, round := range rounds {
+		for _, game := range round.Games {
+			if game.IsBye() || game.Result == pairing.NoResult {
+				continue
+			}
+			tournament.Games = append(tournament.Games, Game{
+				Round:   round.Number,
+				Board:   game.Board,
+				WhiteID: int64(game.White),
+				BlackID: int64(game.Black),
+				Result:  string(game.Result),
+			})
+		}
+	}
+
+	err := Database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&tournament).Error; err != nil {
+			return err
+		}
+		return applyClubRatings(tx, tournament)
+	})
+	if err != nil {
+		return Tournament{}, fmt.Errorf("failed to archive tournament: %w", err)
+	}
+
+	log.Printf("archived tournament %s (#%d) with %d registrations and %d games", metadata.ID, tournament.ID, len(tournament.Registrations), len(tournament.Games))
+	return tournament, nil
+}
+
+func newRegistration(player types.Player) Registration {
+	registration := Registration{
+		UserID:      int64(player.ID),
+		Username:    player.Username,
+		SavedName:   player.SavedName,
+		FinalState:  player.State,
+		CheckedInAt: player.TimeAdded,
+	}
+	if !player.CheckedOutTime.IsZero() {
+		checkedOut := player.CheckedOutTime
+		registration.CheckedOutAt = &checkedOut
+	}
+	for _, peak := range player.AllPeakRatings() {
+		registration.Peaks = append(registration.Peaks, newRegistrationPeak(peak))
+		// the summary columns keep the account with the highest blitz peak
+		if registration.PeakSite == "" || peak.BlitzPeak > registration.PeakBlitz {
+			registration.PeakSite = peak.Site
+			registration.PeakUsername = peak.SiteUsername
+			registration.PeakBlitz = peak.BlitzPeak
+		}
+	}
+	return registration
+}
+
+func newRegistrationPeak(peak types.PeakRating) RegistrationPeak {
+	archived := RegistrationPeak{
+		Site:         peak.Site,
+		SiteUsername: peak.SiteUsername,
+		BlitzPeak:    peak.BlitzPeak,
+	}
+	if len(peak.Peaks) > 0 {
+		data, err := json.Marshal(peak.Peaks)
+		if err != nil {
+			log.Printf("failed to marshal peaks of %s account %s: %v", peak.Site, peak.SiteUsername, err)
+		} else {
+			archived.Peaks = string(data)
+		}
+	}
+	return archived
+}
+
+// RegistrationRecord is a registration with the tournament it belongs to
+type RegistrationRecord struct {
+	TournamentName string
+	TournamentKey  string
+	ClosedAt       time.Time
+	FinalState     string
+}
+
+// GetRegistrations returns the latest archived registrations of the user, newest first
+func GetRegistrations(chatID int64, limit int) ([]RegistrationRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var records []RegistrationRecord
+	result := Database.WithContext(ctx).
+		Model(&Registration{}).
+		Select("tournaments.name AS tournament_name, tournaments.key AS tournament_key, tournaments.closed_at AS closed_at, registrations.final_state AS final_state").
+		Joins("JOIN tournaments ON tournaments.id = registrations.tournament_id").
+		Where("registrations.user_id = ?", chatID).
+		Order("tournaments.closed_at DESC").
+		Limit(limit).
+		Scan(&records)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to get registrations: %w", result.Error)
+	}
+
+	return records, nil
+}
+
+// CountAttendance returns how many archived tournaments the user actually played in
+func CountAttendance(chatID int64) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var count int64
+	result := Database.WithContext(ctx).
+		Model(&Registration{}).
+		Where("user_id = ? AND final_state = ?", chatID, types.StateInTournament).
+		Distinct("tournament_id").
+		Count(&count)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count attendance: %w", result.Error)
+	}
+
+	return count, nil
+}
@@ -6,15 +6,62 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/types"
 	"github.com/sukalov/mshkbot/internal/utils"
 	"gorm.io/gorm"
 )
 
-func Register(update tgbotapi.Update) error {
+// UserRepository keeps the registered users, their rating accounts and restrictions
+type UserRepository interface {
+	Register(update tgbotapi.Update) error
+	GetOrCreateUser(update tgbotapi.Update) (User, bool, error)
+	GetByChatID(chatID int64) (User, error)
+	GetByUsername(username string) (User, error)
+	GetUser(chatID int64) (User, error)
+	GetAll() ([]User, error)
+	FindUsers(query string) ([]User, error)
+	FindAccountOwner(site, username string, except int64) (User, bool, error)
+	Delete(chatID int64) error
+
+	UpdateSavedName(chatID int64, newName string) error
+	UpdateLichess(chatID int64, lichess string) error
+	UpdateChessCom(chatID int64, chessCom string) error
+	UpdateState(chatID int64, state State) error
+	UpdateLichessAndState(chatID int64, lichess string, newState State) error
+	UpdateChessComAndState(chatID int64, chessCom string, newState State) error
+	SetAccount(chatID int64, site, username string) error
+	SetVerificationToken(chatID int64, token string) error
+	MarkVerified(chatID int64, site string) error
+
+	SetBannedUntil(chatID int64, until *time.Time, reason string) error
+	SetNotGreenUntil(chatID int64, until *time.Time, reason string) error
+	LiftExpiredRestrictions(now time.Time) ([]LiftedRestriction, error)
+	LiftExpiredRestrictionsOf(chatID int64, now time.Time) ([]LiftedRestriction, error)
+	NextRestrictionEnd() (*time.Time, error)
+
+	IncrementTimesPlayed(chatID int64) error
+	DecrementTimesPlayed(chatID int64) error
+
+	TestTransliteration() error
+	TransliterateAllSavedNames() ([]TransliteratedUser, error)
+}
+
+// SQLUsers is the UserRepository on a gorm database: libsql from Connect in production,
+// a sqlite file or :memory: from OpenFile in tests
+type SQLUsers struct {
+	db *gorm.DB
+}
+
+func NewSQLUsers(database *gorm.DB) *SQLUsers {
+	return &SQLUsers{db: database}
+}
+
+func (r *SQLUsers) Register(update tgbotapi.Update) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -29,7 +76,7 @@ func Register(update tgbotapi.Update) error {
 	}
 
 	// FirstOrCreate to avoid duplicates
-	result := Database.WithContext(ctx).Where(User{ChatID: message.Chat.ID}).FirstOrCreate(&user)
+	result := r.db.WithContext(ctx).Where(User{ChatID: message.Chat.ID}).FirstOrCreate(&user)
 	if result.Error != nil {
 		return fmt.Errorf("failed to register user: %w", result.Error)
 	}
@@ -41,12 +88,12 @@ func Register(update tgbotapi.Update) error {
 	return nil
 }
 
-func GetByChatID(chatID int64) (User, error) {
+func (r *SQLUsers) GetByChatID(chatID int64) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var user User
-	result := Database.WithContext(ctx).Where("chat_id = ?", chatID).First(&user)
+	result := r.db.WithContext(ctx).Where("chat_id = ?", chatID).First(&user)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -58,12 +105,12 @@ func GetByChatID(chatID int64) (User, error) {
 	return user, nil
 }
 
-func GetByUsername(username string) (User, error) {
+func (r *SQLUsers) GetByUsername(username string) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var user User
-	result := Database.WithContext(ctx).Where("username = ?", username).First(&user)
+	result := r.db.WithContext(ctx).Where("username = ?", username).First(&user)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
@@ -75,11 +122,11 @@ func GetByUsername(username string) (User, error) {
 	return user, nil
 }
 
-func UpdateSavedName(chatID int64, newName string) error {
+func (r *SQLUsers) UpdateSavedName(chatID int64, newName string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Update("saved_name", newName)
@@ -95,7 +142,7 @@ func UpdateSavedName(chatID int64, newName string) error {
 	return nil
 }
 
-func UpdateLichess(chatID int64, lichess string) error {
+func (r *SQLUsers) UpdateLichess(chatID int64, lichess string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -105,10 +152,13 @@ func UpdateLichess(chatID int64, lichess string) error {
 	}
 	value = &lichess
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
-		Update("lichess", value)
+		Updates(map[string]interface{}{
+			"lichess":          value,
+			"lichess_verified": false,
+		})
 
 	if result.Error != nil {
 		return fmt.Errorf("failed to update lichess: %w", result.Error)
@@ -121,7 +171,7 @@ func UpdateLichess(chatID int64, lichess string) error {
 	return nil
 }
 
-func UpdateChessCom(chatID int64, chessCom string) error {
+func (r *SQLUsers) UpdateChessCom(chatID int64, chessCom string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -131,10 +181,13 @@ func UpdateChessCom(chatID int64, chessCom string) error {
 	}
 	value = &chessCom
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
-		Update("chesscom", value)
+		Updates(map[string]interface{}{
+			"chesscom":          value,
+			"chesscom_verified": false,
+		})
 
 	if result.Error != nil {
 		return fmt.Errorf("failed to update chesscom: %w", result.Error)
@@ -147,11 +200,11 @@ func UpdateChessCom(chatID int64, chessCom string) error {
 	return nil
 }
 
-func UpdateState(chatID int64, state State) error {
+func (r *SQLUsers) UpdateState(chatID int64, state State) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Update("state", state)
@@ -167,14 +220,15 @@ func UpdateState(chatID int64, state State) error {
 	return nil
 }
 
-func SetBannedUntil(chatID int64, until *time.Time) error {
+// SetBannedUntil bans the user until the given time with a reason shown to them; nil lifts the ban
+func (r *SQLUsers) SetBannedUntil(chatID int64, until *time.Time, reason string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
-		Update("banned_until", until)
+		Updates(map[string]interface{}{"banned_until": until, "ban_reason": reason})
 
 	if result.Error != nil {
 		return fmt.Errorf("failed to update ban status: %w", result.Error)
@@ -187,14 +241,15 @@ func SetBannedUntil(chatID int64, until *time.Time) error {
 	return nil
 }
 
-func SetNotGreenUntil(chatID int64, until *time.Time) error {
+// SetNotGreenUntil suspends the user from green tournaments with a reason; nil lifts the suspension
+func (r *SQLUsers) SetNotGreenUntil(chatID int64, until *time.Time, reason string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
-		Update("not_green_until", until)
+		Updates(map[string]interface{}{"not_green_until": until, "not_green_reason": reason})
 
 	if result.Error != nil {
 		return fmt.Errorf("failed to update green status: %w", result.Error)
@@ -207,11 +262,100 @@ func SetNotGreenUntil(chatID int64, until *time.Time) error {
 	return nil
 }
 
-func IncrementTimesPlayed(chatID int64) error {
+// kinds of restrictions lifted by LiftExpiredRestrictions
+const (
+	RestrictionBan   = "ban"
+	RestrictionGreen = "green"
+)
+
+// LiftedRestriction is a ban or green suspension that ran out
+type LiftedRestriction struct {
+	User   User
+	Kind   string
+	Until  time.Time
+	Reason string
+}
+
+// LiftExpiredRestrictions clears bans and green suspensions that ended by now and returns them.
+// a restriction changed by an admin in the meantime is left alone
+func (r *SQLUsers) LiftExpiredRestrictions(now time.Time) ([]LiftedRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return r.liftExpiredRestrictions(ctx, r.db.WithContext(ctx), now)
+}
+
+// LiftExpiredRestrictionsOf is LiftExpiredRestrictions for one user
+func (r *SQLUsers) LiftExpiredRestrictionsOf(chatID int64, now time.Time) ([]LiftedRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return r.liftExpiredRestrictions(ctx, r.db.WithContext(ctx).Where("chat_id = ?", chatID), now)
+}
+
+func (r *SQLUsers) liftExpiredRestrictions(ctx context.Context, query *gorm.DB, now time.Time) ([]LiftedRestriction, error) {
+	var users []User
+	if err := query.
+		Where("banned_until <= ? OR not_green_until <= ?", now, now).
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get expired restrictions: %w", err)
+	}
+
+	var lifted []LiftedRestriction
+	for _, user := range users {
+		for _, restriction := range []struct {
+			kind, untilColumn, reasonColumn string
+			until                           *time.Time
+			reason                          string
+		}{
+			{RestrictionBan, "banned_until", "ban_reason", user.BannedUntil, user.BanReason},
+			{RestrictionGreen, "not_green_until", "not_green_reason", user.NotGreenUntil, user.NotGreenReason},
+		} {
+			if restriction.until == nil || restriction.until.After(now) {
+				continue
+			}
+			result := r.db.WithContext(ctx).
+				Model(&User{}).
+				Where("chat_id = ? AND "+restriction.untilColumn+" <= ?", user.ChatID, now).
+				Updates(map[string]interface{}{restriction.untilColumn: nil, restriction.reasonColumn: ""})
+			if result.Error != nil {
+				log.Printf("failed to lift %s of user %d: %v", restriction.kind, user.ChatID, result.Error)
+				continue
+			}
+			if result.RowsAffected > 0 {
+				lifted = append(lifted, LiftedRestriction{User: user, Kind: restriction.kind, Until: *restriction.until, Reason: restriction.reason})
+			}
+		}
+	}
+	return lifted, nil
+}
+
+// NextRestrictionEnd returns when the earliest ban or green suspension ends, nil if there are none
+func (r *SQLUsers) NextRestrictionEnd() (*time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var users []User
+	if err := r.db.WithContext(ctx).
+		Where("banned_until IS NOT NULL OR not_green_until IS NOT NULL").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get restricted users: %w", err)
+	}
+
+	var next *time.Time
+	for _, user := range users {
+		for _, until := range []*time.Time{user.BannedUntil, user.NotGreenUntil} {
+			if until != nil && (next == nil || until.Before(*next)) {
+				next = until
+			}
+		}
+	}
+	return next, nil
+}
+
+func (r *SQLUsers) IncrementTimesPlayed(chatID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Update("times_played", gorm.Expr("times_played + ?", 1))
@@ -227,11 +371,11 @@ func IncrementTimesPlayed(chatID int64) error {
 	return nil
 }
 
-func DecrementTimesPlayed(chatID int64) error {
+func (r *SQLUsers) DecrementTimesPlayed(chatID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Where("times_played > ?", 0).
@@ -249,12 +393,12 @@ func DecrementTimesPlayed(chatID int64) error {
 }
 
 // GetAll returns all users
-func GetAll() ([]User, error) {
+func (r *SQLUsers) GetAll() ([]User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var users []User
-	result := Database.WithContext(ctx).Find(&users)
+	result := r.db.WithContext(ctx).Find(&users)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get all users: %w", result.Error)
 	}
@@ -262,12 +406,12 @@ func GetAll() ([]User, error) {
 	return users, nil
 }
 
-func GetUser(chatID int64) (User, error) {
+func (r *SQLUsers) GetUser(chatID int64) (User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var user User
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Select("state").
 		Where("chat_id = ?", chatID).
 		First(&user)
@@ -283,11 +427,11 @@ func GetUser(chatID int64) (User, error) {
 }
 
 // Delete removes a user by chat ID
-func Delete(chatID int64) error {
+func (r *SQLUsers) Delete(chatID int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	result := Database.WithContext(ctx).Where("chat_id = ?", chatID).Delete(&User{})
+	result := r.db.WithContext(ctx).Where("chat_id = ?", chatID).Delete(&User{})
 	if result.Error != nil {
 		return fmt.Errorf("failed to delete user: %w", result.Error)
 	}
@@ -306,17 +450,214 @@ func Stringify(u User) string {
 		builder.WriteString(fmt.Sprintf("ник: %s\n", u.SavedName))
 	}
 	if u.Lichess != nil && *u.Lichess != "" {
-		builder.WriteString(fmt.Sprintf("lichess: [%s](https://lichess.org/@/%s)\n", *u.Lichess, *u.Lichess))
+		builder.WriteString(fmt.Sprintf("lichess: [%s](https://lichess.org/@/%s)%s\n", *u.Lichess, *u.Lichess, verifiedMark(u.LichessVerified)))
 	}
 	if u.ChessCom != nil && *u.ChessCom != "" {
-		builder.WriteString(fmt.Sprintf("chess.com: [%s](https://www.chess.com/member/%s)\n", *u.ChessCom, *u.ChessCom))
+		builder.WriteString(fmt.Sprintf("chess.com: [%s](https://www.chess.com/member/%s)%s\n", *u.ChessCom, *u.ChessCom, verifiedMark(u.ChessComVerified)))
 	}
 
 	return builder.String()
 }
 
+func verifiedMark(verified bool) string {
+	if verified {
+		return " ✓"
+	}
+	return ""
+}
+
+// Verified reports whether the user verified their account on the site
+func (u User) Verified(site string) bool {
+	switch site {
+	case types.SiteLichess:
+		return u.LichessVerified
+	case types.SiteChesscom:
+		return u.ChessComVerified
+	}
+	return false
+}
+
+// AccountsVerified reports whether every linked rating site account is verified.
+// users without accounts have nothing to verify
+func AccountsVerified(u User) bool {
+	if u.Lichess != nil && *u.Lichess != "" && !u.LichessVerified {
+		return false
+	}
+	if u.ChessCom != nil && *u.ChessCom != "" && !u.ChessComVerified {
+		return false
+	}
+	return true
+}
+
+// FindUsers looks a user up by @username, chat id or saved name. exact matches win;
+// a saved name is then searched as a substring
+func (r *SQLUsers) FindUsers(query string) ([]User, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	var users []User
+	tx := r.db.WithContext(ctx)
+
+	if chatID, err := strconv.ParseInt(query, 10, 64); err == nil {
+		if err := tx.Where("chat_id = ?", chatID).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("failed to find users: %w", err)
+		}
+		return users, nil
+	}
+
+	if username, ok := strings.CutPrefix(query, "@"); ok {
+		if err := tx.Where("LOWER(username) = LOWER(?)", username).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("failed to find users: %w", err)
+		}
+		return users, nil
+	}
+
+	if err := tx.Where("LOWER(username) = LOWER(?) OR LOWER(saved_name) = LOWER(?)", query, query).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	if len(users) > 0 {
+		return users, nil
+	}
+
+	if err := tx.Where("LOWER(saved_name) LIKE LOWER(?)", "%"+query+"%").Limit(10).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	return users, nil
+}
+
+// SetAccount links the username on the site or unlinks it when username is empty.
+// verification of the old account is dropped either way
+func (r *SQLUsers) SetAccount(chatID int64, site, username string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var column string
+	switch site {
+	case types.SiteLichess:
+		column = "lichess"
+	case types.SiteChesscom:
+		column = "chesscom"
+	default:
+		return fmt.Errorf("unknown site: %s", site)
+	}
+
+	var value *string
+	if username != "" {
+		value = &username
+	}
+
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]interface{}{
+			column:               value,
+			column + "_verified": false,
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update %s: %w", column, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no user found with chat id: %d", chatID)
+	}
+
+	return nil
+}
+
+// FindAccountOwner returns another user who already linked the account.
+// usernames are compared without case because both sites ignore it
+func (r *SQLUsers) FindAccountOwner(site, username string, except int64) (User, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var column string
+	switch site {
+	case types.SiteLichess:
+		column = "lichess"
+	case types.SiteChesscom:
+		column = "chesscom"
+	default:
+		return User{}, false, fmt.Errorf("unknown site: %s", site)
+	}
+
+	var user User
+	result := r.db.WithContext(ctx).
+		Where("LOWER("+column+") = LOWER(?) AND chat_id <> ?", username, except).
+		First(&user)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return User{}, false, nil
+		}
+		return User{}, false, fmt.Errorf("failed to find account owner: %w", result.Error)
+	}
+
+	return user, true, nil
+}
+
+// SetVerificationToken stores the code the user has to put in their profile
+func (r *SQLUsers) SetVerificationToken(chatID int64, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Update("verification_token", token)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to set verification token: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no user found with chat id: %d", chatID)
+	}
+
+	return nil
+}
+
+// MarkVerified marks the account on the site as verified and uses up the token
+func (r *SQLUsers) MarkVerified(chatID int64, site string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var column string
+	switch site {
+	case types.SiteLichess:
+		column = "lichess_verified"
+	case types.SiteChesscom:
+		column = "chesscom_verified"
+	default:
+		return fmt.Errorf("unknown site: %s", site)
+	}
+
+	result := r.db.WithContext(ctx).
+		Model(&User{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]interface{}{
+			column:               true,
+			"verification_token": "",
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark account verified: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no user found with chat id: %d", chatID)
+	}
+
+	return nil
+}
+
 // UpdateLichessAndState updates lichess username and state in one transaction
-func UpdateLichessAndState(chatID int64, lichess string, newState State) error {
+func (r *SQLUsers) UpdateLichessAndState(chatID int64, lichess string, newState State) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -324,12 +665,13 @@ func UpdateLichessAndState(chatID int64, lichess string, newState State) error {
 		return fmt.Errorf("update lichess with ''")
 	}
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Updates(map[string]interface{}{
-			"lichess": &lichess,
-			"state":   newState,
+			"lichess":          &lichess,
+			"lichess_verified": false,
+			"state":            newState,
 		})
 
 	if result.Error != nil {
@@ -344,7 +686,7 @@ func UpdateLichessAndState(chatID int64, lichess string, newState State) error {
 }
 
 // UpdateChessComAndState updates chess.com username and state in one transaction
-func UpdateChessComAndState(chatID int64, chessCom string, newState State) error {
+func (r *SQLUsers) UpdateChessComAndState(chatID int64, chessCom string, newState State) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -352,12 +694,13 @@ func UpdateChessComAndState(chatID int64, chessCom string, newState State) error
 		return fmt.Errorf("update chesscom with ''")
 	}
 
-	result := Database.WithContext(ctx).
+	result := r.db.WithContext(ctx).
 		Model(&User{}).
 		Where("chat_id = ?", chatID).
 		Updates(map[string]interface{}{
-			"chesscom": &chessCom,
-			"state":    newState,
+			"chesscom":          &chessCom,
+			"chesscom_verified": false,
+			"state":             newState,
 		})
 
 	if result.Error != nil {
@@ -372,7 +715,7 @@ func UpdateChessComAndState(chatID int64, chessCom string, newState State) error
 }
 
 // GetOrCreateUser combines getting and creating user in one operation
-func GetOrCreateUser(update tgbotapi.Update) (User, bool, error) {
+func (r *SQLUsers) GetOrCreateUser(update tgbotapi.Update) (User, bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -386,7 +729,7 @@ func GetOrCreateUser(update tgbotapi.Update) (User, bool, error) {
 		TgName:   tgName,
 	}
 
-	result := Database.WithContext(ctx).Where(User{ChatID: message.Chat.ID}).FirstOrCreate(&user)
+	result := r.db.WithContext(ctx).Where(User{ChatID: message.Chat.ID}).FirstOrCreate(&user)
 	if result.Error != nil {
 		return User{}, false, fmt.Errorf("failed to get/create user: %w", result.Error)
 	}
@@ -399,12 +742,12 @@ func GetOrCreateUser(update tgbotapi.Update) (User, bool, error) {
 	return user, isNew, nil
 }
 
-func TestTransliteration() error {
+func (r *SQLUsers) TestTransliteration() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var users []User
-	result := Database.WithContext(ctx).Find(&users)
+	result := r.db.WithContext(ctx).Find(&users)
 	if result.Error != nil {
 		return fmt.Errorf("failed to get users: %w", result.Error)
 	}
@@ -434,12 +777,12 @@ type TransliteratedUser struct {
 	NewName string
 }
 
-func TransliterateAllSavedNames() ([]TransliteratedUser, error) {
+func (r *SQLUsers) TransliterateAllSavedNames() ([]TransliteratedUser, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	var users []User
-	result := Database.WithContext(ctx).Find(&users)
+	result := r.db.WithContext(ctx).Find(&users)
 	if result.Error != nil {
 		return nil, fmt.Errorf("failed to get users: %w", result.Error)
 	}
@@ -455,7 +798,7 @@ func TransliterateAllSavedNames() ([]TransliteratedUser, error) {
 
 		transliterated := utils.Transliterate(user.SavedName)
 		if user.SavedName != transliterated {
-			updateResult := Database.WithContext(ctx).
+			updateResult := r.db.WithContext(ctx).
 				Model(&User{}).
 				Where("chat_id = ?", user.ChatID).
 				Update("saved_name", transliterated)
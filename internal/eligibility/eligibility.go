@@ -0,0 +1,184 @@
+package eligibility
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/jobs"
+	"github.com/sukalov/mshkbot/internal/restrictions"
+	"github.com/sukalov/mshkbot/internal/types"
+	"github.com/sukalov/mshkbot/internal/waitlist"
+)
+
+// Verdict is the outcome of an eligibility check
+type Verdict struct {
+	Allowed bool
+	Reason  string
+}
+
+func allowed() Verdict {
+	return Verdict{Allowed: true}
+}
+
+func denied(reason string) Verdict {
+	return Verdict{Allowed: false, Reason: reason}
+}
+
+// IsGreenTournament reports whether the tournament is limited to beginners
+func IsGreenTournament(metadata types.TournamentMetadata) bool {
+	return (metadata.LichessRatingLimit > 0 && metadata.LichessRatingLimit <= 1600) ||
+		(metadata.ChesscomRatingLimit > 0 && metadata.ChesscomRatingLimit <= 1400)
+}
+
+// IsBanned reports whether the user has an active ban at the given moment
+func IsBanned(user db.User, now time.Time) bool {
+	return user.BannedUntil != nil && now.Before(*user.BannedUntil)
+}
+
+// Check decides whether the user may register for the tournament.
+// restrictions that already ended are lifted on the way, see AnnounceLifted
+func Check(b *bot.Bot, user db.User, metadata types.TournamentMetadata) (Verdict, error) {
+	now := time.Now().UTC()
+
+	if err := clearExpired(b, &user, now); err != nil {
+		return Verdict{}, err
+	}
+
+	if IsBanned(user, now) {
+		return denied(BanMessage(*user.BannedUntil, user.BanReason)), nil
+	}
+
+	if IsGreenTournament(metadata) && user.NotGreenUntil != nil && now.Before(*user.NotGreenUntil) {
+		return denied(withReason("вам нельзя в этом турнире играть", user.NotGreenReason)), nil
+	}
+
+	if metadata.RequireVerified && !db.AccountsVerified(user) {
+		return denied("в этом турнире нужно подтвердить аккаунты на личесе и чесскоме. напишите боту /verify в личку"), nil
+	}
+
+	// players without rated club games are judged by their online peaks only
+	if clubRating, rated := db.ClubRating(user); rated && metadata.ClubRatingLimit > 0 && clubRating >= metadata.ClubRatingLimit {
+		return denied("ваш клубный рейтинг превышает лимит турнира"), nil
+	}
+
+	return allowed(), nil
+}
+
+// BanMessage tells the player why they are banned and when the ban ends
+func BanMessage(until time.Time, reason string) string {
+	return withReason("вы забанены "+untilText(until), reason)
+}
+
+// SuspensionMessage tells the player why they may not play green tournaments and for how long
+func SuspensionMessage(until time.Time, reason string) string {
+	return withReason("вы отстранены от зелёных турниров "+untilText(until), reason)
+}
+
+func withReason(text, reason string) string {
+	if reason == "" {
+		return text
+	}
+	return text + ". причина: " + reason
+}
+
+func untilText(until time.Time) string {
+	return restrictions.Describe(until, time.Now(), time.FixedZone("moscow", 3*60*60))
+}
+
+// clearExpired lifts the restrictions of the user that ended before the expiry job got to them
+func clearExpired(b *bot.Bot, user *db.User, now time.Time) error {
+	expired := (user.BannedUntil != nil && !now.Before(*user.BannedUntil)) ||
+		(user.NotGreenUntil != nil && !now.Before(*user.NotGreenUntil))
+	if !expired {
+		return nil
+	}
+
+	lifted, err := b.Users.LiftExpiredRestrictionsOf(user.ChatID, now)
+	if err != nil {
+		return fmt.Errorf("failed to lift expired restrictions: %w", err)
+	}
+	AnnounceLifted(b, lifted)
+
+	for _, r := range lifted {
+		switch r.Kind {
+		case db.RestrictionBan:
+			user.BannedUntil = nil
+		case db.RestrictionGreen:
+			user.NotGreenUntil = nil
+		}
+	}
+	return nil
+}
+
+// AnnounceLifted records restrictions that ran out in the audit log and tells the users
+func AnnounceLifted(b *bot.Bot, lifted []db.LiftedRestriction) {
+	for _, r := range lifted {
+		action, notice := "user.ban_expired", "ваш бан закончился, снова можно записываться на турниры"
+		if r.Kind == db.RestrictionGreen {
+			action, notice = "user.green_suspension_expired", "ваше отстранение от зелёных турниров закончилось"
+		}
+		log.Printf("%s for user %d", action, r.User.ChatID)
+
+		before := r.Until.UTC().Format(time.RFC3339)
+		if r.Reason != "" {
+			before += ", причина: " + r.Reason
+		}
+		b.Audit(db.AuditEvent{Action: action, TargetID: r.User.ChatID, Target: r.User.SavedName, Before: before})
+		if err := b.SendMessage(r.User.ChatID, notice); err != nil {
+			log.Printf("failed to tell user %d their restriction ended: %v", r.User.ChatID, err)
+		}
+	}
+}
+
+// EnforceBan removes a freshly banned user from every open tournament,
+// gives their spots to the queue and refreshes the announcements.
+// returns true if the user was in any list
+func EnforceBan(b *bot.Bot, chatID int64) (bool, error) {
+	ctx := context.Background()
+	playerID := int(chatID)
+	removed := false
+
+	for _, tournamentID := range b.Tournament.TournamentsOf(playerID) {
+		t, exists := b.Tournament.Get(tournamentID)
+		if !exists {
+			continue
+		}
+		player, _ := t.GetPlayer(playerID)
+
+		if err := b.Tournament.RemovePlayer(ctx, tournamentID, playerID); err != nil {
+			return removed, fmt.Errorf("failed to remove banned player: %w", err)
+		}
+		removed = true
+		log.Printf("removed banned player %d (%s) from tournament %s", playerID, player.Username, tournamentID)
+
+		if player.State == types.StateInTournament || player.State == types.StatePending {
+			waitlist.Promote(b, tournamentID)
+		}
+
+		if err := b.UpdateAnnouncementMessage(tournamentID); err != nil {
+			log.Printf("failed to update announcement message: %v", err)
+		}
+	}
+
+	return removed, nil
+}
+
+// restrictionExpiryJob is the id of the single job that lifts the next restriction to run out
+const restrictionExpiryJob = "restriction_expiry"
+
+// ScheduleRestrictionExpiry moves the restriction expiry job to when the earliest ban or green
+// suspension ends. call it after a restriction was set or lifted
+func ScheduleRestrictionExpiry(b *bot.Bot) error {
+	next, err := b.Users.NextRestrictionEnd()
+	if err != nil {
+		return err
+	}
+	if next == nil || restrictions.IsForever(*next, time.Now()) {
+		return b.Jobs.Cancel(restrictionExpiryJob)
+	}
+	return b.Jobs.Schedule(jobs.Job{ID: restrictionExpiryJob, Kind: jobs.KindRestrictionExpiry, RunAt: *next})
+}
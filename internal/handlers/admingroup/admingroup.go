@@ -4,12 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sukalov/mshkbot/internal/bot"
 	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/tournament"
 	"github.com/sukalov/mshkbot/internal/types"
 	"github.com/sukalov/mshkbot/internal/utils"
 )
@@ -23,6 +25,17 @@ func GetHandlers() bot.HandlerSet {
 			"tournament_json":      handleTournamentJSON,
 			"create_tournament":    handleCreateTournament,
 			"remove_tournament":    handleRemoveTournament,
+			"schedule":             handleSchedule,
+			"confirmation":         handleConfirmation,
+			"peaks":                handlePeaks,
+			"rejoin":               handleRejoin,
+			"verification":         handleVerification,
+			"suspects":             handleSuspects,
+			"user":                 handleUser,
+			"audit":                handleAudit,
+			"jobs":                 handleJobs,
+			"start_round":          handleStartRound,
+			"set_result":           handleSetResult,
 			"suspend_from_green":   handleSuspendFromGreen,
 			"ban_player":           handleBanPlayer,
 			"unban_player":         handleUnbanPlayer,
@@ -36,12 +49,14 @@ func GetHandlers() bot.HandlerSet {
 		Callbacks: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
 			"suspend_duration": handleSuspendDuration,
 			"ban_duration":     handleBanDuration,
+			"user":             handleUserCallback,
+			"target":           handleTargetCallback,
 		},
 	}
 }
 
 func handleHelp(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.Message.Chat.ID, "команды администратора:\n\n/tournament - показать состояние турнира\n\n/suspend_from_green - отстранить пользователя от зелёных турниров\n\n/admit_to_green - допустить пользователя к зелёным турнирам\n\n/ban_player - забанить пользователя\n\n/unban_player - разбанить пользователя")
+	return b.SendMessage(update.Message.Chat.ID, "команды администратора:\n\n/tournament - показать все открытые турниры\n\n/create_tournament <id> - создать турнир\n\n/remove_tournament <id> - удалить турнир\n\n/schedule - еженедельное расписание турниров\n\n/confirmation <минуты> <id> - сколько времени даётся на подтверждение места из очереди\n\n/peaks [peaks=blitz+rapid] [provisional=yes|no] [months=12] <id> - какие пиковые рейтинги сравниваются с лимитами\n\n/rejoin [cooldown=15] [rejoin=yes|no] [place=back|keep] [checkouts=2] <id> - можно ли и когда вернуться в турнир после выхода\n\n/verification <on|off> <id> - пускать только игроков с подтверждёнными аккаунтами\n\n/start_round <id> [swiss|robin] - составить пары следующего тура и отправить их в чат\n\n/set_result <тур> <доска> <1-0|½-½|0-1> <id> - внести или исправить результат\n\n/suspects - пользователи с похожими никами, общими аккаунтами или совпадающей историей рейтинга\n\n/user <@username | id | ник> - карточка пользователя с историей турниров и кнопками для правки\n\n/audit [user=…] [action=…] [date=дд.мм.гггг] - журнал действий администраторов\n\n/jobs - отложенные задачи: уборка вышедших, сроки подтверждения, напоминания, снятие банов\n\n/suspend_from_green - отстранить пользователя от зелёных турниров\n\n/admit_to_green - допустить пользователя к зелёным турнирам\n\n/ban_player - забанить пользователя\n\n/unban_player - разбанить пользователя")
 }
 
 func handleTournamentJSON(b *bot.Bot, update tgbotapi.Update) error {
@@ -53,33 +68,44 @@ func handleTournamentJSON(b *bot.Bot, update tgbotapi.Update) error {
 }
 
 func handleTournament(b *bot.Bot, update tgbotapi.Update) error {
-	if !b.Tournament.Metadata.Exists {
+	open := b.Tournament.Open()
+	if len(open) == 0 {
 		return b.SendMessage(update.Message.Chat.ID, "турнир не создан")
 	}
 
-	message := buildTournamentMessageForAdmin(b)
-	return b.SendMessageWithMarkdown(update.Message.Chat.ID, message, true)
+	messages := make([]string, 0, len(open))
+	for _, t := range open {
+		messages = append(messages, buildTournamentMessageForAdmin(t))
+	}
+	return b.SendMessageWithMarkdown(update.Message.Chat.ID, strings.Join(messages, "\n\n"), true)
 }
 
-func buildTournamentMessageForAdmin(b *bot.Bot) string {
-	message := "участники:\n"
+func buildTournamentMessageForAdmin(t tournament.Tournament) string {
+	message := fmt.Sprintf("*%s* (`%s`), лимит %d", t.DisplayName(), t.Metadata.ID, t.Metadata.Limit)
+	if t.Metadata.ConfirmationMinutes > 0 {
+		message += fmt.Sprintf(", подтверждение %d мин", t.Metadata.ConfirmationMinutes)
+	}
+	if t.Metadata.LichessRatingLimit > 0 || t.Metadata.ChesscomRatingLimit > 0 {
+		message += fmt.Sprintf(", пики: %s", t.Metadata.PeakPolicy)
+	}
+	if t.Metadata.RejoinPolicy.Spec() != "" {
+		message += fmt.Sprintf(", %s", t.Metadata.RejoinPolicy)
+	}
+	if t.Metadata.RequireVerified {
+		message += ", только подтверждённые аккаунты"
+	}
+	message += "\nучастники:\n"
 
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
 	count := 1
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateInTournament {
-			playerLine := fmt.Sprintf("%d. [%s](tg://user?id=%d)", count, player.SavedName, player.ID)
-			if player.PeakRating != nil {
-				var siteURL string
-				switch player.PeakRating.Site {
-				case types.SiteLichess:
-					siteURL = fmt.Sprintf("https://lichess.org/@/%s", player.PeakRating.SiteUsername)
-					playerLine += fmt.Sprintf(" ([%s](%s) %d)", player.PeakRating.Site, siteURL, player.PeakRating.BlitzPeak)
-				case types.SiteChesscom:
-					siteURL = fmt.Sprintf("https://www.chess.com/member/%s", player.PeakRating.SiteUsername)
-					playerLine += fmt.Sprintf(" ([%s](%s) %d)", player.PeakRating.Site, siteURL, player.PeakRating.BlitzPeak)
-				}
-			}
-			message += playerLine + "\n"
+	for _, player := range t.List {
+		switch player.State {
+		case types.StateInTournament:
+			message += fmt.Sprintf("%d. [%s](tg://user?id=%d)", count, player.SavedName, player.ID) + peakRatingSuffix(player) + "\n"
+			count++
+		case types.StatePending:
+			message += fmt.Sprintf("%d. [%s](tg://user?id=%d)", count, player.SavedName, player.ID) + peakRatingSuffix(player) +
+				fmt.Sprintf(" — ждём подтверждения до %s\n", player.ConfirmBy.In(moscowTZ).Format("15:04"))
 			count++
 		}
 	}
@@ -89,7 +115,7 @@ func buildTournamentMessageForAdmin(b *bot.Bot) string {
 	}
 
 	queuedPlayers := []types.Player{}
-	for _, player := range b.Tournament.List {
+	for _, player := range t.List {
 		if player.State == types.StateQueued {
 			queuedPlayers = append(queuedPlayers, player)
 		}
@@ -98,158 +124,312 @@ func buildTournamentMessageForAdmin(b *bot.Bot) string {
 	if len(queuedPlayers) > 0 {
 		message += "\nочередь:\n"
 		for i, player := range queuedPlayers {
-			playerLine := fmt.Sprintf("%d. [%s](tg://user?id=%d)", i+1, player.SavedName, player.ID)
-			if player.PeakRating != nil {
-				var siteURL string
-				switch player.PeakRating.Site {
-				case types.SiteLichess:
-					siteURL = fmt.Sprintf("https://lichess.org/@/%s", player.PeakRating.SiteUsername)
-					playerLine += fmt.Sprintf(" ([%s](%s) %d)", player.PeakRating.Site, siteURL, player.PeakRating.BlitzPeak)
-				case types.SiteChesscom:
-					siteURL = fmt.Sprintf("https://www.chess.com/member/%s", player.PeakRating.SiteUsername)
-					playerLine += fmt.Sprintf(" ([%s](%s) %d)", player.PeakRating.Site, siteURL, player.PeakRating.BlitzPeak)
-				}
-			}
-			message += playerLine + "\n"
+			message += fmt.Sprintf("%d. [%s](tg://user?id=%d)", i+1, player.SavedName, player.ID) + peakRatingSuffix(player) + "\n"
 		}
 	}
 
 	return message
 }
 
+// peakRatingSuffix lists the peaks of every linked account so arbiters can compare the sites
+func peakRatingSuffix(player types.Player) string {
+	var parts []string
+	for _, peak := range player.AllPeakRatings() {
+		var siteURL string
+		switch peak.Site {
+		case types.SiteLichess:
+			siteURL = fmt.Sprintf("https://lichess.org/@/%s", peak.SiteUsername)
+		case types.SiteChesscom:
+			siteURL = fmt.Sprintf("https://www.chess.com/member/%s", peak.SiteUsername)
+		default:
+			continue
+		}
+		// snapshots from older versions only know the blitz peak
+		summary := fmt.Sprintf("%d", peak.BlitzPeak)
+		if peak.Peaks != nil {
+			summary = peak.Peaks.String()
+		}
+		parts = append(parts, fmt.Sprintf("[%s](%s) %s", peak.Site, siteURL, summary))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(parts, "; "))
+}
+
+// resolveTournament picks the tournament an admin command refers to.
+// with no argument it only succeeds when exactly one tournament is open
+func resolveTournament(b *bot.Bot, update tgbotapi.Update) (tournament.Tournament, error) {
+	return findTournament(b, update.Message.CommandArguments())
+}
+
+func findTournament(b *bot.Bot, query string) (tournament.Tournament, error) {
+	open := b.Tournament.Open()
+	if len(open) == 0 {
+		return tournament.Tournament{}, fmt.Errorf("нет открытых турниров")
+	}
+
+	if query != "" {
+		t, exists := b.Tournament.Find(query)
+		if !exists {
+			return tournament.Tournament{}, fmt.Errorf("турнир %s не найден", query)
+		}
+		return t, nil
+	}
+
+	if len(open) == 1 {
+		return open[0], nil
+	}
+
+	ids := make([]string, 0, len(open))
+	for _, t := range open {
+		ids = append(ids, t.Metadata.ID)
+	}
+	return tournament.Tournament{}, fmt.Errorf("открыто несколько турниров, укажите id: %s", strings.Join(ids, ", "))
+}
+
 func handleCreateTournament(b *bot.Bot, update tgbotapi.Update) error {
 	ctx := context.Background()
-	if b.Tournament.Metadata.Exists {
+
+	tournamentID := strings.ToLower(strings.TrimSpace(update.Message.CommandArguments()))
+	if tournamentID == "" {
+		tournamentID = "manual"
+	}
+	if err := tournament.ValidateID(tournamentID); err != nil {
+		return b.SendMessage(update.Message.Chat.ID, "id турнира может содержать только латиницу, цифры, - и _")
+	}
+	if _, exists := b.Tournament.Get(tournamentID); exists {
 		return b.SendMessage(update.Message.Chat.ID, "турнир уже создан")
 	}
-	if err := b.Tournament.CreateTournament(ctx, 26, 0, 0, "ТУРНИР НАЧАЛСЯ!!!"); err != nil {
+
+	metadata := types.TournamentMetadata{
+		ID:                tournamentID,
+		Name:              tournamentID,
+		Limit:             26,
+		AnnouncementIntro: "ТУРНИР НАЧАЛСЯ!!!",
+	}
+	if err := b.Tournament.CreateTournament(ctx, metadata); err != nil {
 		return err
 	}
+	b.Audit(db.AuditEvent{ActorID: update.Message.From.ID, Action: "tournament.create", Target: tournamentID})
 	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
 }
 
 func handleRemoveTournament(b *bot.Bot, update tgbotapi.Update) error {
 	ctx := context.Background()
-	if !b.Tournament.Metadata.Exists {
+	if len(b.Tournament.Open()) == 0 {
 		return b.SendMessage(update.Message.Chat.ID, "его и так нет")
 	}
-	announcementMessageID := b.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID != 0 {
-		if err := b.UnpinMessage(b.GetMainGroupID(), announcementMessageID); err != nil {
-			log.Printf("failed to unpin message: %v", err)
-		}
+	t, err := resolveTournament(b, update)
+	if err != nil {
+		return b.SendMessage(update.Message.Chat.ID, err.Error())
+	}
+	// the history must be saved before the tournament goes away
+	if _, err := db.ArchiveTournament(t.Metadata, t.AllPlayers(), t.Rounds, time.Now()); err != nil {
+		log.Printf("failed to archive tournament %s: %v", t.Metadata.ID, err)
+		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("не получилось сохранить турнир %s в историю, он остался открытым: %v", t.Metadata.ID, err))
 	}
-	if err := b.Tournament.RemoveTournament(ctx); err != nil {
+	if err := b.Tournament.RemoveTournament(ctx, t.Metadata.ID); err != nil {
 		return err
 	}
+	for _, messageID := range []int{t.Metadata.AnnouncementMessageID, t.Metadata.StandingsMessageID} {
+		if messageID == 0 {
+			continue
+		}
+		if err := b.UnpinMessage(b.GetMainGroupID(), messageID); err != nil {
+			log.Printf("failed to unpin message: %v", err)
+		}
+	}
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "tournament.remove",
+		Target:  t.Metadata.ID,
+		Before:  fmt.Sprintf("игроков: %d", len(t.AllPlayers())),
+	})
 	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
 }
 
-func handleAdminMessage(b *bot.Bot, update tgbotapi.Update) error {
-	if update.Message == nil {
-		return nil
+// handleConfirmation sets how many minutes a player promoted from the queue has to confirm
+func handleConfirmation(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	minutesArg, query, _ := strings.Cut(strings.TrimSpace(update.Message.CommandArguments()), " ")
+
+	minutes, err := strconv.Atoi(minutesArg)
+	if err != nil || minutes < 0 {
+		return b.SendMessage(chatID, "использование: /confirmation <минуты> [id турнира]\n0 — без подтверждения")
 	}
 
-	adminChatID := update.Message.From.ID
+	t, err := findTournament(b, strings.TrimSpace(query))
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
 
-	process, exists := b.GetAdminProcess(adminChatID)
-	if !exists {
-		log.Printf("admin group message: %s", update.Message.Text)
-		return nil
+	if err := b.Tournament.SetConfirmationMinutes(context.Background(), t.Metadata.ID, minutes); err != nil {
+		return err
 	}
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "tournament.confirmation",
+		Target:  t.Metadata.ID,
+		Before:  strconv.Itoa(t.Metadata.ConfirmationMinutes),
+		After:   strconv.Itoa(minutes),
+	})
+	return b.GiveReaction(chatID, update.Message.MessageID, utils.ApproveEmoji())
+}
 
-	username := strings.TrimPrefix(strings.TrimSpace(update.Message.Text), "@")
-	if username == "" {
-		b.ClearAdminProcess(adminChatID)
-		return b.SendMessage(update.Message.Chat.ID, "юзернейм не может быть пустым")
+// handlePeaks shows or changes which peak ratings are compared with the rating limits.
+// fields that are not mentioned keep their values
+func handlePeaks(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	var fields []string
+	var query string
+	for _, token := range strings.Fields(update.Message.CommandArguments()) {
+		if strings.Contains(token, "=") {
+			fields = append(fields, token)
+		} else {
+			query = token
+		}
 	}
 
-	user, err := db.GetByUsername(username)
+	t, err := findTournament(b, query)
 	if err != nil {
-		b.ClearAdminProcess(adminChatID)
-		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь с юзернеймом %s не найден", username))
+		return b.SendMessage(chatID, err.Error())
 	}
 
-	var until *time.Time
-	now := time.Now().UTC()
+	if len(fields) == 0 {
+		return b.SendMessage(chatID, fmt.Sprintf("пики турнира %s: %s", t.Metadata.ID, t.Metadata.PeakPolicy))
+	}
 
-	switch process.Type {
-	case bot.ProcessTypeSuspension:
-		switch process.Duration {
-		case "month":
-			t := now.AddDate(0, 1, 0)
-			until = &t
-		case "forever":
-			t := now.AddDate(100, 0, 0)
-			until = &t
-		default:
-			b.ClearAdminProcess(adminChatID)
-			return b.SendMessage(update.Message.Chat.ID, "неизвестная длительность")
+	policy := t.Metadata.PeakPolicy
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		ok, err := policy.Set(key, value)
+		if err != nil {
+			return b.SendMessage(chatID, err.Error())
 		}
-
-		if err := db.SetNotGreenUntil(user.ChatID, until); err != nil {
-			b.ClearAdminProcess(adminChatID)
-			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
+		if !ok {
+			return b.SendMessage(chatID, fmt.Sprintf("неизвестное поле %q, есть peaks, provisional и months", key))
 		}
+	}
 
-		b.ClearAdminProcess(adminChatID)
-
-		durationText := "навсегда"
-		if process.Duration == "month" {
-			durationText = "на месяц"
-		}
+	if err := b.Tournament.SetPeakPolicy(context.Background(), t.Metadata.ID, policy); err != nil {
+		return err
+	}
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "tournament.peaks",
+		Target:  t.Metadata.ID,
+		Before:  t.Metadata.PeakPolicy.String(),
+		After:   policy.String(),
+	})
+	return b.SendMessage(chatID, fmt.Sprintf("пики турнира %s: %s", t.Metadata.ID, policy))
+}
 
-		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s отстранён от зелёных %s", username, durationText))
+// handleRejoin shows or changes whether and when players who checked out may come back.
+// fields that are not mentioned keep their values
+func handleRejoin(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
 
-	case bot.ProcessTypeBan:
-		switch process.Duration {
-		case "month":
-			t := now.AddDate(0, 1, 0)
-			until = &t
-		case "forever":
-			t := now.AddDate(100, 0, 0)
-			until = &t
-		default:
-			b.ClearAdminProcess(adminChatID)
-			return b.SendMessage(update.Message.Chat.ID, "неизвестная длительность")
+	var fields []string
+	var query string
+	for _, token := range strings.Fields(update.Message.CommandArguments()) {
+		if strings.Contains(token, "=") {
+			fields = append(fields, token)
+		} else {
+			query = token
 		}
+	}
 
-		if err := db.SetBannedUntil(user.ChatID, until); err != nil {
-			b.ClearAdminProcess(adminChatID)
-			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
-		}
+	t, err := findTournament(b, query)
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
 
-		b.ClearAdminProcess(adminChatID)
+	if len(fields) == 0 {
+		return b.SendMessage(chatID, fmt.Sprintf("возврат в турнир %s: %s", t.Metadata.ID, t.Metadata.RejoinPolicy))
+	}
 
-		durationText := "навсегда"
-		if process.Duration == "month" {
-			durationText = "на месяц"
+	policy := t.Metadata.RejoinPolicy
+	for _, field := range fields {
+		key, value, _ := strings.Cut(field, "=")
+		ok, err := policy.Set(key, value)
+		if err != nil {
+			return b.SendMessage(chatID, err.Error())
+		}
+		if !ok {
+			return b.SendMessage(chatID, fmt.Sprintf("неизвестное поле %q, есть cooldown, rejoin, place и checkouts", key))
 		}
+	}
 
-		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s забанен %s", username, durationText))
+	if err := b.Tournament.SetRejoinPolicy(context.Background(), t.Metadata.ID, policy); err != nil {
+		return err
+	}
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "tournament.rejoin",
+		Target:  t.Metadata.ID,
+		Before:  t.Metadata.RejoinPolicy.String(),
+		After:   policy.String(),
+	})
+	return b.SendMessage(chatID, fmt.Sprintf("возврат в турнир %s: %s", t.Metadata.ID, policy))
+}
 
-	case bot.ProcessTypeUnban:
-		if err := db.SetBannedUntil(user.ChatID, nil); err != nil {
-			b.ClearAdminProcess(adminChatID)
-			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
-		}
+// handleVerification turns the verified accounts requirement of a tournament on or off.
+// players already in the list stay there
+func handleVerification(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	mode, query, _ := strings.Cut(strings.TrimSpace(update.Message.CommandArguments()), " ")
+
+	var required bool
+	switch strings.ToLower(mode) {
+	case "on":
+		required = true
+	case "off":
+		required = false
+	default:
+		return b.SendMessage(chatID, "использование: /verification <on|off> [id турнира]")
+	}
 
-		b.ClearAdminProcess(adminChatID)
+	t, err := findTournament(b, strings.TrimSpace(query))
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
 
-		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s разбанен", username))
+	if err := b.Tournament.SetRequireVerified(context.Background(), t.Metadata.ID, required); err != nil {
+		return err
+	}
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "tournament.verification",
+		Target:  t.Metadata.ID,
+		Before:  strconv.FormatBool(t.Metadata.RequireVerified),
+		After:   strconv.FormatBool(required),
+	})
+	return b.GiveReaction(chatID, update.Message.MessageID, utils.ApproveEmoji())
+}
 
-	case bot.ProcessTypeAdmitToGreen:
-		if err := db.SetNotGreenUntil(user.ChatID, nil); err != nil {
-			b.ClearAdminProcess(adminChatID)
-			return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
-		}
+func handleAdminMessage(b *bot.Bot, update tgbotapi.Update) error {
+	if update.Message == nil {
+		return nil
+	}
 
-		b.ClearAdminProcess(adminChatID)
+	process, exists := b.GetAdminProcess(update.Message.Chat.ID, update.Message.From.ID)
+	if !exists {
+		log.Printf("admin group message: %s", update.Message.Text)
+		return nil
+	}
 
-		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("пользователь %s допущен к зелёным турнирам", username))
+	switch process.Type {
+	case bot.ProcessTypeEditUser:
+		return applyUserEdit(b, update, process)
+	case bot.ProcessTypeBan, bot.ProcessTypeSuspension:
+		if process.Duration == "" || process.TargetID != 0 {
+			return restrictionStep(b, update, process)
+		}
 	}
 
-	return nil
+	return targetStep(b, update, process)
 }
 
 func handleSuspendFromGreen(b *bot.Bot, update tgbotapi.Update) error {
@@ -257,6 +437,7 @@ func handleSuspendFromGreen(b *bot.Bot, update tgbotapi.Update) error {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("месяц", "suspend_duration:month"),
 			tgbotapi.NewInlineKeyboardButtonData("навсегда", "suspend_duration:forever"),
+			tgbotapi.NewInlineKeyboardButtonData("другой срок", "suspend_duration:custom"),
 			tgbotapi.NewInlineKeyboardButtonData("отмена", "suspend_duration:cancel"),
 		),
 	)
@@ -264,7 +445,7 @@ func handleSuspendFromGreen(b *bot.Bot, update tgbotapi.Update) error {
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "выберите длительность отстранения:")
 	msg.ReplyMarkup = keyboard
 
-	_, err := b.Client.Send(msg)
+	_, err := b.Send(msg)
 	return err
 }
 
@@ -285,16 +466,26 @@ func handleSuspendDuration(b *bot.Bot, update tgbotapi.Update) error {
 	duration := parts[1]
 
 	if duration == "cancel" {
-		b.ClearAdminProcess(adminChatID)
+		b.ClearAdminProcess(update.CallbackQuery.Message.Chat.ID, adminChatID)
 		if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "отменено"); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
 		return nil
 	}
 
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeSuspension, duration)
-
-	if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "введите telegram username пользователя:"); err != nil {
+	prompt := targetPrompt
+	if duration == "custom" {
+		duration, prompt = "", durationPrompt
+	}
+	b.StartAdminProcess(bot.AdminProcess{
+		Type:            bot.ProcessTypeSuspension,
+		ChatID:          update.CallbackQuery.Message.Chat.ID,
+		AdminID:         adminChatID,
+		Duration:        duration,
+		PromptMessageID: update.CallbackQuery.Message.MessageID,
+	})
+
+	if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, prompt); err != nil {
 		return fmt.Errorf("failed to edit message: %w", err)
 	}
 
@@ -306,6 +497,7 @@ func handleBanPlayer(b *bot.Bot, update tgbotapi.Update) error {
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("месяц", "ban_duration:month"),
 			tgbotapi.NewInlineKeyboardButtonData("навсегда", "ban_duration:forever"),
+			tgbotapi.NewInlineKeyboardButtonData("другой срок", "ban_duration:custom"),
 			tgbotapi.NewInlineKeyboardButtonData("отмена", "ban_duration:cancel"),
 		),
 	)
@@ -313,7 +505,7 @@ func handleBanPlayer(b *bot.Bot, update tgbotapi.Update) error {
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, "выберите длительность бана:")
 	msg.ReplyMarkup = keyboard
 
-	_, err := b.Client.Send(msg)
+	_, err := b.Send(msg)
 	return err
 }
 
@@ -334,16 +526,26 @@ func handleBanDuration(b *bot.Bot, update tgbotapi.Update) error {
 	duration := parts[1]
 
 	if duration == "cancel" {
-		b.ClearAdminProcess(adminChatID)
+		b.ClearAdminProcess(update.CallbackQuery.Message.Chat.ID, adminChatID)
 		if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "отменено"); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
 		return nil
 	}
 
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeBan, duration)
-
-	if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, "введите telegram username пользователя:"); err != nil {
+	prompt := targetPrompt
+	if duration == "custom" {
+		duration, prompt = "", durationPrompt
+	}
+	b.StartAdminProcess(bot.AdminProcess{
+		Type:            bot.ProcessTypeBan,
+		ChatID:          update.CallbackQuery.Message.Chat.ID,
+		AdminID:         adminChatID,
+		Duration:        duration,
+		PromptMessageID: update.CallbackQuery.Message.MessageID,
+	})
+
+	if err := b.EditMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.MessageID, prompt); err != nil {
 		return fmt.Errorf("failed to edit message: %w", err)
 	}
 
@@ -351,19 +553,19 @@ func handleBanDuration(b *bot.Bot, update tgbotapi.Update) error {
 }
 
 func handleUnbanPlayer(b *bot.Bot, update tgbotapi.Update) error {
-	adminChatID := update.Message.From.ID
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeUnban, "")
-	return b.SendMessage(update.Message.Chat.ID, "введите telegram username пользователя для разбана:")
+	chatID, adminChatID := update.Message.Chat.ID, update.Message.From.ID
+	b.StartAdminProcess(bot.AdminProcess{Type: bot.ProcessTypeUnban, ChatID: chatID, AdminID: adminChatID})
+	return b.PromptAdmin(chatID, adminChatID, "кого разбанить? "+targetPrompt)
 }
 
 func handleAdmitToGreen(b *bot.Bot, update tgbotapi.Update) error {
-	adminChatID := update.Message.From.ID
-	b.SetAdminProcess(adminChatID, bot.ProcessTypeAdmitToGreen, "")
-	return b.SendMessage(update.Message.Chat.ID, "учтите, игрок всё равно может не пройти по рейтингу. эта команда просто снимет внутрней бан.\n\nвведите telegram_username пользователя для допуска к зелёным турнирам:")
+	chatID, adminChatID := update.Message.Chat.ID, update.Message.From.ID
+	b.StartAdminProcess(bot.AdminProcess{Type: bot.ProcessTypeAdmitToGreen, ChatID: chatID, AdminID: adminChatID})
+	return b.PromptAdmin(chatID, adminChatID, "учтите, игрок всё равно может не пройти по рейтингу. эта команда просто снимет внутрней бан.\n\nкого допустить к зелёным турнирам? "+targetPrompt)
 }
 
 func handleTestTransliteration(b *bot.Bot, update tgbotapi.Update) error {
-	if err := db.TestTransliteration(); err != nil {
+	if err := b.Users.TestTransliteration(); err != nil {
 		log.Printf("failed to test transliteration: %v", err)
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка: %v", err))
 	}
@@ -371,7 +573,7 @@ func handleTestTransliteration(b *bot.Bot, update tgbotapi.Update) error {
 }
 
 func handleTransliterateAll(b *bot.Bot, update tgbotapi.Update) error {
-	changedUsers, err := db.TransliterateAllSavedNames()
+	changedUsers, err := b.Users.TransliterateAllSavedNames()
 	if err != nil {
 		log.Printf("failed to transliterate all: %v", err)
 		return b.SendMessage(update.Message.Chat.ID, fmt.Sprintf("ошибка: %v", err))
@@ -381,10 +583,24 @@ func handleTransliterateAll(b *bot.Bot, update tgbotapi.Update) error {
 		return b.SendMessage(update.Message.Chat.ID, "нет пользователей для изменения")
 	}
 
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "users.transliterate_all",
+		After:   fmt.Sprintf("изменено ников: %d", len(changedUsers)),
+	})
+
 	successCount := 0
 	failCount := 0
 
 	for _, user := range changedUsers {
+		// every rename goes to the table, only the summary above goes to the channel
+		_ = db.RecordAudit(db.AuditEvent{
+			ActorID:  update.Message.From.ID,
+			Action:   "user.transliterate",
+			TargetID: user.ChatID,
+			Before:   user.OldName,
+			After:    user.NewName,
+		})
 		notificationMessage := fmt.Sprintf("я автоматически убрал из никнеймов заглавные буквы и перевёл все на русский. ваш новый никнейм: %s\n\nесли вам не нравится, что у меня получилось, поменять псевдоним можно командой /change_nickname", user.NewName)
 		if err := b.SendMessage(user.ChatID, notificationMessage); err != nil {
 			log.Printf("failed to notify user %d: %v", user.ChatID, err)
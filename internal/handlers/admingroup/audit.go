@@ -0,0 +1,88 @@
+package admingroup
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+)
+
+const auditUsage = "использование: /audit [user=<@username | id | ник>] [action=user.ban] [date=17.10.2026 | from=01.10.2026 to=17.10.2026]"
+
+// auditLimit is how many events /audit shows at most
+const auditLimit = 30
+
+// handleAudit shows the latest audit events matching the filters
+func handleAudit(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+
+	filter := db.AuditFilter{Limit: auditLimit}
+	for _, arg := range strings.Fields(update.Message.CommandArguments()) {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || value == "" {
+			return b.SendMessage(chatID, auditUsage)
+		}
+
+		key = strings.ToLower(key)
+		switch key {
+		case "user":
+			users, err := b.Users.FindUsers(value)
+			if err != nil {
+				return err
+			}
+			switch len(users) {
+			case 0:
+				return b.SendMessage(chatID, fmt.Sprintf("пользователь %s не найден", value))
+			case 1:
+				filter.UserID = users[0].ChatID
+			default:
+				lines := make([]string, 0, len(users))
+				for _, u := range users {
+					lines = append(lines, fmt.Sprintf("%d — %s", u.ChatID, userSummary(u)))
+				}
+				return b.SendMessage(chatID, fmt.Sprintf("под %s подходит несколько пользователей, укажите id:\n%s", value, strings.Join(lines, "\n")))
+			}
+		case "action":
+			filter.Action = value
+		case "date", "from", "to":
+			day, err := time.ParseInLocation("02.01.2006", value, moscowTZ)
+			if err != nil {
+				return b.SendMessage(chatID, "дата должна быть в формате дд.мм.гггг")
+			}
+			if key != "to" {
+				filter.Since = day
+			}
+			if key != "from" {
+				filter.Until = day.AddDate(0, 0, 1)
+			}
+		default:
+			return b.SendMessage(chatID, auditUsage)
+		}
+	}
+
+	events, err := db.GetAuditEvents(filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return b.SendMessage(chatID, "событий не найдено")
+	}
+
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		lines = append(lines, "• "+event.String())
+	}
+	return sendLines(b, chatID, fmt.Sprintf("журнал действий, последние %d:", len(events)), lines)
+}
+
+// auditTime formats an optional deadline for the before and after values of an event
+func auditTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,39 @@
+package admingroup
+
+import (
+	"fmt"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+)
+
+// handleJobs lists the delayed jobs waiting to run
+func handleJobs(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+
+	pending, err := b.Jobs.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return b.SendMessage(chatID, "отложенных задач нет")
+	}
+
+	lines := make([]string, 0, len(pending))
+	for _, job := range pending {
+		line := fmt.Sprintf("• %s — %s", job.RunAt.In(moscowTZ).Format("02.01 15:04"), job.Kind)
+		if job.TournamentID != "" {
+			line += fmt.Sprintf(", турнир %s", job.TournamentID)
+		}
+		if job.PlayerID != 0 {
+			line += fmt.Sprintf(", игрок %d", job.PlayerID)
+		}
+		if job.Attempts > 0 {
+			line += fmt.Sprintf(", попыток %d", job.Attempts)
+		}
+		lines = append(lines, line)
+	}
+	return sendLines(b, chatID, fmt.Sprintf("отложенные задачи, %d:", len(pending)), lines)
+}
@@ -0,0 +1,87 @@
+package admingroup
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/restrictions"
+)
+
+const durationPrompt = "введите срок: например 2w, 10d, 3m, 1y, до 01.12.2026 или навсегда"
+
+// restrictionStep walks an admin through a ban or a green suspension:
+// the duration unless a preset button was pressed, then the user (see targetStep), then the reason
+func restrictionStep(b *bot.Bot, update tgbotapi.Update, process *bot.AdminProcess) error {
+	chatID := update.Message.Chat.ID
+	adminChatID := update.Message.From.ID
+	text := strings.TrimSpace(update.Message.Text)
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+
+	if process.Duration == "" {
+		if _, err := restrictions.ParseUntil(text, time.Now().UTC(), moscowTZ); err != nil {
+			return b.SendMessage(chatID, err.Error())
+		}
+		b.UpdateAdminProcess(chatID, adminChatID, func(p *bot.AdminProcess) { p.Duration = text })
+		return b.PromptAdmin(chatID, adminChatID, targetPrompt)
+	}
+
+	if text == "" {
+		return b.PromptAdmin(chatID, adminChatID, "причина обязательна, напишите её текстом:")
+	}
+	b.ClearAdminProcess(chatID, adminChatID)
+
+	user, err := b.Users.GetByChatID(process.TargetID)
+	if err != nil {
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь %d не найден", process.TargetID))
+	}
+
+	now := time.Now().UTC()
+	until, err := restrictions.ParseUntil(process.Duration, now, moscowTZ)
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
+	durationText := restrictions.Describe(until, now, moscowTZ)
+
+	var reply, notice string
+	switch process.Type {
+	case bot.ProcessTypeSuspension:
+		if err := b.Users.SetNotGreenUntil(user.ChatID, &until, text); err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
+		}
+		auditUser(b, adminChatID, "user.suspend_from_green", user, auditTime(user.NotGreenUntil), auditTime(&until)+", причина: "+text)
+		reply = fmt.Sprintf("пользователь %s отстранён от зелёных %s", userSummary(user), durationText)
+		notice = eligibility.SuspensionMessage(until, text)
+
+	case bot.ProcessTypeBan:
+		if err := b.Users.SetBannedUntil(user.ChatID, &until, text); err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
+		}
+		auditUser(b, adminChatID, "user.ban", user, auditTime(user.BannedUntil), auditTime(&until)+", причина: "+text)
+		reply = fmt.Sprintf("пользователь %s забанен %s", userSummary(user), durationText)
+		notice = eligibility.BanMessage(until, text)
+
+		removed, err := eligibility.EnforceBan(b, user.ChatID)
+		if err != nil {
+			log.Printf("failed to enforce ban for user %d: %v", user.ChatID, err)
+		}
+		if removed {
+			reply += " и удалён из списка турнира"
+		}
+
+	default:
+		return fmt.Errorf("unexpected process type: %s", process.Type)
+	}
+
+	rescheduleRestrictionExpiry(b)
+
+	if err := b.SendMessage(user.ChatID, notice); err != nil {
+		log.Printf("failed to notify user %d about restriction: %v", user.ChatID, err)
+		reply += ". сообщить ему в личку не получилось"
+	}
+	return b.SendMessage(chatID, reply)
+}
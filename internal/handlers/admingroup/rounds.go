@@ -0,0 +1,126 @@
+package admingroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/tournament"
+	"github.com/sukalov/mshkbot/internal/utils"
+)
+
+var pairingSystems = map[string]pairing.System{
+	"swiss": pairing.SystemSwiss,
+	"robin": pairing.SystemRoundRobin,
+}
+
+// handleStartRound pairs the next round and posts the pairings to the main group.
+// usage: /start_round [id] [swiss|robin]; the system only matters for the first round
+func handleStartRound(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	var system pairing.System
+	var query []string
+	for _, arg := range strings.Fields(update.Message.CommandArguments()) {
+		if s, ok := pairingSystems[strings.ToLower(arg)]; ok {
+			system = s
+			continue
+		}
+		query = append(query, arg)
+	}
+
+	t, err := findTournament(b, strings.Join(query, " "))
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
+
+	if len(t.Rounds) > 0 {
+		last := t.Rounds[len(t.Rounds)-1]
+		if unfinished := last.Unfinished(); len(unfinished) > 0 {
+			return b.SendMessage(chatID, fmt.Sprintf("в %d туре нет результатов на досках %s. внесите их через /set_result", last.Number, joinInts(unfinished)))
+		}
+	}
+
+	round, err := b.Tournament.PairNextRound(context.Background(), t.Metadata.ID, system)
+	switch {
+	case errors.Is(err, tournament.ErrAllRoundsPlayed):
+		return b.SendMessage(chatID, "все туры круговика уже сыграны")
+	case errors.Is(err, pairing.ErrNoPairing):
+		return b.SendMessage(chatID, "не получается составить пары: все оставшиеся соперники уже встречались")
+	case err != nil:
+		log.Printf("failed to pair round of tournament %s: %v", t.Metadata.ID, err)
+		return b.SendMessage(chatID, "не получилось составить пары, нужно хотя бы два участника")
+	}
+
+	messageID, err := b.PostPairings(t.Metadata.ID, round)
+	if err != nil {
+		return err
+	}
+	if err := b.Tournament.SetRoundMessageID(context.Background(), t.Metadata.ID, round.Number, messageID); err != nil {
+		log.Printf("failed to store pairings message id: %v", err)
+	}
+
+	log.Printf("round %d of tournament %s paired by admin %d", round.Number, t.Metadata.ID, update.Message.From.ID)
+	t, _ = b.Tournament.Get(t.Metadata.ID)
+	return b.SendMessage(chatID, t.PairingsMessage(round))
+}
+
+// handleSetResult lets an arbiter set or correct a result.
+// usage: /set_result <тур> <доска> <1-0|½-½|0-1> [id]
+func handleSetResult(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	usage := "использование: /set_result <тур> <доска> <1-0|½-½|0-1> [id турнира]"
+
+	args := strings.Fields(update.Message.CommandArguments())
+	if len(args) < 3 {
+		return b.SendMessage(chatID, usage)
+	}
+	number, errRound := strconv.Atoi(args[0])
+	board, errBoard := strconv.Atoi(args[1])
+	result, ok := pairing.ParseResult(args[2])
+	if errRound != nil || errBoard != nil || !ok {
+		return b.SendMessage(chatID, usage)
+	}
+
+	t, err := findTournament(b, strings.Join(args[3:], " "))
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
+
+	previous, _ := t.Game(number, board)
+	if _, err := b.Tournament.OverrideResult(context.Background(), t.Metadata.ID, number, board, result); err != nil {
+		log.Printf("failed to set result: %v", err)
+		return b.SendMessage(chatID, fmt.Sprintf("нет доски %d в %d туре", board, number))
+	}
+	log.Printf("admin %d set result %s on board %d of round %d in tournament %s", update.Message.From.ID, result, board, number, t.Metadata.ID)
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "game.set_result",
+		Target:  fmt.Sprintf("%s, тур %d, доска %d", t.Metadata.ID, number, board),
+		Before:  string(previous.Result),
+		After:   string(result),
+	})
+
+	if err := b.UpdatePairingsMessage(t.Metadata.ID, number); err != nil {
+		log.Printf("failed to update pairings message: %v", err)
+	}
+	if err := b.UpdateStandingsMessage(t.Metadata.ID); err != nil {
+		log.Printf("failed to update standings message: %v", err)
+	}
+	return b.GiveReaction(chatID, update.Message.MessageID, utils.ApproveEmoji())
+}
+
+func joinInts(numbers []int) string {
+	parts := make([]string, len(numbers))
+	for i, n := range numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
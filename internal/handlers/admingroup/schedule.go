@@ -0,0 +1,147 @@
+package admingroup
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/schedule"
+	"github.com/sukalov/mshkbot/internal/tournament"
+)
+
+const scheduleUsage = `расписание:
+
+/schedule — показать все еженедельные турниры
+/schedule add <id> <день> <чч:мм-чч:мм> limit=24 [lichess=1600] [chesscom=1400] [club=1500] [confirm=минуты] [verified=yes] [peaks=blitz+rapid] [provisional=yes] [months=12] [cooldown=15] [rejoin=no] [place=keep] [checkouts=2] [name=название] | текст анонса
+/schedule edit <id> <поля как в add>
+/schedule pause <id>
+/schedule resume <id>
+/schedule delete <id>
+
+дни: пн вт ср чт пт сб вс
+club — лимит клубного рейтинга, игроки без рейтинговых партий проходят
+confirm — сколько минут даётся на подтверждение места из очереди, 0 — без подтверждения
+verified — пускать только игроков, подтвердивших свои аккаунты командой /verify
+peaks — какие пиковые рейтинги сравниваются с лимитами: bullet, blitz, rapid, classical, correspondence, variants через +, all или default (blitz+rapid+classical)
+provisional — учитывать ли провизорный рейтинг, по умолчанию нет
+months — брать пик только за последние N месяцев, 0 — за всё время
+cooldown — через сколько минут вышедший игрок может записаться снова, по умолчанию 15
+rejoin — можно ли вернуться после выхода, по умолчанию yes
+place — куда встаёт вернувшийся: back — в конец списка (по умолчанию), keep — на своё прежнее место
+checkouts — сколько раз можно выйти из турнира, последний выход окончательный, 0 — без ограничения`
+
+func handleSchedule(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	args := strings.TrimSpace(update.Message.CommandArguments())
+
+	if args == "" {
+		return listSchedule(b, chatID)
+	}
+
+	subcommand, rest, _ := strings.Cut(args, " ")
+	key, spec, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	key = strings.ToLower(key)
+
+	if subcommand == "help" {
+		return b.SendMessage(chatID, scheduleUsage)
+	}
+	if key == "" {
+		return b.SendMessage(chatID, scheduleUsage)
+	}
+
+	// before and after describe the event for the audit log
+	var reply, before, after string
+	switch subcommand {
+	case "add":
+		if err := tournament.ValidateID(key); err != nil {
+			return b.SendMessage(chatID, "id турнира может содержать только латиницу, цифры, - и _")
+		}
+		if _, err := db.GetScheduledEvent(key); err == nil {
+			return b.SendMessage(chatID, fmt.Sprintf("турнир %s уже есть в расписании", key))
+		}
+		event := schedule.Event{Key: key, Name: key, Weekday: -1, OpenHour: -1}
+		if err := event.Apply(spec); err != nil {
+			return b.SendMessage(chatID, err.Error())
+		}
+		if event.Weekday < 0 || event.OpenHour < 0 {
+			return b.SendMessage(chatID, "нужно указать день и время, например: вт 12:00-21:00")
+		}
+		if err := db.CreateScheduledEvent(event); err != nil {
+			return err
+		}
+		after = event.String()
+		reply = "добавлено: " + after
+
+	case "edit":
+		event, err := db.GetScheduledEvent(key)
+		if err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("турнира %s нет в расписании", key))
+		}
+		before = event.String()
+		if err := event.Apply(spec); err != nil {
+			return b.SendMessage(chatID, err.Error())
+		}
+		if err := db.SaveScheduledEvent(event); err != nil {
+			return err
+		}
+		after = event.String()
+		reply = "изменено: " + after
+
+	case "pause", "resume":
+		event, err := db.GetScheduledEvent(key)
+		if err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("турнира %s нет в расписании", key))
+		}
+		before = event.String()
+		event.Paused = subcommand == "pause"
+		if err := db.SaveScheduledEvent(event); err != nil {
+			return err
+		}
+		after = event.String()
+		reply = after
+
+	case "delete":
+		event, err := db.GetScheduledEvent(key)
+		if err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("турнира %s нет в расписании", key))
+		}
+		if err := db.DeleteScheduledEvent(key); err != nil {
+			return err
+		}
+		before = event.String()
+		reply = fmt.Sprintf("турнир %s удалён из расписания", key)
+
+	default:
+		return b.SendMessage(chatID, scheduleUsage)
+	}
+
+	log.Printf("schedule %s %s by admin %d", subcommand, key, update.Message.From.ID)
+	b.Audit(db.AuditEvent{
+		ActorID: update.Message.From.ID,
+		Action:  "schedule." + subcommand,
+		Target:  key,
+		Before:  before,
+		After:   after,
+	})
+	b.ReloadSchedule()
+	return b.SendMessage(chatID, reply)
+}
+
+func listSchedule(b *bot.Bot, chatID int64) error {
+	events, err := db.GetScheduledEvents()
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return b.SendMessage(chatID, "расписание пустое\n\n"+scheduleUsage)
+	}
+
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		lines = append(lines, event.String())
+	}
+	return b.SendMessage(chatID, "еженедельные турниры:\n\n"+strings.Join(lines, "\n")+"\n\n/schedule help — как редактировать")
+}
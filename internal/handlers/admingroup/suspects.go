@@ -0,0 +1,136 @@
+package admingroup
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/suspects"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// maxMessageLength stays under the telegram limit of 4096 characters
+const maxMessageLength = 4000
+
+// handleSuspects reports users who may be one person registered twice.
+// names and accounts are compared right away, rating histories are fetched in the background
+func handleSuspects(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	users, err := b.Users.GetAll()
+	if err != nil {
+		return err
+	}
+
+	people := make([]suspects.Person, 0, len(users))
+	for _, u := range users {
+		people = append(people, personOf(u))
+	}
+
+	pairs := append(suspects.SimilarNames(people), suspects.SharedAccounts(people)...)
+	suspects.Sort(pairs)
+	if len(pairs) == 0 {
+		if err := b.SendMessage(chatID, "похожих ников и общих аккаунтов нет"); err != nil {
+			return err
+		}
+	} else if err := sendLines(b, chatID, "похожие пользователи:", pairLines(pairs)); err != nil {
+		return err
+	}
+
+	go reportMatchingHistories(b, chatID, users)
+	return nil
+}
+
+func personOf(u db.User) suspects.Person {
+	p := suspects.Person{ID: u.ChatID, Username: u.Username, Name: u.SavedName}
+	if p.Name == "" {
+		p.Name = u.TgName
+	}
+	if u.Lichess != nil {
+		p.Lichess = *u.Lichess
+	}
+	if u.ChessCom != nil {
+		p.ChessCom = *u.ChessCom
+	}
+	return p
+}
+
+// reportMatchingHistories fetches the history of every linked account one by one
+// so the rating sites are not flooded, then posts the pairs that match
+func reportMatchingHistories(b *bot.Bot, chatID int64, users []db.User) {
+	var accounts []suspects.Account
+	failed := 0
+
+	for _, u := range users {
+		person := personOf(u)
+		for _, linked := range []struct {
+			site     string
+			username string
+			provider ratings.Provider
+		}{
+			{types.SiteLichess, person.Lichess, b.Ratings.Lichess},
+			{types.SiteChesscom, person.ChessCom, b.Ratings.ChessCom},
+		} {
+			if linked.username == "" {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			history, err := linked.provider.History(ctx, linked.username)
+			cancel()
+			if err != nil {
+				log.Printf("suspects: failed to get %s history of %s: %v", linked.site, linked.username, err)
+				failed++
+				continue
+			}
+			accounts = append(accounts, suspects.Account{Person: person, Site: linked.site, History: history})
+		}
+	}
+
+	pairs := suspects.MatchingHistories(accounts)
+	suspects.Sort(pairs)
+
+	summary := fmt.Sprintf("истории рейтинга: проверено аккаунтов %d", len(accounts))
+	if failed > 0 {
+		summary += fmt.Sprintf(", не удалось загрузить %d", failed)
+	}
+	if len(pairs) == 0 {
+		if err := b.SendMessage(chatID, summary+", совпадений нет"); err != nil {
+			log.Printf("failed to send suspects report: %v", err)
+		}
+		return
+	}
+	if err := sendLines(b, chatID, summary+". совпадения:", pairLines(pairs)); err != nil {
+		log.Printf("failed to send suspects report: %v", err)
+	}
+}
+
+func pairLines(pairs []suspects.Pair) []string {
+	lines := make([]string, 0, len(pairs))
+	for _, p := range pairs {
+		lines = append(lines, fmt.Sprintf("• %s и %s — %s", p.A, p.B, p.Reason))
+	}
+	return lines
+}
+
+// sendLines sends a header and lines, splitting into several messages when they are too long
+func sendLines(b *bot.Bot, chatID int64, header string, lines []string) error {
+	message := header
+	for _, line := range lines {
+		if len(message)+len(line)+1 > maxMessageLength {
+			if err := b.SendMessage(chatID, message); err != nil {
+				return err
+			}
+			message = ""
+		}
+		if message != "" {
+			message += "\n"
+		}
+		message += line
+	}
+	return b.SendMessage(chatID, message)
+}
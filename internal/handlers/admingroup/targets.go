@@ -0,0 +1,145 @@
+package admingroup
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+)
+
+const targetPrompt = "перешлите сообщение пользователя или введите его @username, id или ник:"
+
+// findTargets works out which users an admin means by a message: the sender of a forwarded
+// message, the author of a replied message, a mention of a user without a username,
+// or else text as a @username, chat id or saved nickname
+func findTargets(b *bot.Bot, msg *tgbotapi.Message, text string) ([]db.User, error) {
+	if msg.ForwardFrom != nil {
+		return b.Users.FindUsers(strconv.FormatInt(msg.ForwardFrom.ID, 10))
+	}
+	if msg.ForwardSenderName != "" {
+		return nil, fmt.Errorf("%s скрывает аккаунт при пересылке, введите его ник или id", msg.ForwardSenderName)
+	}
+	if reply := msg.ReplyToMessage; reply != nil && reply.From != nil && !reply.From.IsBot {
+		return b.Users.FindUsers(strconv.FormatInt(reply.From.ID, 10))
+	}
+	for _, entity := range msg.Entities {
+		if entity.Type == "text_mention" && entity.User != nil {
+			return b.Users.FindUsers(strconv.FormatInt(entity.User.ID, 10))
+		}
+	}
+	return b.Users.FindUsers(text)
+}
+
+// targetStep picks the user an admin process is about. a single match goes on right away,
+// several matches get a keyboard to choose from
+func targetStep(b *bot.Bot, update tgbotapi.Update, process *bot.AdminProcess) error {
+	chatID := update.Message.Chat.ID
+	adminChatID := update.Message.From.ID
+
+	users, err := findTargets(b, update.Message, update.Message.Text)
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
+
+	switch len(users) {
+	case 0:
+		b.ClearAdminProcess(chatID, adminChatID)
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь %s не найден", strings.TrimSpace(update.Message.Text)))
+	case 1:
+		return applyTarget(b, chatID, adminChatID, process, users[0])
+	}
+
+	return b.SendMessageWithButtons(chatID, "нашлось несколько пользователей, выберите:", pickUserKeyboard(users, "target:"))
+}
+
+// pickUserKeyboard offers one button per user, the callback data is prefix+chat id.
+// cancel goes to handleTargetCallback whatever the prefix
+func pickUserKeyboard(users []db.User, prefix string) tgbotapi.InlineKeyboardMarkup {
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(users)+1)
+	for _, u := range users {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s, %d", userSummary(u), u.ChatID), prefix+strconv.FormatInt(u.ChatID, 10)),
+		))
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("отмена", "target:cancel")))
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+// handleTargetCallback goes on with the admin process once a user is picked from the keyboard
+func handleTargetCallback(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+	adminChatID := query.From.ID
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Request(callback); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	_, value, _ := strings.Cut(query.Data, ":")
+	if value == "cancel" {
+		b.ClearAdminProcess(chatID, adminChatID)
+		return b.EditMessage(chatID, messageID, "отменено")
+	}
+	userID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+
+	process, exists := b.GetAdminProcess(chatID, adminChatID)
+	if !exists {
+		return b.EditMessage(chatID, messageID, "выбор устарел, начните заново")
+	}
+	user, err := b.Users.GetByChatID(userID)
+	if err != nil {
+		return b.EditMessage(chatID, messageID, fmt.Sprintf("пользователь %d не найден", userID))
+	}
+
+	if err := b.EditMessage(chatID, messageID, "выбран "+userSummary(user)); err != nil {
+		log.Printf("failed to edit message: %v", err)
+	}
+	return applyTarget(b, chatID, adminChatID, process, user)
+}
+
+// applyTarget goes on with the process for the chosen user
+func applyTarget(b *bot.Bot, chatID, adminChatID int64, process *bot.AdminProcess, user db.User) error {
+	switch process.Type {
+	case bot.ProcessTypeBan, bot.ProcessTypeSuspension:
+		b.UpdateAdminProcess(chatID, adminChatID, func(p *bot.AdminProcess) { p.TargetID = user.ChatID })
+		return b.PromptAdmin(chatID, adminChatID, "напишите причину, её увидит пользователь:")
+
+	case bot.ProcessTypeUnban:
+		b.ClearAdminProcess(chatID, adminChatID)
+		if err := b.Users.SetBannedUntil(user.ChatID, nil, ""); err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
+		}
+		rescheduleRestrictionExpiry(b)
+		auditUser(b, adminChatID, "user.unban", user, auditTime(user.BannedUntil), "")
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь %s разбанен", userSummary(user)))
+
+	case bot.ProcessTypeAdmitToGreen:
+		b.ClearAdminProcess(chatID, adminChatID)
+		if err := b.Users.SetNotGreenUntil(user.ChatID, nil, ""); err != nil {
+			return b.SendMessage(chatID, fmt.Sprintf("ошибка при обновлении статуса: %v", err))
+		}
+		rescheduleRestrictionExpiry(b)
+		auditUser(b, adminChatID, "user.admit_to_green", user, auditTime(user.NotGreenUntil), "")
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь %s допущен к зелёным турнирам", userSummary(user)))
+	}
+
+	b.ClearAdminProcess(chatID, adminChatID)
+	return fmt.Errorf("unexpected process type: %s", process.Type)
+}
+
+// rescheduleRestrictionExpiry moves the expiry job to the next restriction that is still set
+func rescheduleRestrictionExpiry(b *bot.Bot) {
+	if err := eligibility.ScheduleRestrictionExpiry(b); err != nil {
+		log.Printf("failed to schedule restriction expiry: %v", err)
+	}
+}
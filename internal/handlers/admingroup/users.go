@@ -0,0 +1,333 @@
+package admingroup
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/restrictions"
+	"github.com/sukalov/mshkbot/internal/types"
+	"github.com/sukalov/mshkbot/internal/utils"
+)
+
+// fields of a user an admin can edit from the card
+const (
+	fieldSavedName = "saved_name"
+	fieldLichess   = "lichess"
+	fieldChessCom  = "chesscom"
+)
+
+var finalStateNames = map[string]string{
+	types.StateInTournament: "играл",
+	types.StateQueued:       "остался в очереди",
+	types.StatePending:      "не подтвердил место",
+	types.StateCheckedOut:   "вышел",
+	types.StateRemoved:      "удалён",
+}
+
+// handleUser shows the card of a user found by @username, chat id or saved name,
+// or of the author of the replied message
+func handleUser(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+	query := strings.TrimSpace(update.Message.CommandArguments())
+	if query == "" && update.Message.ReplyToMessage == nil {
+		return b.SendMessage(chatID, "использование: /user <@username | id | ник>, или ответьте командой на сообщение пользователя")
+	}
+
+	users, err := findTargets(b, update.Message, query)
+	if err != nil {
+		return b.SendMessage(chatID, err.Error())
+	}
+
+	switch len(users) {
+	case 0:
+		if query == "" {
+			return b.SendMessage(chatID, "автор сообщения не зарегистрирован в боте")
+		}
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь %s не найден", query))
+	case 1:
+		return sendUserCard(b, chatID, users[0].ChatID)
+	}
+
+	return b.SendMessageWithButtons(chatID, "нашлось несколько пользователей, выберите:", pickUserKeyboard(users, "user:show:"))
+}
+
+func userSummary(u db.User) string {
+	summary := u.SavedName
+	if u.Username != "" {
+		summary += " (@" + u.Username + ")"
+	}
+	if summary == "" {
+		summary = u.TgName
+	}
+	return summary
+}
+
+func sendUserCard(b *bot.Bot, chatID, userID int64) error {
+	text, keyboard, err := userCard(b, userID)
+	if err != nil {
+		return err
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = keyboard
+	msg.DisableWebPagePreview = true
+	_, err = b.Send(msg)
+	return err
+}
+
+// userCard renders the whole db record with the latest tournaments and the edit buttons
+func userCard(b *bot.Bot, userID int64) (string, tgbotapi.InlineKeyboardMarkup, error) {
+	u, err := b.Users.GetByChatID(userID)
+	if err != nil {
+		return "", tgbotapi.InlineKeyboardMarkup{}, err
+	}
+
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+	date := func(t *time.Time, reason string) string {
+		if t == nil || t.IsZero() {
+			return "нет"
+		}
+		text := restrictions.Describe(*t, time.Now(), moscowTZ)
+		if reason != "" {
+			text += ", причина: " + reason
+		}
+		return text
+	}
+	account := func(username *string, verified bool) string {
+		if username == nil || *username == "" {
+			return "не указан"
+		}
+		if verified {
+			return *username + " (подтверждён)"
+		}
+		return *username
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "пользователь %d\n", u.ChatID)
+	fmt.Fprintf(&sb, "telegram: @%s (%s)\n", u.Username, u.TgName)
+	fmt.Fprintf(&sb, "ник: %s\n", u.SavedName)
+	fmt.Fprintf(&sb, "lichess: %s\n", account(u.Lichess, u.LichessVerified))
+	fmt.Fprintf(&sb, "chess.com: %s\n", account(u.ChessCom, u.ChessComVerified))
+	fmt.Fprintf(&sb, "состояние: %s\n", u.State)
+	fmt.Fprintf(&sb, "бан: %s\n", date(u.BannedUntil, u.BanReason))
+	fmt.Fprintf(&sb, "отстранён от зелёных: %s\n", date(u.NotGreenUntil, u.NotGreenReason))
+	fmt.Fprintf(&sb, "записей на турниры: %d\n", u.TimesPlayed)
+	if rating, rated := db.ClubRating(u); rated {
+		fmt.Fprintf(&sb, "клубный рейтинг: %d (партий: %d)\n", rating, u.ClubGames)
+	}
+	fmt.Fprintf(&sb, "зарегистрирован: %s\n", u.AddedAt.In(moscowTZ).Format("02.01.2006"))
+
+	records, err := db.GetRegistrations(u.ChatID, 10)
+	if err != nil {
+		log.Printf("failed to get registrations of user %d: %v", u.ChatID, err)
+	} else if len(records) > 0 {
+		sb.WriteString("\nпоследние турниры:\n")
+		for _, r := range records {
+			state := finalStateNames[r.FinalState]
+			if state == "" {
+				state = r.FinalState
+			}
+			name := r.TournamentName
+			if name == "" {
+				name = r.TournamentKey
+			}
+			fmt.Fprintf(&sb, "%s %s — %s\n", r.ClosedAt.In(moscowTZ).Format("02.01.2006"), name, state)
+		}
+	}
+
+	id := strconv.FormatInt(u.ChatID, 10)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("ник", "user:edit:"+id+":"+fieldSavedName),
+			tgbotapi.NewInlineKeyboardButtonData("lichess", "user:edit:"+id+":"+fieldLichess),
+			tgbotapi.NewInlineKeyboardButtonData("chess.com", "user:edit:"+id+":"+fieldChessCom),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("сбросить состояние", "user:reset:"+id),
+			tgbotapi.NewInlineKeyboardButtonData("удалить", "user:delete:"+id),
+		),
+	)
+	return sb.String(), keyboard, nil
+}
+
+// handleUserCallback handles the buttons of a user card.
+// data looks like user:<action>:<chat id>[:<field>]
+func handleUserCallback(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+	adminID := query.From.ID
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Request(callback); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+	action := parts[1]
+	userID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+
+	u, err := b.Users.GetByChatID(userID)
+	if err != nil {
+		return b.EditMessage(chatID, messageID, fmt.Sprintf("пользователь %d не найден", userID))
+	}
+
+	switch action {
+	case "edit":
+		if len(parts) < 4 {
+			return fmt.Errorf("invalid callback data: %s", query.Data)
+		}
+		field := parts[3]
+		prompt := map[string]string{
+			fieldSavedName: "введите новый ник для %s:",
+			fieldLichess:   "введите lichess для %s, или - чтобы убрать:",
+			fieldChessCom:  "введите chess.com для %s, или - чтобы убрать:",
+		}[field]
+		if prompt == "" {
+			return fmt.Errorf("invalid callback data: %s", query.Data)
+		}
+		b.StartAdminProcess(bot.AdminProcess{Type: bot.ProcessTypeEditUser, ChatID: chatID, AdminID: adminID, TargetID: userID, Field: field})
+		return b.PromptAdmin(chatID, adminID, fmt.Sprintf(prompt, userSummary(u)))
+
+	case "reset":
+		state := db.StateCompleted
+		if u.SavedName == "" {
+			state = db.StateAskedSavedName
+		}
+		if err := b.Users.UpdateState(userID, state); err != nil {
+			return err
+		}
+		auditUser(b, adminID, "user.reset_state", u, string(u.State), string(state))
+		return refreshUserCard(b, chatID, messageID, userID)
+
+	case "delete":
+		if len(b.Tournament.TournamentsOf(int(userID))) > 0 {
+			return b.SendMessage(chatID, "пользователь записан на открытый турнир, сначала уберите его из списка")
+		}
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("да, удалить", "user:delete_confirm:"+parts[2]),
+			tgbotapi.NewInlineKeyboardButtonData("отмена", "user:show:"+parts[2]),
+		))
+		edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, fmt.Sprintf("удалить пользователя %s? история турниров останется в архиве", userSummary(u)), keyboard)
+		_, err := b.Request(edit)
+		return err
+
+	case "delete_confirm":
+		if len(b.Tournament.TournamentsOf(int(userID))) > 0 {
+			return b.SendMessage(chatID, "пользователь записан на открытый турнир, сначала уберите его из списка")
+		}
+		before, _ := json.Marshal(u)
+		if err := b.Users.Delete(userID); err != nil {
+			return err
+		}
+		auditUser(b, adminID, "user.delete", u, string(before), "")
+		log.Printf("admin %d deleted user %d", adminID, userID)
+		return b.EditMessage(chatID, messageID, fmt.Sprintf("пользователь %s удалён", userSummary(u)))
+
+	case "show":
+		return refreshUserCard(b, chatID, messageID, userID)
+
+	default:
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+}
+
+func refreshUserCard(b *bot.Bot, chatID int64, messageID int, userID int64) error {
+	text, keyboard, err := userCard(b, userID)
+	if err != nil {
+		return err
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, keyboard)
+	edit.DisableWebPagePreview = true
+	_, err = b.Request(edit)
+	return err
+}
+
+// applyUserEdit saves the value an admin typed after pressing an edit button on a user card
+func applyUserEdit(b *bot.Bot, update tgbotapi.Update, process *bot.AdminProcess) error {
+	chatID := update.Message.Chat.ID
+	adminID := update.Message.From.ID
+	b.ClearAdminProcess(chatID, adminID)
+
+	u, err := b.Users.GetByChatID(process.TargetID)
+	if err != nil {
+		return b.SendMessage(chatID, fmt.Sprintf("пользователь %d не найден", process.TargetID))
+	}
+
+	value := strings.TrimSpace(update.Message.Text)
+
+	switch process.Field {
+	case fieldSavedName:
+		newName := utils.Transliterate(value)
+		if newName == "" {
+			return b.SendMessage(chatID, "ник не может быть пустым")
+		}
+		if err := b.Users.UpdateSavedName(u.ChatID, newName); err != nil {
+			return err
+		}
+		auditUser(b, adminID, "user.edit_saved_name", u, u.SavedName, newName)
+		if err := b.RenamePlayer(int(u.ChatID), newName); err != nil {
+			log.Printf("failed to update tournament player name: %v", err)
+		}
+
+	case fieldLichess, fieldChessCom:
+		site, old := types.SiteLichess, u.Lichess
+		if process.Field == fieldChessCom {
+			site, old = types.SiteChesscom, u.ChessCom
+		}
+
+		username := strings.TrimPrefix(value, "@")
+		if username == "-" {
+			username = ""
+		}
+		if username != "" {
+			owner, claimed, err := b.Users.FindAccountOwner(site, username, u.ChatID)
+			if err != nil {
+				return err
+			}
+			if claimed {
+				return b.SendMessage(chatID, fmt.Sprintf("%s %s уже привязан к %d — %s", site, username, owner.ChatID, userSummary(owner)))
+			}
+		}
+
+		if err := b.Users.SetAccount(u.ChatID, site, username); err != nil {
+			return err
+		}
+		before := ""
+		if old != nil {
+			before = *old
+		}
+		auditUser(b, adminID, "user.edit_"+site, u, before, username)
+
+	default:
+		return fmt.Errorf("unknown user field: %s", process.Field)
+	}
+
+	log.Printf("admin %d changed %s of user %d", adminID, process.Field, u.ChatID)
+	return sendUserCard(b, chatID, u.ChatID)
+}
+
+// auditUser records an admin change of a user
+func auditUser(b *bot.Bot, adminID int64, action string, u db.User, before, after string) {
+	b.Audit(db.AuditEvent{
+		ActorID:  adminID,
+		Action:   action,
+		TargetID: u.ChatID,
+		Target:   userSummary(u),
+		Before:   before,
+		After:    after,
+	})
+}
@@ -0,0 +1,240 @@
+package handlers_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/handlers/admingroup"
+	"github.com/sukalov/mshkbot/internal/handlers/maingroup"
+	"github.com/sukalov/mshkbot/internal/handlers/privatechat"
+	"github.com/sukalov/mshkbot/internal/jobs"
+	"github.com/sukalov/mshkbot/internal/telegramtest"
+	"github.com/sukalov/mshkbot/internal/tournament"
+	"github.com/sukalov/mshkbot/internal/types"
+	"github.com/sukalov/mshkbot/internal/waitlist"
+)
+
+const (
+	mainGroupID  = -100
+	adminGroupID = -200
+)
+
+var (
+	mainGroup  = tgbotapi.Chat{ID: mainGroupID, Type: "supergroup"}
+	adminGroup = tgbotapi.Chat{ID: adminGroupID, Type: "supergroup"}
+	admin      = tgbotapi.User{ID: 900, UserName: "admin"}
+)
+
+// harness runs the bot with all handlers against the fake Bot API, an in-memory database
+// and in-memory tournaments
+type harness struct {
+	t      *testing.T
+	server *telegramtest.Server
+	bot    *bot.Bot
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	if err := db.OpenFile(":memory:"); err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+	server.SetAdmins(adminGroupID, admin)
+
+	b, err := bot.New("test", telegramtest.Token, server.URL, mainGroupID, adminGroupID, bot.Storage{
+		Tournaments:    tournament.NewMemoryStore(),
+		Users:          db.NewSQLUsers(db.Database),
+		AdminProcesses: bot.NewMemoryProcesses(),
+		Jobs:           jobs.NewMemoryBackend(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create bot: %v", err)
+	}
+	waitlist.Resume(b)
+	go b.Start(maingroup.GetHandlers(), admingroup.GetHandlers(), privatechat.GetHandlers())
+	t.Cleanup(b.Stop)
+
+	return &harness{t: t, server: server, bot: b}
+}
+
+func private(user tgbotapi.User) tgbotapi.Chat {
+	return tgbotapi.Chat{ID: user.ID, Type: "private"}
+}
+
+// waitMessage waits for a message in the chat containing text
+func (h *harness) waitMessage(chatID int64, text string) telegramtest.Message {
+	h.t.Helper()
+	var found telegramtest.Message
+	ok := h.server.WaitFor(5*time.Second, func() bool {
+		for _, m := range h.server.Messages(chatID) {
+			if strings.Contains(m.Text, text) {
+				found = m
+				return true
+			}
+		}
+		return false
+	})
+	if !ok {
+		h.t.Fatalf("no message with %q in chat %d, got %+v", text, chatID, h.server.Messages(chatID))
+	}
+	return found
+}
+
+// register walks a user through /start without rating accounts
+func (h *harness) register(user tgbotapi.User, name string) {
+	h.t.Helper()
+	h.server.SendText(private(user), user, "/start")
+	prompt := h.waitMessage(user.ID, "где вы играете?")
+	h.server.PressButton(private(user), prompt.MessageID, user, "register:none")
+	h.waitMessage(user.ID, "введите ваш псевдоним")
+	h.server.SendText(private(user), user, name)
+	h.waitMessage(user.ID, "регистрация завершена")
+}
+
+func (h *harness) createTournament(metadata types.TournamentMetadata) {
+	h.t.Helper()
+	if err := h.bot.Tournament.CreateTournament(context.Background(), metadata); err != nil {
+		h.t.Fatalf("failed to create tournament: %v", err)
+	}
+}
+
+// waitPlayer waits until the player has the state in the tournament
+func (h *harness) waitPlayer(tournamentID string, playerID int64, state string) {
+	h.t.Helper()
+	ok := h.server.WaitFor(5*time.Second, func() bool {
+		t, _ := h.bot.Tournament.Get(tournamentID)
+		player, listed := t.GetPlayer(int(playerID))
+		return listed && player.State == state
+	})
+	if !ok {
+		t, _ := h.bot.Tournament.Get(tournamentID)
+		h.t.Fatalf("player %d is not %s in %s: %+v", playerID, state, tournamentID, t.List)
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	h := newHarness(t)
+	user := tgbotapi.User{ID: 101, UserName: "carlsen", FirstName: "Magnus"}
+
+	h.register(user, "Магнус")
+
+	saved, err := h.bot.Users.GetByChatID(user.ID)
+	if err != nil {
+		t.Fatalf("user was not saved: %v", err)
+	}
+	if saved.State != db.StateCompleted || saved.SavedName != "магнус" {
+		t.Errorf("unexpected user: state %s, name %q", saved.State, saved.SavedName)
+	}
+}
+
+func TestCheckInAndPromotionFromQueue(t *testing.T) {
+	h := newHarness(t)
+	first := tgbotapi.User{ID: 101, UserName: "first"}
+	second := tgbotapi.User{ID: 102, UserName: "second"}
+	h.register(first, "first")
+	h.register(second, "second")
+	h.createTournament(types.TournamentMetadata{ID: "blitz", Limit: 1})
+
+	checkIn := h.server.SendText(mainGroup, first, "/checkin")
+	h.waitPlayer("blitz", first.ID, types.StateInTournament)
+	reacted := h.server.WaitFor(5*time.Second, func() bool {
+		m, _ := h.server.Message(mainGroupID, checkIn)
+		return len(m.Reactions) > 0
+	})
+	if !reacted {
+		t.Error("check-in was not acknowledged with a reaction")
+	}
+
+	h.server.SendText(mainGroup, second, "/checkin")
+	h.waitMessage(mainGroupID, "добавили вас в очередь")
+	h.waitPlayer("blitz", second.ID, types.StateQueued)
+
+	h.server.SendText(mainGroup, first, "/checkout")
+	h.waitPlayer("blitz", first.ID, types.StateCheckedOut)
+	h.waitPlayer("blitz", second.ID, types.StateInTournament)
+	h.waitMessage(second.ID, "вы прошли из очереди")
+
+	pending, err := h.bot.Jobs.Pending()
+	if err != nil {
+		t.Fatalf("failed to list jobs: %v", err)
+	}
+	if len(pending) != 1 || pending[0].Kind != jobs.KindCleanup || pending[0].PlayerID != first.ID {
+		t.Errorf("want a cleanup of the checked-out player, got %+v", pending)
+	}
+}
+
+func TestRejoinAfterCheckout(t *testing.T) {
+	h := newHarness(t)
+	user := tgbotapi.User{ID: 101, UserName: "hesitant"}
+	h.register(user, "hesitant")
+	h.createTournament(types.TournamentMetadata{ID: "blitz"})
+
+	h.server.SendText(mainGroup, user, "/checkin")
+	h.waitPlayer("blitz", user.ID, types.StateInTournament)
+	h.server.SendText(mainGroup, user, "/checkout")
+	h.waitPlayer("blitz", user.ID, types.StateCheckedOut)
+
+	h.server.SendText(mainGroup, user, "/checkin")
+	h.waitMessage(mainGroupID, "записаться снова можно")
+
+	h.server.SendText(adminGroup, admin, "/rejoin cooldown=0 checkouts=2 blitz")
+	h.waitMessage(adminGroupID, "возврат сразу")
+	events, err := db.GetAuditEvents(db.AuditFilter{Action: "tournament.rejoin"})
+	if err != nil {
+		t.Fatalf("failed to load audit events: %v", err)
+	}
+	if len(events) != 1 || events[0].ActorID != admin.ID || events[0].Target != "blitz" {
+		t.Errorf("want the policy change audited, got %+v", events)
+	}
+
+	h.server.SendText(mainGroup, user, "/checkin")
+	h.waitPlayer("blitz", user.ID, types.StateInTournament)
+	h.server.SendText(mainGroup, user, "/checkout")
+	h.waitPlayer("blitz", user.ID, types.StateCheckedOut)
+
+	h.server.SendText(mainGroup, user, "/checkin")
+	h.waitMessage(mainGroupID, "больше вернуться нельзя")
+}
+
+func TestBan(t *testing.T) {
+	h := newHarness(t)
+	user := tgbotapi.User{ID: 101, UserName: "cheater"}
+	h.register(user, "cheater")
+	h.createTournament(types.TournamentMetadata{ID: "blitz"})
+
+	h.server.SendText(mainGroup, user, "/checkin")
+	h.waitPlayer("blitz", user.ID, types.StateInTournament)
+
+	h.server.SendText(adminGroup, admin, "/ban_player")
+	prompt := h.waitMessage(adminGroupID, "длительность бана")
+	h.server.PressButton(adminGroup, prompt.MessageID, admin, "ban_duration:month")
+	h.waitMessage(adminGroupID, "@username")
+	h.server.SendText(adminGroup, admin, "@cheater")
+	h.waitMessage(adminGroupID, "напишите причину")
+	h.server.SendText(adminGroup, admin, "два аккаунта")
+
+	h.waitMessage(adminGroupID, "удалён из списка турнира")
+	h.waitMessage(user.ID, "два аккаунта")
+
+	banned, err := h.bot.Users.GetByChatID(user.ID)
+	if err != nil {
+		t.Fatalf("failed to load user: %v", err)
+	}
+	if banned.BannedUntil == nil || !banned.BannedUntil.After(time.Now()) || banned.BanReason != "два аккаунта" {
+		t.Errorf("ban not saved: until %v, reason %q", banned.BannedUntil, banned.BanReason)
+	}
+	if tr, _ := h.bot.Tournament.Get("blitz"); len(tr.List) != 0 {
+		t.Errorf("banned player is still listed: %+v", tr.List)
+	}
+
+	h.server.SendText(mainGroup, user, "/checkin")
+	h.waitMessage(mainGroupID, "забанены")
+}
@@ -2,15 +2,22 @@ package maingroup
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sukalov/mshkbot/internal/bot"
 	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/eligibility"
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/rejoin"
+	"github.com/sukalov/mshkbot/internal/tournament"
 	"github.com/sukalov/mshkbot/internal/types"
 	"github.com/sukalov/mshkbot/internal/utils"
+	"github.com/sukalov/mshkbot/internal/waitlist"
 )
 
 // GetHandlers returns handler set for main group
@@ -25,317 +32,376 @@ func GetHandlers() bot.HandlerSet {
 			handleRegularMessage,
 		},
 		Callbacks: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
-			"action": handleAction,
+			"action":   handleAction,
+			"checkin":  handleCheckInCallback,
+			"checkout": handleCheckOutCallback,
+			"result":   handleResultCallback,
 		},
 	}
 }
 
+// request describes who asked for an action and which message to answer
+type request struct {
+	chatID    int64
+	messageID int
+	user      *tgbotapi.User
+}
+
+func requestFromMessage(message *tgbotapi.Message) request {
+	return request{
+		chatID:    message.Chat.ID,
+		messageID: message.MessageID,
+		user:      message.From,
+	}
+}
+
+// requestFromCallback answers the original command if the picker was pressed by its author
+func requestFromCallback(query *tgbotapi.CallbackQuery) request {
+	req := request{
+		chatID:    query.Message.Chat.ID,
+		messageID: query.Message.MessageID,
+		user:      query.From,
+	}
+	original := query.Message.ReplyToMessage
+	if original != nil && original.From != nil && original.From.ID == query.From.ID {
+		req.messageID = original.MessageID
+	}
+	return req
+}
+
+func (r request) reply(b *bot.Bot, text string) error {
+	return b.ReplyToMessage(r.chatID, r.messageID, text)
+}
+
 func handleHelp(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.Message.Chat.ID, "/checkin — записаться на турнир\n\n/checkout — выход из турнира")
+	return b.SendMessage(update.Message.Chat.ID, "/checkin — записаться на турнир\n\n/checkout — выход из турнира\n\nесли открыто несколько турниров, укажите название после команды или выберите турнир кнопкой")
 }
 
 func handleCheckIn(b *bot.Bot, update tgbotapi.Update) error {
-	user, err := db.GetUser(update.Message.From.ID)
+	req := requestFromMessage(update.Message)
+
+	open := b.Tournament.Open()
+	if len(open) == 0 {
+		return req.reply(b, utils.CheckinUnavailibleMessage())
+	}
+
+	if query := update.Message.CommandArguments(); query != "" {
+		t, exists := b.Tournament.Find(query)
+		if !exists {
+			return req.reply(b, unknownTournamentMessage(query, open))
+		}
+		return checkIn(b, req, t.Metadata.ID)
+	}
+
+	if len(open) == 1 {
+		return checkIn(b, req, open[0].Metadata.ID)
+	}
+
+	return sendTournamentPicker(b, req, "checkin", "на какой турнир записаться?", open)
+}
+
+func handleCheckInCallback(b *bot.Bot, update tgbotapi.Update) error {
+	tournamentID, err := answerPicker(b, update.CallbackQuery)
+	if err != nil {
+		return err
+	}
+	return checkIn(b, requestFromCallback(update.CallbackQuery), tournamentID)
+}
+
+func checkIn(b *bot.Bot, req request, tournamentID string) error {
+	user, err := b.Users.GetUser(req.user.ID)
 	if err != nil {
 		if err.Error() == "user not found" {
-			return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "напишите мне в личку чтобы зарегистрироваться")
+			return req.reply(b, "напишите мне в личку чтобы зарегистрироваться")
 		}
-		return b.SendMessage(update.Message.From.ID, fmt.Sprintf("ошибка: %v. попробуйте ещё раз и если ничего не получается, напишите @sukalov", err))
+		return b.SendMessage(req.user.ID, fmt.Sprintf("ошибка: %v. попробуйте ещё раз и если ничего не получается, напишите @sukalov", err))
 	}
 	if user.State != db.StateCompleted {
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "мы с вами в личке ещё не закончили регистрацию")
+		return req.reply(b, "мы с вами в личке ещё не закончили регистрацию")
 	}
 
 	ctx := context.Background()
 
-	if !b.Tournament.Metadata.Exists {
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, utils.CheckinUnavailibleMessage())
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return req.reply(b, utils.CheckinUnavailibleMessage())
 	}
 
-	userID := int(update.Message.From.ID)
+	userID := int(req.user.ID)
 
-	var existingPlayer *types.Player
-	for _, player := range b.Tournament.List {
-		if player.ID == userID {
-			existingPlayer = &player
-			break
-		}
-	}
+	existingPlayer, isListed := t.GetPlayer(userID)
 
-	fullUser, err := db.GetByChatID(update.Message.From.ID)
+	fullUser, err := b.Users.GetByChatID(req.user.ID)
 	if err != nil {
 		log.Printf("failed to get full user data: %v", err)
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "ошибка при получении данных пользователя")
+		return req.reply(b, "ошибка при получении данных пользователя")
 	}
 
-	if existingPlayer != nil {
-		if existingPlayer.State == types.StateCheckedOut {
-			return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "вы уже вышли, теперь придётся подождать")
+	verdict, err := eligibility.Check(b, fullUser, t.Metadata)
+	if err != nil {
+		log.Printf("failed to check eligibility of user %d: %v", userID, err)
+		return req.reply(b, "ошибка при проверке допуска к турниру, попробуйте ещё раз")
+	}
+	if !verdict.Allowed {
+		if isListed && eligibility.IsBanned(fullUser, time.Now()) {
+			if _, err := eligibility.EnforceBan(b, fullUser.ChatID); err != nil {
+				log.Printf("failed to enforce ban for user %d: %v", userID, err)
+			}
 		}
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, utils.AlreadyCheckedInMessage())
+		return req.reply(b, verdict.Reason)
 	}
 
-	lichessRatingLimit := b.Tournament.Metadata.LichessRatingLimit
-	chesscomRatingLimit := b.Tournament.Metadata.ChesscomRatingLimit
-	isGreenTournament := (lichessRatingLimit > 0 && lichessRatingLimit <= 1600) || (chesscomRatingLimit > 0 && chesscomRatingLimit <= 1400)
-
-	if isGreenTournament {
-		if fullUser.NotGreenUntil != nil && time.Now().Before(*fullUser.NotGreenUntil) {
-			return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "вам нельзя в этом турнире играть")
+	if isListed {
+		if existingPlayer.State != types.StateCheckedOut {
+			return req.reply(b, utils.AlreadyCheckedInMessage())
+		}
+		if refusal, refused := rejoinRefusal(t.Metadata.RejoinPolicy, existingPlayer, time.Now()); refused {
+			return req.reply(b, refusal)
 		}
 	}
 
-	var peakRating *types.PeakRating
+	var peakRatings []types.PeakRating
 
-	if fullUser.Lichess != nil {
-		lichessPeakRatings, err := utils.GetLichessAllTimeHigh(*fullUser.Lichess)
+	for _, account := range []peakAccount{
+		{site: types.SiteLichess, name: "личесе", username: fullUser.Lichess, provider: b.Ratings.Lichess, limit: t.Metadata.LichessRatingLimit},
+		{site: types.SiteChesscom, name: "чесскоме", username: fullUser.ChessCom, provider: b.Ratings.ChessCom, limit: t.Metadata.ChesscomRatingLimit},
+	} {
+		if account.username == nil {
+			continue
+		}
+		history, err := account.provider.History(ctx, *account.username)
 		if err != nil {
-			log.Printf("failed to get lichess peak ratings for user %d: %v", userID, err)
-		} else {
-			lichessRatingLimit := b.Tournament.Metadata.LichessRatingLimit
-			if lichessRatingLimit != 0 {
-				if lichessPeakRatings.Blitz >= lichessRatingLimit ||
-					lichessPeakRatings.Rapid >= lichessRatingLimit ||
-					lichessPeakRatings.Classical >= lichessRatingLimit {
-					return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "ваш пиковый рейтинг на личесе превышает лимит турнира")
-				}
-			}
-			peakRating = &types.PeakRating{
-				Site:         types.SiteLichess,
-				BlitzPeak:    lichessPeakRatings.Blitz,
-				SiteUsername: *fullUser.Lichess,
-			}
+			log.Printf("failed to get %s peak ratings for user %d: %v", account.site, userID, err)
+			continue
 		}
-	}
 
-	if fullUser.ChessCom != nil {
-		chesscomPeakRatings, err := utils.GetChessComAllTimeHigh(*fullUser.ChessCom)
-		if err != nil {
-			log.Printf("failed to get chesscom peak ratings for user %d: %v", userID, err)
-		} else {
-			chesscomRatingLimit := b.Tournament.Metadata.ChesscomRatingLimit
-			if chesscomRatingLimit != 0 {
-				if chesscomPeakRatings.Blitz >= chesscomRatingLimit ||
-					chesscomPeakRatings.Rapid >= chesscomRatingLimit ||
-					chesscomPeakRatings.Classical >= chesscomRatingLimit {
-					return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "ваш пиковый рейтинг на чесскоме превышает лимит турнира")
-				}
-			}
-			peakRating = &types.PeakRating{
-				Site:         types.SiteChesscom,
-				BlitzPeak:    chesscomPeakRatings.Blitz,
-				SiteUsername: *fullUser.ChessCom,
+		peaks := t.Metadata.PeakPolicy.Peaks(history, time.Now())
+		if account.limit != 0 {
+			if over := peaks.Over(account.limit); len(over) > 0 {
+				log.Printf("user %d rejected from tournament %s by %s peaks %v", userID, tournamentID, account.site, over)
+				return req.reply(b, peakRejection(account, t.Metadata.PeakPolicy, over))
 			}
 		}
-	}
-
-	limit := b.Tournament.Metadata.Limit
-	activePlayers := countActivePlayers(b.Tournament.List)
-
-	var state string
-	if limit > 0 && activePlayers >= limit {
-		state = types.StateQueued
-	} else {
-		state = types.StateInTournament
+		all := ratings.AllPools.Peaks(history, time.Now())
+		peakRatings = append(peakRatings, types.PeakRating{
+			Site:         account.site,
+			BlitzPeak:    all[ratings.Blitz].Rating,
+			SiteUsername: *account.username,
+			Peaks:        all,
+		})
 	}
 
 	newPlayer := types.Player{
-		ID:         userID,
-		Username:   fullUser.Username,
-		SavedName:  fullUser.SavedName,
-		TimeAdded:  time.Now().UTC(),
-		State:      state,
-		PeakRating: peakRating,
+		ID:          userID,
+		Username:    fullUser.Username,
+		SavedName:   fullUser.SavedName,
+		TimeAdded:   time.Now().UTC(),
+		PeakRatings: peakRatings,
 	}
 
-	b.Tournament.AddPlayer(ctx, newPlayer)
-	log.Printf("user %d (%s) checked in to tournament", userID, fullUser.Username)
+	// the list may have changed while the ratings were fetched, CheckIn decides on the current one
+	outcome, listed, err := b.Tournament.CheckIn(ctx, tournamentID, newPlayer)
+	if err != nil {
+		log.Printf("failed to add user %d to tournament %s: %v", userID, tournamentID, err)
+		return req.reply(b, "ошибка при записи на турнир")
+	}
+	switch outcome {
+	case tournament.AlreadyLeft, tournament.RejoinForbidden:
+		// the policy may have changed since t was read, CheckIn went by the current one
+		refusal, refused := rejoinRefusal(t.Metadata.RejoinPolicy, listed, time.Now())
+		if !refused {
+			refusal = "вы вышли из турнира, попробуйте записаться ещё раз"
+		}
+		return req.reply(b, refusal)
+	case tournament.AlreadyListed:
+		return req.reply(b, utils.AlreadyCheckedInMessage())
+	}
+	log.Printf("user %d (%s) checked in to tournament %s as %s", userID, fullUser.Username, tournamentID, listed.State)
 
-	if err := db.IncrementTimesPlayed(update.Message.From.ID); err != nil {
+	if err := b.Users.IncrementTimesPlayed(req.user.ID); err != nil {
 		log.Printf("failed to increment times played for user %d: %v", userID, err)
 	}
 
-	if err := updateAnnouncementMessage(b, update.Message.Chat.ID); err != nil {
+	if err := b.UpdateAnnouncementMessage(tournamentID); err != nil {
 		log.Printf("failed to update announcement message: %v", err)
 	}
 
-	if state == types.StateQueued {
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "места закончились, добавили вас в очередь")
+	if outcome == tournament.Queued {
+		return req.reply(b, "места закончились, добавили вас в очередь")
 	}
-	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.ApproveEmoji())
+	return b.GiveReaction(req.chatID, req.messageID, utils.ApproveEmoji())
 }
 
-func handleCheckOut(b *bot.Bot, update tgbotapi.Update) error {
-	ctx := context.Background()
-
-	if !b.Tournament.Metadata.Exists {
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, utils.NoTournamentMessage())
+// rejoinRefusal tells a player who checked out why they may not check in again now
+// and, if they may later, exactly when. reports false if they may come back right away
+func rejoinRefusal(policy rejoin.Policy, player types.Player, now time.Time) (string, bool) {
+	if policy.Forbidden {
+		return "вы вышли из турнира, вернуться в него нельзя", true
 	}
-
-	userID := int(update.Message.From.ID)
-
-	var currentPlayer *types.Player
-	for _, player := range b.Tournament.List {
-		if player.ID == userID {
-			currentPlayer = &player
-			break
-		}
+	if !policy.Allows(player.Checkouts) {
+		return fmt.Sprintf("вы вышли из турнира %d раз, больше вернуться нельзя", player.Checkouts), true
 	}
 
-	if currentPlayer == nil {
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "вы не записаны на турнир")
+	rejoinAt := policy.RejoinAt(player.CheckedOutTime)
+	if !now.Before(rejoinAt) {
+		return "", false
 	}
-
-	if currentPlayer.State == types.StateCheckedOut {
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "вы уже отписались")
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+	layout := "в 15:04"
+	if rejoinAt.In(moscowTZ).YearDay() != now.In(moscowTZ).YearDay() {
+		layout = "02.01 в 15:04"
 	}
+	return fmt.Sprintf("вы уже вышли, записаться снова можно %s", rejoinAt.In(moscowTZ).Format(layout)), true
+}
 
-	wasInTournament := currentPlayer.State == types.StateInTournament
-
-	updatedPlayer := *currentPlayer
-	updatedPlayer.State = types.StateCheckedOut
-	updatedPlayer.CheckedOutTime = time.Now().UTC()
+// peakAccount is a linked rating site account with the tournament limit for that site
+type peakAccount struct {
+	site     string
+	name     string
+	username *string
+	provider ratings.Provider
+	limit    int
+}
 
-	if err := b.Tournament.EditPlayer(ctx, userID, updatedPlayer); err != nil {
-		log.Printf("failed to check out player: %v", err)
-		return b.ReplyToMessage(update.Message.Chat.ID, update.Message.MessageID, "ошибка при отписке")
+// peakRejection tells the player which of their peaks are over the limit and what counts
+func peakRejection(account peakAccount, policy ratings.Policy, over []ratings.Peak) string {
+	lines := make([]string, 0, len(over))
+	for _, peak := range over {
+		lines = append(lines, peak.String())
 	}
+	return fmt.Sprintf("ваш пиковый рейтинг на %s превышает лимит турнира (%d):\n%s\n\nучитываются: %s",
+		account.name, account.limit, strings.Join(lines, "\n"), policy)
+}
 
-	log.Printf("user %d checked out from tournament", userID)
+func handleCheckOut(b *bot.Bot, update tgbotapi.Update) error {
+	req := requestFromMessage(update.Message)
 
-	if err := db.DecrementTimesPlayed(update.Message.From.ID); err != nil {
-		log.Printf("failed to decrement times played for user %d: %v", userID, err)
+	open := b.Tournament.Open()
+	if len(open) == 0 {
+		return req.reply(b, utils.NoTournamentMessage())
 	}
 
-	if wasInTournament {
-		if err := promoteQueuedPlayer(b, ctx); err != nil {
-			log.Printf("failed to promote queued player: %v", err)
+	if query := update.Message.CommandArguments(); query != "" {
+		t, exists := b.Tournament.Find(query)
+		if !exists {
+			return req.reply(b, unknownTournamentMessage(query, open))
 		}
+		return checkOut(b, req, t.Metadata.ID)
 	}
 
-	if err := updateAnnouncementMessage(b, update.Message.Chat.ID); err != nil {
-		log.Printf("failed to update announcement message: %v", err)
+	// only offer tournaments the player has not left yet
+	userID := int(req.user.ID)
+	var registered []tournament.Tournament
+	for _, t := range open {
+		if player, exists := t.GetPlayer(userID); exists && player.State != types.StateCheckedOut {
+			registered = append(registered, t)
+		}
 	}
 
-	go schedulePlayerCleanup(b, userID, 15*time.Minute)
-
-	return b.GiveReaction(update.Message.Chat.ID, update.Message.MessageID, utils.SadEmoji())
+	switch len(registered) {
+	case 0:
+		return req.reply(b, "вы не записаны на турнир")
+	case 1:
+		return checkOut(b, req, registered[0].Metadata.ID)
+	default:
+		return sendTournamentPicker(b, req, "checkout", "из какого турнира выйти?", registered)
+	}
 }
 
-func handleRegularMessage(b *bot.Bot, update tgbotapi.Update) error {
-	if update.Message == nil {
-		return nil
+func handleCheckOutCallback(b *bot.Bot, update tgbotapi.Update) error {
+	tournamentID, err := answerPicker(b, update.CallbackQuery)
+	if err != nil {
+		return err
 	}
-	log.Printf("main group message: %s", update.Message.Text)
-	return nil
+	return checkOut(b, requestFromCallback(update.CallbackQuery), tournamentID)
 }
 
-func handleAction(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.CallbackQuery.Message.Chat.ID, "action in main group")
-}
+func checkOut(b *bot.Bot, req request, tournamentID string) error {
+	ctx := context.Background()
 
-func countActivePlayers(players []types.Player) int {
-	count := 0
-	for _, player := range players {
-		if player.State == types.StateInTournament || player.State == types.StateQueued {
-			count++
-		}
+	if _, exists := b.Tournament.Get(tournamentID); !exists {
+		return req.reply(b, utils.NoTournamentMessage())
 	}
-	return count
-}
-
-func schedulePlayerCleanup(b *bot.Bot, playerID int, delay time.Duration) {
-	time.Sleep(delay)
 
-	ctx := context.Background()
+	userID := int(req.user.ID)
 
-	var shouldRemove bool
-	for _, player := range b.Tournament.List {
-		if player.ID == playerID && player.State == types.StateCheckedOut {
-			shouldRemove = true
-			break
-		}
+	result, err := b.Tournament.CheckOut(ctx, tournamentID, userID)
+	switch {
+	case errors.Is(err, tournament.ErrNotListed):
+		return req.reply(b, "вы не записаны на турнир")
+	case errors.Is(err, tournament.ErrAlreadyCheckedOut):
+		return req.reply(b, "вы уже отписались")
+	case err != nil:
+		log.Printf("failed to check out player: %v", err)
+		return req.reply(b, "ошибка при отписке")
 	}
 
-	if shouldRemove {
-		if err := b.Tournament.RemovePlayer(ctx, playerID); err != nil {
-			log.Printf("failed to cleanup checked-out player %d: %v", playerID, err)
-			return
-		}
+	log.Printf("user %d checked out from tournament %s", userID, tournamentID)
 
-		log.Printf("cleaned up checked-out player %d after %v", playerID, delay)
+	if err := b.Users.DecrementTimesPlayed(req.user.ID); err != nil {
+		log.Printf("failed to decrement times played for user %d: %v", userID, err)
 	}
-}
 
-func updateAnnouncementMessage(b *bot.Bot, chatID int64) error {
-	announcementMessageID := b.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID == 0 {
-		return nil
+	if result.Promoted != nil {
+		waitlist.Offer(b, tournamentID, *result.Promoted)
 	}
 
-	messageIntro := b.Tournament.Metadata.AnnouncementIntro
-	if messageIntro == "" {
-		messageIntro = "ТУРНИР НАЧАЛСЯ!!!"
+	if err := b.UpdateAnnouncementMessage(tournamentID); err != nil {
+		log.Printf("failed to update announcement message: %v", err)
 	}
 
-	message := buildTournamentListMessage(b, messageIntro)
+	waitlist.ScheduleCleanup(b, tournamentID, userID, time.Now().UTC())
 
-	return b.EditMessage(chatID, announcementMessageID, message)
+	return b.GiveReaction(req.chatID, req.messageID, utils.SadEmoji())
 }
 
-func promoteQueuedPlayer(b *bot.Bot, ctx context.Context) error {
-	var firstQueuedPlayer *types.Player
-
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateQueued {
-			firstQueuedPlayer = &player
-			break
-		}
+// sendTournamentPicker asks which tournament the command is meant for
+func sendTournamentPicker(b *bot.Bot, req request, action string, text string, tournaments []tournament.Tournament) error {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, t := range tournaments {
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(t.DisplayName(), fmt.Sprintf("%s:%s", action, t.Metadata.ID)),
+		))
 	}
 
-	if firstQueuedPlayer == nil {
-		return nil
-	}
-
-	updatedPlayer := *firstQueuedPlayer
-	updatedPlayer.State = types.StateInTournament
-
-	if err := b.Tournament.EditPlayer(ctx, firstQueuedPlayer.ID, updatedPlayer); err != nil {
-		return fmt.Errorf("failed to promote player: %w", err)
-	}
+	msg := tgbotapi.NewMessage(req.chatID, text)
+	msg.ReplyToMessageID = req.messageID
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 
-	log.Printf("promoted player %d (%s) from queue to tournament", firstQueuedPlayer.ID, firstQueuedPlayer.Username)
-	return nil
+	_, err := b.Send(msg)
+	return err
 }
 
-func buildTournamentListMessage(b *bot.Bot, messageIntro string) string {
-	message := fmt.Sprintf("%s\n\nучастники:\n", messageIntro)
-
-	count := 1
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateInTournament {
-			message += fmt.Sprintf("%d. %s\n", count, player.SavedName)
-			count++
-		}
+// answerPicker acknowledges a picker button and returns the chosen tournament id
+func answerPicker(b *bot.Bot, query *tgbotapi.CallbackQuery) (string, error) {
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Request(callback); err != nil {
+		log.Printf("failed to answer callback: %v", err)
 	}
 
-	if count == 1 {
-		message += "пока никого нет\n"
+	parts := strings.SplitN(query.Data, ":", 2)
+	if len(parts) < 2 || parts[1] == "" {
+		return "", fmt.Errorf("invalid callback data: %s", query.Data)
 	}
+	return parts[1], nil
+}
 
-	queuedPlayers := []types.Player{}
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateQueued {
-			queuedPlayers = append(queuedPlayers, player)
-		}
+func unknownTournamentMessage(query string, open []tournament.Tournament) string {
+	names := make([]string, 0, len(open))
+	for _, t := range open {
+		names = append(names, t.DisplayName())
 	}
+	return fmt.Sprintf("турнир «%s» не найден. открыты: %s", query, strings.Join(names, ", "))
+}
 
-	if len(queuedPlayers) > 0 {
-		message += "\nочередь:\n"
-		for i, player := range queuedPlayers {
-			message += fmt.Sprintf("%d. %s &#9816;\n", i+1, player.SavedName)
-		}
+func handleRegularMessage(b *bot.Bot, update tgbotapi.Update) error {
+	if update.Message == nil {
+		return nil
 	}
+	log.Printf("main group message: %s", update.Message.Text)
+	return nil
+}
 
-	return message
+func handleAction(b *bot.Bot, update tgbotapi.Update) error {
+	return b.SendMessage(update.CallbackQuery.Message.Chat.ID, "action in main group")
 }
@@ -0,0 +1,91 @@
+package maingroup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/pairing"
+)
+
+// handleResultCallback handles the result buttons under a pairings message.
+// data looks like result:<tournament>:<round>:<board>:<w|d|b>.
+// players report and confirm their own games, admins can set any result
+func handleResultCallback(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	answer := func(text string) error {
+		callback := tgbotapi.NewCallbackWithAlert(query.ID, text)
+		if _, err := b.Request(callback); err != nil {
+			log.Printf("failed to answer callback: %v", err)
+		}
+		return nil
+	}
+
+	parts := strings.Split(query.Data, ":")
+	if len(parts) != 5 {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+	tournamentID := parts[1]
+	number, errRound := strconv.Atoi(parts[2])
+	board, errBoard := strconv.Atoi(parts[3])
+	result, ok := bot.ResultFromCode(parts[4])
+	if errRound != nil || errBoard != nil || !ok {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists || number > len(t.Rounds) {
+		return answer("этот турнир уже закончился")
+	}
+
+	ctx := context.Background()
+	playerID := int(query.From.ID)
+
+	game, outcome, err := b.Tournament.ReportResult(ctx, tournamentID, number, board, playerID, result)
+	switch {
+	case errors.Is(err, pairing.ErrNotInGame) && b.IsAdmin(query.From.ID):
+		previous, _ := t.Game(number, board)
+		if _, err := b.Tournament.OverrideResult(ctx, tournamentID, number, board, result); err != nil {
+			return err
+		}
+		log.Printf("admin %d set result %s on board %d of round %d in tournament %s", playerID, result, board, number, tournamentID)
+		b.Audit(db.AuditEvent{
+			ActorID: query.From.ID,
+			Action:  "game.set_result",
+			Target:  fmt.Sprintf("%s, тур %d, доска %d", tournamentID, number, board),
+			Before:  string(previous.Result),
+			After:   string(result),
+		})
+		outcome = pairing.ReportConfirmed
+		err = answer("результат записан")
+	case errors.Is(err, pairing.ErrNotInGame):
+		return answer("это не ваша партия")
+	case errors.Is(err, pairing.ErrResultIsFinal):
+		return answer("результат уже подтверждён. если он неверный, напишите судье")
+	case err != nil:
+		return err
+	case outcome == pairing.ReportConfirmed:
+		log.Printf("result %s on board %d of round %d in tournament %s confirmed by %d", game.Result, board, number, tournamentID, playerID)
+		err = answer("результат подтверждён")
+	case outcome == pairing.ReportDisputed:
+		err = answer("соперник указал другой результат. договоритесь или позовите судью")
+	default:
+		err = answer("ждём подтверждения от соперника")
+	}
+
+	if err := b.UpdatePairingsMessage(tournamentID, number); err != nil {
+		log.Printf("failed to update pairings message: %v", err)
+	}
+	if outcome == pairing.ReportConfirmed {
+		if err := b.UpdateStandingsMessage(tournamentID); err != nil {
+			log.Printf("failed to update standings message: %v", err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package privatechat
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+)
+
+// claimedByOther tells the user and the admins when the account is already linked to someone else.
+// reports true if it was, so the caller must not save the username
+func claimedByOther(b *bot.Bot, chatID int64, site, title, username string) (bool, error) {
+	owner, claimed, err := b.Users.FindAccountOwner(site, username, chatID)
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		return false, nil
+	}
+
+	user, err := b.Users.GetByChatID(chatID)
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("user %d tried to link %s account %s owned by %d", user.ChatID, site, username, owner.ChatID)
+
+	notice := fmt.Sprintf("конфликт аккаунтов: %s указывает %s %s, который уже привязан к %s", userLabel(user), title, username, userLabel(owner))
+	if owner.Verified(site) {
+		notice += ". владелец подтвердил аккаунт"
+	}
+	if err := b.NotifyAdmins(notice); err != nil {
+		log.Printf("failed to notify admins about account conflict: %v", err)
+	}
+
+	return true, b.SendMessage(user.ChatID, fmt.Sprintf("аккаунт %s на %s уже указан другим участником клуба. мы сообщили администраторам, они разберутся. если ошиблись, введите другой юзернейм", username, title))
+}
+
+func userLabel(u db.User) string {
+	name := u.TgName
+	if u.Username != "" {
+		name = "@" + u.Username
+	}
+	if u.SavedName != "" {
+		name += fmt.Sprintf(" «%s»", u.SavedName)
+	}
+	return fmt.Sprintf("%s (%d)", name, u.ChatID)
+}
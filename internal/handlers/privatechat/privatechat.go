@@ -2,13 +2,16 @@ package privatechat
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/sukalov/mshkbot/internal/bot"
 	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/ratings"
 	"github.com/sukalov/mshkbot/internal/types"
 	"github.com/sukalov/mshkbot/internal/utils"
 )
@@ -21,13 +24,19 @@ func GetHandlers() bot.HandlerSet {
 			"help":            handleHelp,
 			"me":              handleMe,
 			"myratings":       handleMyRatings,
+			"myrating":        handleMyClubRating,
 			"change_nickname": handleChangeNickname,
+			"verify":          handleVerify,
 		},
 		Messages: []func(b *bot.Bot, update tgbotapi.Update) error{
 			handlePrivateMessage,
 		},
 		Callbacks: map[string]func(b *bot.Bot, update tgbotapi.Update) error{
-			"register": handleRegister,
+			"register":          handleRegister,
+			"promotion_confirm": handlePromotionAnswer,
+			"promotion_decline": handlePromotionAnswer,
+			"verify":            handleVerifyCallback,
+			"verify_check":      handleVerifyCallback,
 		},
 	}
 }
@@ -36,7 +45,7 @@ func handleStart(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
 
 	// Get or create user in one operation
-	user, isNew, err := db.GetOrCreateUser(update)
+	user, isNew, err := b.Users.GetOrCreateUser(update)
 	if err != nil {
 		log.Printf("failed to get/create user: %v", err)
 		return err
@@ -91,7 +100,7 @@ func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите ваш никнейм на lichess:"); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateAskedLichess); err != nil {
+		if err := b.Users.UpdateState(chatID, db.StateAskedLichess); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
@@ -99,7 +108,7 @@ func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите ваш никнейм на chess.com:"); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateAskedChessCom); err != nil {
+		if err := b.Users.UpdateState(chatID, db.StateAskedChessCom); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
@@ -107,7 +116,7 @@ func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 		if err := b.EditMessage(chatID, update.CallbackQuery.Message.MessageID, "введите ваш псевдоним для турниров:"); err != nil {
 			return fmt.Errorf("failed to edit message: %w", err)
 		}
-		if err := db.UpdateState(chatID, db.StateAskedSavedName); err != nil {
+		if err := b.Users.UpdateState(chatID, db.StateAskedSavedName); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
@@ -119,23 +128,34 @@ func handleRegister(b *bot.Bot, update tgbotapi.Update) error {
 }
 
 func handleHelp(b *bot.Bot, update tgbotapi.Update) error {
-	return b.SendMessage(update.Message.Chat.ID, "/help — показать это сообщение\n\n/me — показать вашу информацию\n\n/myratings — показать пиковые рейтинги\n\n/change_nickname — изменить никнейм для турниров")
+	return b.SendMessage(update.Message.Chat.ID, "/help — показать это сообщение\n\n/me — показать вашу информацию\n\n/myratings — показать пиковые рейтинги\n\n/myrating — клубный рейтинг и его история\n\n/change_nickname — изменить никнейм для турниров\n\n/verify — подтвердить, что аккаунт на личесе или чесскоме ваш")
 }
 
 func handleMe(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
 
-	if user, err := db.GetByChatID(chatID); err != nil {
+	user, err := b.Users.GetByChatID(chatID)
+	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	message := db.Stringify(user)
+	if attended, err := db.CountAttendance(chatID); err != nil {
+		log.Printf("failed to count attendance for user %d: %v", chatID, err)
 	} else {
-		return b.SendMessageWithMarkdown(chatID, db.Stringify(user), true)
+		message += fmt.Sprintf("сыграно турниров: %d\n", attended)
 	}
+	if clubRating, rated := db.ClubRating(user); rated {
+		message += fmt.Sprintf("клубный рейтинг: %d\n", clubRating)
+	}
+
+	return b.SendMessageWithMarkdown(chatID, message, true)
 }
 
 func handleMyRatings(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
 	var lichess, chesscom string
-	if user, err := db.GetByChatID(chatID); err != nil {
+	if user, err := b.Users.GetByChatID(chatID); err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	} else {
 
@@ -147,19 +167,19 @@ func handleMyRatings(b *bot.Bot, update tgbotapi.Update) error {
 		}
 
 		if user.Lichess != nil {
-			lichessTopRatings, err := utils.GetLichessAllTimeHigh(*user.Lichess)
+			history, err := b.Ratings.Lichess.History(context.Background(), *user.Lichess)
 			if err != nil {
 				return fmt.Errorf("ошибка при запросе к базе личеса: %w", err)
 			}
 
-			lichess = fmt.Sprintf("пиковые рейтинги на личесе: блиц %d, рапид %d, классика %d", lichessTopRatings.Blitz, lichessTopRatings.Rapid, lichessTopRatings.Classical)
+			lichess = fmt.Sprintf("пиковые рейтинги на личесе: %s", ratings.AllPools.Peaks(history, time.Now()))
 		}
 		if user.ChessCom != nil {
-			chesscomTopRatings, err := utils.GetChessComAllTimeHigh(*user.ChessCom)
+			history, err := b.Ratings.ChessCom.History(context.Background(), *user.ChessCom)
 			if err != nil {
 				return fmt.Errorf("ошибка при запросе к базе чесскома: %w", err)
 			}
-			chesscom = fmt.Sprintf("пиковые рейтинги на чесскоме: блиц %d, рапид %d, классика %d", chesscomTopRatings.Blitz, chesscomTopRatings.Rapid, chesscomTopRatings.Classical)
+			chesscom = fmt.Sprintf("пиковые рейтинги на чесскоме: %s", ratings.AllPools.Peaks(history, time.Now()))
 		}
 
 		return b.SendMessage(chatID, fmt.Sprintf("%s\n%s", lichess, chesscom))
@@ -169,7 +189,7 @@ func handleMyRatings(b *bot.Bot, update tgbotapi.Update) error {
 func handleChangeNickname(b *bot.Bot, update tgbotapi.Update) error {
 	chatID := update.Message.Chat.ID
 
-	user, err := db.GetByChatID(chatID)
+	user, err := b.Users.GetByChatID(chatID)
 	if err != nil {
 		return fmt.Errorf("failed to get user: %w", err)
 	}
@@ -178,7 +198,7 @@ func handleChangeNickname(b *bot.Bot, update tgbotapi.Update) error {
 		return b.SendMessage(chatID, "у вас ещё нет сохранённого никнейма")
 	}
 
-	if err := db.UpdateState(chatID, db.StateEditingSavedName); err != nil {
+	if err := b.Users.UpdateState(chatID, db.StateEditingSavedName); err != nil {
 		return fmt.Errorf("failed to update state: %w", err)
 	}
 
@@ -192,7 +212,7 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 
 	chatID := update.Message.Chat.ID
 
-	user, err := db.GetUser(chatID) // DB CALL 1
+	user, err := b.Users.GetUser(chatID) // DB CALL 1
 	if err != nil {
 		log.Printf("failed to get user state: %v", err)
 		return nil
@@ -205,20 +225,28 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 			return b.SendMessage(chatID, "юзернейм не может быть пустым")
 		}
 
-		allTimeHigh, err := utils.GetLichessAllTimeHigh(username)
+		history, err := b.Ratings.Lichess.History(context.Background(), username)
+		if errors.Is(err, ratings.ErrNotFound) {
+			return b.SendMessage(chatID, "такого аккаунта на личесе нет, проверьте юзернейм")
+		}
 		if err != nil {
+			log.Printf("failed to get lichess peak ratings for %s: %v", username, err)
 			return b.SendMessage(chatID, "произошла ошибка, попробуйте ещё раз")
 		}
-		log.Printf("all time high: %d", allTimeHigh)
+		log.Printf("all time high: %v", ratings.AllPools.Peaks(history, time.Now()))
+
+		if claimed, err := claimedByOther(b, chatID, types.SiteLichess, "lichess", username); claimed || err != nil {
+			return err
+		}
 
 		// save the username
-		if err := db.UpdateLichess(chatID, username); err != nil { // DB CALL 2
+		if err := b.Users.UpdateLichess(chatID, username); err != nil { // DB CALL 2
 			log.Printf("failed to update lichess username: %v", err)
 			return b.SendMessage(chatID, fmt.Sprintf("произошла ошибка, попробуйте ещё раз: %v", err))
 		}
 
 		// ask for saved name
-		if err := db.UpdateState(chatID, db.StateAskedSavedName); err != nil { // DB CALL 3
+		if err := b.Users.UpdateState(chatID, db.StateAskedSavedName); err != nil { // DB CALL 3
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
@@ -230,14 +258,18 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 			return b.SendMessage(chatID, "юзернейм не может быть пустым")
 		}
 
+		if claimed, err := claimedByOther(b, chatID, types.SiteChesscom, "chess.com", username); claimed || err != nil {
+			return err
+		}
+
 		// save the username
-		if err := db.UpdateChessCom(chatID, username); err != nil {
+		if err := b.Users.UpdateChessCom(chatID, username); err != nil {
 			log.Printf("failed to update lichess username: %v", err)
 			return b.SendMessage(chatID, "произошла ошибка, попробуйте еще раз")
 		}
 
 		// ask for saved name
-		if err := db.UpdateState(chatID, db.StateAskedSavedName); err != nil {
+		if err := b.Users.UpdateState(chatID, db.StateAskedSavedName); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
@@ -250,16 +282,16 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 			return b.SendMessage(chatID, "никнейм не может быть пустым")
 		}
 
-		if err := db.UpdateSavedName(chatID, savedName); err != nil {
+		if err := b.Users.UpdateSavedName(chatID, savedName); err != nil {
 			log.Printf("failed to update saved name: %v", err)
 			return b.SendMessage(chatID, "произошла ошибка, попробуйте еще раз")
 		}
 
-		if err := db.UpdateState(chatID, db.StateCompleted); err != nil {
+		if err := b.Users.UpdateState(chatID, db.StateCompleted); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
-		return b.SendMessage(chatID, fmt.Sprintf("отлично! регистрация завершена. ваш никнейм: %s\n\nтеперь можете записываться на турниры в чате @moscowchessclub", savedName))
+		return b.SendMessage(chatID, fmt.Sprintf("отлично! регистрация завершена. ваш никнейм: %s\n\nтеперь можете записываться на турниры в чате @moscowchessclub\n\nв некоторые турниры пускают только с подтверждённым аккаунтом, подтвердить его можно командой /verify", savedName))
 
 	case db.StateEditingSavedName:
 		newName := utils.Transliterate(update.Message.Text)
@@ -268,12 +300,12 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 			return b.SendMessage(chatID, "никнейм не может быть пустым")
 		}
 
-		if err := db.UpdateSavedName(chatID, newName); err != nil {
+		if err := b.Users.UpdateSavedName(chatID, newName); err != nil {
 			log.Printf("failed to update saved name: %v", err)
 			return b.SendMessage(chatID, "произошла ошибка, попробуйте еще раз")
 		}
 
-		if err := db.UpdateState(chatID, db.StateCompleted); err != nil {
+		if err := b.Users.UpdateState(chatID, db.StateCompleted); err != nil {
 			return fmt.Errorf("failed to update state: %w", err)
 		}
 
@@ -281,7 +313,7 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 			return err
 		}
 
-		if err := updateTournamentPlayerName(b, int(chatID), newName); err != nil {
+		if err := b.RenamePlayer(int(chatID), newName); err != nil {
 			log.Printf("failed to update tournament player name: %v", err)
 		}
 
@@ -294,81 +326,33 @@ func handlePrivateMessage(b *bot.Bot, update tgbotapi.Update) error {
 	return nil
 }
 
-func updateTournamentPlayerName(b *bot.Bot, playerID int, newName string) error {
-	ctx := context.Background()
-
-	if !b.Tournament.Metadata.Exists {
-		return nil
-	}
-
-	var currentPlayer *types.Player
-	for _, player := range b.Tournament.List {
-		if player.ID == playerID {
-			currentPlayer = &player
-			break
-		}
-	}
-
-	if currentPlayer == nil {
-		return nil
-	}
-
-	updatedPlayer := *currentPlayer
-	updatedPlayer.SavedName = newName
-
-	if err := b.Tournament.EditPlayer(ctx, playerID, updatedPlayer); err != nil {
-		return fmt.Errorf("failed to update player in tournament: %w", err)
-	}
-
-	log.Printf("updated player %d name to %s in tournament", playerID, newName)
-
-	announcementMessageID := b.Tournament.Metadata.AnnouncementMessageID
-	if announcementMessageID == 0 {
-		return nil
-	}
-
-	messageIntro := b.Tournament.Metadata.AnnouncementIntro
-	if messageIntro == "" {
-		messageIntro = "запись на турнир открыта"
-	}
-
-	message := buildTournamentListMessage(b, messageIntro)
-	if err := b.EditMessage(b.GetMainGroupID(), announcementMessageID, message); err != nil {
-		return fmt.Errorf("failed to update announcement message: %w", err)
-	}
-
-	log.Printf("updated announcement message after name change")
-	return nil
-}
-
-func buildTournamentListMessage(b *bot.Bot, messageIntro string) string {
-	message := fmt.Sprintf("%s\n\nучастники:\n", messageIntro)
+func handleMyClubRating(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
 
-	count := 1
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateInTournament {
-			message += fmt.Sprintf("%d. %s\n", count, player.SavedName)
-			count++
-		}
+	user, err := b.Users.GetByChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
 	}
 
-	if count == 1 {
-		message += "пока никого нет\n"
+	clubRating, rated := db.ClubRating(user)
+	if !rated {
+		return b.SendMessage(chatID, fmt.Sprintf("у вас пока нет партий в клубном рейтинге, стартовый рейтинг — %d", clubRating))
 	}
 
-	queuedPlayers := []types.Player{}
-	for _, player := range b.Tournament.List {
-		if player.State == types.StateQueued {
-			queuedPlayers = append(queuedPlayers, player)
-		}
+	history, err := db.GetRatingHistory(chatID, 10)
+	if err != nil {
+		return err
 	}
 
-	if len(queuedPlayers) > 0 {
-		message += "\nочередь:\n"
-		for i, player := range queuedPlayers {
-			message += fmt.Sprintf("%d. %s &#9816;\n", i+1, player.SavedName)
+	message := fmt.Sprintf("клубный рейтинг: %d (партий: %d)\n", clubRating, user.ClubGames)
+	if len(history) > 0 {
+		message += "\nпоследние изменения:\n"
+		moscowTZ := time.FixedZone("moscow", 3*60*60)
+		for _, change := range history {
+			message += fmt.Sprintf("%s: %d → %d (%+d, партий: %d)\n",
+				change.CreatedAt.In(moscowTZ).Format("02.01.2006"), change.Before, change.After, change.After-change.Before, change.Games)
 		}
 	}
 
-	return message
+	return b.SendMessage(chatID, message)
 }
@@ -0,0 +1,51 @@
+package privatechat
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/waitlist"
+)
+
+// handlePromotionAnswer handles the buttons of a waitlist confirmation request
+func handlePromotionAnswer(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	chatID := query.Message.Chat.ID
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Request(callback); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	action, tournamentID, ok := strings.Cut(query.Data, ":")
+	if !ok || tournamentID == "" {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+
+	var (
+		valid bool
+		err   error
+		reply string
+	)
+	switch action {
+	case "promotion_confirm":
+		valid, err = waitlist.Confirm(b, tournamentID, int(query.From.ID))
+		reply = "отлично, место за вами!"
+	case "promotion_decline":
+		valid, err = waitlist.Decline(b, tournamentID, int(query.From.ID))
+		reply = "жаль! место передано следующему в очереди"
+	default:
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+	if err != nil {
+		return err
+	}
+	if !valid {
+		reply = "это предложение уже не действует"
+	}
+
+	return b.EditMessage(chatID, query.Message.MessageID, reply)
+}
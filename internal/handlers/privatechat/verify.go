@@ -0,0 +1,169 @@
+package privatechat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/db"
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// linkedAccount is a rating site account of the user with what verification needs to know about it
+type linkedAccount struct {
+	site       string
+	title      string
+	username   string
+	verified   bool
+	provider   ratings.Provider
+	profileURL string
+	where      string
+}
+
+func linkedAccounts(b *bot.Bot, user db.User) []linkedAccount {
+	var accounts []linkedAccount
+	if user.Lichess != nil && *user.Lichess != "" {
+		accounts = append(accounts, linkedAccount{
+			site:       types.SiteLichess,
+			title:      "lichess",
+			username:   *user.Lichess,
+			verified:   user.LichessVerified,
+			provider:   b.Ratings.Lichess,
+			profileURL: "https://lichess.org/account/profile",
+			where:      "в поле «биография» или «местоположение»",
+		})
+	}
+	if user.ChessCom != nil && *user.ChessCom != "" {
+		accounts = append(accounts, linkedAccount{
+			site:       types.SiteChesscom,
+			title:      "chess.com",
+			username:   *user.ChessCom,
+			verified:   user.ChessComVerified,
+			provider:   b.Ratings.ChessCom,
+			profileURL: "https://www.chess.com/settings",
+			where:      "в поле «местоположение»",
+		})
+	}
+	return accounts
+}
+
+func findLinkedAccount(b *bot.Bot, user db.User, site string) (linkedAccount, bool) {
+	for _, account := range linkedAccounts(b, user) {
+		if account.site == site {
+			return account, true
+		}
+	}
+	return linkedAccount{}, false
+}
+
+// handleVerify lists the accounts that can still be verified
+func handleVerify(b *bot.Bot, update tgbotapi.Update) error {
+	chatID := update.Message.Chat.ID
+
+	user, err := b.Users.GetByChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	accounts := linkedAccounts(b, user)
+	if len(accounts) == 0 {
+		return b.SendMessage(chatID, "у вас не указано ни одного аккаунта на личесе или чесскоме")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, account := range accounts {
+		if account.verified {
+			continue
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%s: %s", account.title, account.username), "verify:"+account.site),
+		))
+	}
+	if len(rows) == 0 {
+		return b.SendMessage(chatID, "все ваши аккаунты уже подтверждены")
+	}
+
+	return b.SendMessageWithButtons(chatID, "подтверждение показывает, что аккаунт действительно ваш. без него нельзя играть в некоторых турнирах с лимитом рейтинга. какой аккаунт подтвердить?", tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// handleVerifyCallback handles verify:<site> which issues a token and
+// verify_check:<site> which looks for it in the profile
+func handleVerifyCallback(b *bot.Bot, update tgbotapi.Update) error {
+	query := update.CallbackQuery
+	chatID := query.Message.Chat.ID
+	messageID := query.Message.MessageID
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := b.Request(callback); err != nil {
+		log.Printf("failed to answer callback: %v", err)
+	}
+
+	action, site, ok := strings.Cut(query.Data, ":")
+	if !ok {
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+
+	user, err := b.Users.GetByChatID(chatID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	account, ok := findLinkedAccount(b, user, site)
+	if !ok {
+		return b.EditMessage(chatID, messageID, "этот аккаунт больше не привязан")
+	}
+	if account.verified {
+		return b.EditMessage(chatID, messageID, fmt.Sprintf("%s %s уже подтверждён", account.title, account.username))
+	}
+
+	switch action {
+	case "verify":
+		token, err := ratings.NewToken()
+		if err != nil {
+			return fmt.Errorf("failed to create verification token: %w", err)
+		}
+		if err := b.Users.SetVerificationToken(chatID, token); err != nil {
+			return err
+		}
+		return editWithCheckButton(b, chatID, messageID, account, fmt.Sprintf(
+			"добавьте код %s %s профиля %s на %s (%s) и нажмите «проверить». после проверки код можно удалить",
+			token, account.where, account.username, account.title, account.profileURL))
+
+	case "verify_check":
+		found, err := ratings.Verify(context.Background(), account.provider, account.username, user.VerificationToken)
+		switch {
+		case errors.Is(err, ratings.ErrNotFound):
+			return b.EditMessage(chatID, messageID, fmt.Sprintf("аккаунт %s не найден на %s", account.username, account.title))
+		case err != nil:
+			log.Printf("failed to check %s profile of %s: %v", account.site, account.username, err)
+			return editWithCheckButton(b, chatID, messageID, account, "не получилось открыть профиль, попробуйте ещё раз через минуту")
+		case user.VerificationToken == "":
+			return b.EditMessage(chatID, messageID, "код устарел, начните заново: /verify")
+		case !found:
+			return editWithCheckButton(b, chatID, messageID, account, fmt.Sprintf(
+				"код %s не найден в профиле %s. изменения на сайте бывают видны не сразу, попробуйте ещё раз через пару минут", user.VerificationToken, account.username))
+		}
+
+		if err := b.Users.MarkVerified(chatID, account.site); err != nil {
+			return err
+		}
+		log.Printf("user %d verified %s account %s", chatID, account.site, account.username)
+		return b.EditMessage(chatID, messageID, fmt.Sprintf("%s %s подтверждён! код из профиля можно удалить", account.title, account.username))
+
+	default:
+		return fmt.Errorf("invalid callback data: %s", query.Data)
+	}
+}
+
+func editWithCheckButton(b *bot.Bot, chatID int64, messageID int, account linkedAccount, text string) error {
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, text, tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("проверить", "verify_check:"+account.site)),
+	))
+	edit.DisableWebPagePreview = true
+	_, err := b.Request(edit)
+	return err
+}
@@ -0,0 +1,279 @@
+// Package jobs runs delayed work that has to survive a restart: jobs are kept in a backend
+// until a handler finishes them, and a job whose worker died is handed out again after a lease
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// pollInterval is how often the worker looks for due jobs
+	pollInterval = 5 * time.Second
+	// lease is how long a claimed job is hidden from other workers before it is retried
+	lease = 5 * time.Minute
+	// runTimeout bounds one run of a handler
+	runTimeout = time.Minute
+	// maxAttempts is how many times a failing job runs before it is dropped
+	maxAttempts = 5
+)
+
+// Kind says which handler runs a job
+type Kind string
+
+const (
+	// KindCleanup removes a checked-out player from the list
+	KindCleanup Kind = "cleanup"
+	// KindPromotionDeadline gives the spot of a promoted player who did not confirm to the next in the queue
+	KindPromotionDeadline Kind = "promotion_deadline"
+	// KindPromotionReminder reminds a promoted player to confirm
+	KindPromotionReminder Kind = "promotion_reminder"
+	// KindRestrictionExpiry lifts bans and green suspensions that ran out
+	KindRestrictionExpiry Kind = "restriction_expiry"
+	// KindTournamentEnd closes a tournament whose scheduled end failed to archive it
+	KindTournamentEnd Kind = "tournament_end"
+)
+
+var kindNames = map[Kind]string{
+	KindCleanup:           "убрать вышедшего игрока из списка",
+	KindPromotionDeadline: "срок подтверждения места из очереди",
+	KindPromotionReminder: "напоминание подтвердить место",
+	KindRestrictionExpiry: "снятие истёкших банов и отстранений",
+	KindTournamentEnd:     "повторное закрытие турнира",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return string(k)
+}
+
+// Job is one piece of delayed work. scheduling a job with the ID of a pending one replaces it
+type Job struct {
+	ID           string    `json:"id"`
+	Kind         Kind      `json:"kind"`
+	RunAt        time.Time `json:"run_at"`
+	TournamentID string    `json:"tournament_id,omitempty"`
+	PlayerID     int64     `json:"player_id,omitempty"`
+	// Deadline is the time the job was scheduled for, a handler compares it
+	// with the current state so a stale job does nothing
+	Deadline time.Time `json:"deadline,omitempty"`
+	Attempts int       `json:"attempts,omitempty"`
+}
+
+// ID is the id of the only job of the kind for a player in a tournament
+func ID(kind Kind, tournamentID string, playerID int64) string {
+	return fmt.Sprintf("%s:%s:%d", kind, tournamentID, playerID)
+}
+
+// Backend keeps jobs. Claim returns the jobs due at now and hides them for the lease,
+// Delete removes a job for good. Finish removes a claimed job and Retry replaces it with its next attempt,
+// both only if it was not scheduled again meanwhile
+type Backend interface {
+	Save(ctx context.Context, job Job) error
+	Claim(ctx context.Context, now time.Time, lease time.Duration) ([]Job, error)
+	Finish(ctx context.Context, job Job) error
+	Retry(ctx context.Context, claimed, next Job) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context) ([]Job, error)
+}
+
+// Handler does the work of a job; an error makes the job run again later
+type Handler func(ctx context.Context, job Job) error
+
+// Queue schedules jobs in a backend and runs them with the handlers of their kinds
+type Queue struct {
+	backend  Backend
+	mu       sync.RWMutex
+	handlers map[Kind]Handler
+}
+
+func NewQueue(backend Backend) *Queue {
+	return &Queue{backend: backend, handlers: make(map[Kind]Handler)}
+}
+
+// Handle sets the handler of a kind
+func (q *Queue) Handle(kind Kind, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+// Schedule stores a job to run at job.RunAt, replacing a pending job with the same id
+func (q *Queue) Schedule(job Job) error {
+	if job.ID == "" {
+		return fmt.Errorf("job %s has no id", job.Kind)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return q.backend.Save(ctx, job)
+}
+
+// Cancel drops a pending job, nothing happens if there is none
+func (q *Queue) Cancel(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return q.backend.Delete(ctx, id)
+}
+
+// Pending returns the jobs waiting to run, soonest first
+func (q *Queue) Pending() ([]Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pending, err := q.backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].RunAt.Before(pending[j].RunAt) })
+	return pending, nil
+}
+
+// Run works on due jobs until stop is closed
+func (q *Queue) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.runDue(time.Now())
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (q *Queue) runDue(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	due, err := q.backend.Claim(ctx, now, lease)
+	cancel()
+	if err != nil {
+		log.Printf("failed to claim due jobs: %v", err)
+		return
+	}
+
+	for _, job := range due {
+		q.run(job, now)
+	}
+}
+
+// run calls the handler of the job and deletes it, or schedules a retry with a growing delay
+func (q *Queue) run(job Job, now time.Time) {
+	q.mu.RLock()
+	handler, exists := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	err := fmt.Errorf("no handler for %s", job.Kind)
+	if exists {
+		ctx, cancel := context.WithTimeout(context.Background(), runTimeout)
+		err = handler(ctx, job)
+		cancel()
+	}
+
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := q.backend.Finish(ctx, job); err != nil {
+			log.Printf("failed to delete finished job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	next := job
+	next.Attempts++
+	if next.Attempts >= maxAttempts {
+		log.Printf("job %s failed %d times, dropping it: %v", job.ID, next.Attempts, err)
+		if err := q.backend.Finish(ctx, job); err != nil {
+			log.Printf("failed to delete job %s: %v", job.ID, err)
+		}
+		return
+	}
+
+	next.RunAt = now.Add(time.Duration(next.Attempts) * time.Minute)
+	log.Printf("job %s failed, retrying at %s: %v", job.ID, next.RunAt.Format(time.RFC3339), err)
+	if err := q.backend.Retry(ctx, job, next); err != nil {
+		log.Printf("failed to reschedule job %s: %v", job.ID, err)
+	}
+}
+
+// MemoryBackend keeps jobs in memory, for tests and local runs
+type MemoryBackend struct {
+	mu      sync.Mutex
+	jobs    map[string]Job
+	visible map[string]time.Time
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{jobs: make(map[string]Job), visible: make(map[string]time.Time)}
+}
+
+func (m *MemoryBackend) Save(_ context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jobs[job.ID] = job
+	m.visible[job.ID] = job.RunAt
+	return nil
+}
+
+func (m *MemoryBackend) Claim(_ context.Context, now time.Time, lease time.Duration) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []Job
+	for id, at := range m.visible {
+		if at.After(now) {
+			continue
+		}
+		m.visible[id] = now.Add(lease)
+		due = append(due, m.jobs[id])
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].RunAt.Before(due[j].RunAt) })
+	return due, nil
+}
+
+func (m *MemoryBackend) Finish(_ context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs[job.ID] == job {
+		delete(m.jobs, job.ID)
+		delete(m.visible, job.ID)
+	}
+	return nil
+}
+
+func (m *MemoryBackend) Retry(_ context.Context, claimed, next Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.jobs[claimed.ID] == claimed {
+		m.jobs[next.ID] = next
+		m.visible[next.ID] = next.RunAt
+	}
+	return nil
+}
+
+func (m *MemoryBackend) Delete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.jobs, id)
+	delete(m.visible, id)
+	return nil
+}
+
+func (m *MemoryBackend) List(_ context.Context) ([]Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, job)
+	}
+	return list, nil
+}
@@ -0,0 +1,115 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueueRunsDueJobs(t *testing.T) {
+	q := NewQueue(NewMemoryBackend())
+	now := time.Now()
+
+	var ran []string
+	q.Handle(KindCleanup, func(_ context.Context, job Job) error {
+		ran = append(ran, job.ID)
+		return nil
+	})
+	for _, job := range []Job{
+		{ID: "due", Kind: KindCleanup, RunAt: now.Add(-time.Minute)},
+		{ID: "later", Kind: KindCleanup, RunAt: now.Add(time.Hour)},
+	} {
+		if err := q.Schedule(job); err != nil {
+			t.Fatalf("failed to schedule %s: %v", job.ID, err)
+		}
+	}
+
+	q.runDue(now)
+	if len(ran) != 1 || ran[0] != "due" {
+		t.Fatalf("ran %v, want only the due job", ran)
+	}
+	pending, _ := q.Pending()
+	if len(pending) != 1 || pending[0].ID != "later" {
+		t.Errorf("pending %+v, want only the later job", pending)
+	}
+
+	q.runDue(now.Add(2 * time.Hour))
+	if len(ran) != 2 {
+		t.Errorf("ran %v, want the later job too", ran)
+	}
+}
+
+func TestQueueRetriesFailedJobs(t *testing.T) {
+	q := NewQueue(NewMemoryBackend())
+	now := time.Now()
+
+	runs := 0
+	q.Handle(KindCleanup, func(_ context.Context, job Job) error {
+		runs++
+		return errors.New("redis is down")
+	})
+	if err := q.Schedule(Job{ID: "flaky", Kind: KindCleanup, RunAt: now}); err != nil {
+		t.Fatalf("failed to schedule: %v", err)
+	}
+
+	q.runDue(now)
+	pending, _ := q.Pending()
+	if len(pending) != 1 || pending[0].Attempts != 1 || !pending[0].RunAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("pending %+v, want one retry in a minute", pending)
+	}
+
+	for i := 0; i < maxAttempts; i++ {
+		now = now.Add(time.Hour)
+		q.runDue(now)
+	}
+	if runs != maxAttempts {
+		t.Errorf("ran %d times, want %d", runs, maxAttempts)
+	}
+	if pending, _ := q.Pending(); len(pending) != 0 {
+		t.Errorf("job was not dropped after %d attempts: %+v", maxAttempts, pending)
+	}
+}
+
+func TestRescheduledJobSurvivesItsRun(t *testing.T) {
+	q := NewQueue(NewMemoryBackend())
+	now := time.Now()
+
+	// the handler schedules the next run of the same job, like the restriction expiry does
+	q.Handle(KindRestrictionExpiry, func(_ context.Context, job Job) error {
+		job.RunAt = job.RunAt.Add(time.Hour)
+		return q.Schedule(job)
+	})
+	if err := q.Schedule(Job{ID: "expiry", Kind: KindRestrictionExpiry, RunAt: now}); err != nil {
+		t.Fatalf("failed to schedule: %v", err)
+	}
+
+	q.runDue(now)
+	pending, _ := q.Pending()
+	if len(pending) != 1 || !pending[0].RunAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("pending %+v, want the job an hour later", pending)
+	}
+}
+
+func TestFailedJobKeepsItsReschedule(t *testing.T) {
+	q := NewQueue(NewMemoryBackend())
+	now := time.Now()
+
+	// the handler schedules the job again for later and then fails
+	q.Handle(KindRestrictionExpiry, func(_ context.Context, job Job) error {
+		job.RunAt = job.RunAt.Add(time.Hour)
+		if err := q.Schedule(job); err != nil {
+			return err
+		}
+		return errors.New("redis is down")
+	})
+	if err := q.Schedule(Job{ID: "expiry", Kind: KindRestrictionExpiry, RunAt: now}); err != nil {
+		t.Fatalf("failed to schedule: %v", err)
+	}
+
+	q.runDue(now)
+	pending, _ := q.Pending()
+	if len(pending) != 1 || !pending[0].RunAt.Equal(now.Add(time.Hour)) || pending[0].Attempts != 0 {
+		t.Errorf("pending %+v, want the newer job an hour later", pending)
+	}
+}
@@ -0,0 +1,399 @@
+// Package pairing pairs tournament rounds by the dutch swiss system or by round-robin.
+// it only works with player ids and does no i/o
+package pairing
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ByeID stands in for the opponent of a player who sits the round out
+const ByeID = 0
+
+// RoundRobinMaxPlayers is the largest field that plays a round-robin by default
+const RoundRobinMaxPlayers = 8
+
+// System is the way rounds are paired
+type System string
+
+const (
+	SystemSwiss      System = "swiss"
+	SystemRoundRobin System = "round_robin"
+)
+
+// DefaultSystem picks round-robin for small fields and swiss otherwise
+func DefaultSystem(players int) System {
+	if players <= RoundRobinMaxPlayers {
+		return SystemRoundRobin
+	}
+	return SystemSwiss
+}
+
+type Result string
+
+const (
+	NoResult  Result = ""
+	WhiteWins Result = "1-0"
+	Draw      Result = "½-½"
+	BlackWins Result = "0-1"
+)
+
+// Game is one board of a round. a bye is a game with Black set to ByeID.
+// a result reported by one player stays in Reported until the opponent confirms it
+type Game struct {
+	Board      int    `json:"board"`
+	White      int    `json:"white"`
+	Black      int    `json:"black"`
+	Result     Result `json:"result,omitempty"`
+	Reported   Result `json:"reported,omitempty"`
+	ReportedBy int    `json:"reported_by,omitempty"`
+}
+
+func (g Game) IsBye() bool {
+	return g.Black == ByeID
+}
+
+// Round is a paired round with its results
+type Round struct {
+	Number int    `json:"number"`
+	Games  []Game `json:"games"`
+}
+
+var ErrNoPairing = errors.New("no valid pairing: every remaining opponent has already been met")
+
+// Points returns how much the player scored in the game
+func (g Game) Points(playerID int) float64 {
+	if g.IsBye() {
+		if g.White == playerID {
+			return 1
+		}
+		return 0
+	}
+	switch {
+	case g.Result == Draw && (g.White == playerID || g.Black == playerID):
+		return 0.5
+	case g.Result == WhiteWins && g.White == playerID, g.Result == BlackWins && g.Black == playerID:
+		return 1
+	}
+	return 0
+}
+
+// record is what the pairing needs to know about a player's past rounds
+type record struct {
+	score     float64
+	opponents map[int]bool
+	colours   []int // +1 for white, -1 for black
+	hadBye    bool
+}
+
+func records(seeds []int, history []Round) map[int]*record {
+	recs := make(map[int]*record, len(seeds))
+	for _, id := range seeds {
+		recs[id] = &record{opponents: map[int]bool{}}
+	}
+	get := func(id int) *record {
+		if recs[id] == nil {
+			recs[id] = &record{opponents: map[int]bool{}}
+		}
+		return recs[id]
+	}
+
+	for _, round := range history {
+		for _, g := range round.Games {
+			white := get(g.White)
+			white.score += g.Points(g.White)
+			if g.IsBye() {
+				white.hadBye = true
+				continue
+			}
+			black := get(g.Black)
+			black.score += g.Points(g.Black)
+			white.opponents[g.Black] = true
+			black.opponents[g.White] = true
+			white.colours = append(white.colours, 1)
+			black.colours = append(black.colours, -1)
+		}
+	}
+	return recs
+}
+
+// preference returns the colour the player should get next (+1 white, -1 black, 0 any)
+// and how strongly: 3 when the colour is absolute, 2 when strong, 1 when mild
+func (r *record) preference() (int, int) {
+	if len(r.colours) == 0 {
+		return 0, 0
+	}
+	diff := 0
+	for _, c := range r.colours {
+		diff += c
+	}
+	last := r.colours[len(r.colours)-1]
+	sameTwice := len(r.colours) >= 2 && r.colours[len(r.colours)-2] == last
+
+	switch {
+	case diff > 1 || diff < -1 || sameTwice:
+		if diff > 0 || (diff == 0 && last > 0) {
+			return -1, 3
+		}
+		return 1, 3
+	case diff == 1:
+		return -1, 2
+	case diff == -1:
+		return 1, 2
+	}
+	return -last, 1
+}
+
+// Swiss pairs the next round by the dutch system.
+// seeds lists every active player from the strongest; players are ranked by score and then seed.
+// nobody meets the same opponent twice, colours are balanced where possible
+// and an odd player out gets a bye from the bottom of the standings
+func Swiss(seeds []int, history []Round) ([]Game, error) {
+	if len(seeds) < 2 {
+		return nil, fmt.Errorf("need at least 2 players, got %d", len(seeds))
+	}
+
+	recs := records(seeds, history)
+
+	ranked := append([]int(nil), seeds...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return recs[ranked[i]].score > recs[ranked[j]].score
+	})
+
+	s := &swiss{recs: recs}
+
+	bye := ByeID
+	var pairs [][2]int
+	ok := false
+	if len(ranked)%2 == 0 {
+		pairs, ok = s.pair(ranked)
+	} else {
+		// the bye goes to the lowest ranked player who has not had one yet
+		// and whose absence still lets everyone else be paired
+		for _, allowRepeat := range []bool{false, true} {
+			for i := len(ranked) - 1; i >= 0 && !ok; i-- {
+				if recs[ranked[i]].hadBye && !allowRepeat {
+					continue
+				}
+				rest := append(append([]int(nil), ranked[:i]...), ranked[i+1:]...)
+				if pairs, ok = s.pair(rest); ok {
+					bye = ranked[i]
+				}
+			}
+			if ok {
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, ErrNoPairing
+	}
+
+	rank := make(map[int]int, len(ranked))
+	for i, id := range ranked {
+		rank[id] = i
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		si := max(recs[pairs[i][0]].score, recs[pairs[i][1]].score)
+		sj := max(recs[pairs[j][0]].score, recs[pairs[j][1]].score)
+		if si != sj {
+			return si > sj
+		}
+		return min(rank[pairs[i][0]], rank[pairs[i][1]]) < min(rank[pairs[j][0]], rank[pairs[j][1]])
+	})
+
+	games := make([]Game, 0, len(pairs)+1)
+	for i, p := range pairs {
+		white, black := s.colours(p[0], p[1], i)
+		games = append(games, Game{Board: i + 1, White: white, Black: black})
+	}
+	if bye != ByeID {
+		games = append(games, Game{Board: len(games) + 1, White: bye, Black: ByeID})
+	}
+	return games, nil
+}
+
+type swiss struct {
+	recs map[int]*record
+}
+
+// pair pairs the ranked players top down, backtracking whenever the rest cannot be paired
+func (s *swiss) pair(ranked []int) ([][2]int, bool) {
+	if len(ranked) == 0 {
+		return nil, true
+	}
+
+	top := ranked[0]
+	for _, opponent := range s.candidates(ranked) {
+		rest := make([]int, 0, len(ranked)-2)
+		for _, id := range ranked[1:] {
+			if id != opponent {
+				rest = append(rest, id)
+			}
+		}
+		if pairs, ok := s.pair(rest); ok {
+			return append([][2]int{{top, opponent}}, pairs...), true
+		}
+	}
+	return nil, false
+}
+
+// candidates orders possible opponents of the top ranked player the dutch way:
+// first the lower half of their score group, then the upper half, then players floating down from below.
+// inside each part opponents with a compatible colour come first
+func (s *swiss) candidates(ranked []int) []int {
+	top := ranked[0]
+	score := s.recs[top].score
+
+	groupSize := 0
+	for _, id := range ranked {
+		if s.recs[id].score != score {
+			break
+		}
+		groupSize++
+	}
+	half := groupSize / 2
+
+	type candidate struct {
+		id, tier, conflict, order int
+	}
+	var list []candidate
+	for i, id := range ranked[1:] {
+		pos := i + 1
+		if s.recs[top].opponents[id] {
+			continue
+		}
+		c := candidate{id: id, order: pos}
+		switch {
+		case pos >= groupSize:
+			c.tier = 2
+		case pos >= half:
+			c.tier = 0
+		default:
+			c.tier = 1
+		}
+		if s.colourConflict(top, id) {
+			c.conflict = 1
+		}
+		list = append(list, c)
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].tier != list[j].tier {
+			return list[i].tier < list[j].tier
+		}
+		if list[i].conflict != list[j].conflict {
+			return list[i].conflict < list[j].conflict
+		}
+		return list[i].order < list[j].order
+	})
+
+	ids := make([]int, len(list))
+	for i, c := range list {
+		ids[i] = c.id
+	}
+	return ids
+}
+
+func (s *swiss) colourConflict(a, b int) bool {
+	prefA, _ := s.recs[a].preference()
+	prefB, _ := s.recs[b].preference()
+	return prefA != 0 && prefA == prefB
+}
+
+// colours decides who plays white. higher is the better ranked player of the pair
+func (s *swiss) colours(higher, lower int, board int) (int, int) {
+	prefH, strengthH := s.recs[higher].preference()
+	prefL, strengthL := s.recs[lower].preference()
+
+	switch {
+	case prefH != prefL && prefH != 0:
+		return whiteFirst(higher, lower, prefH)
+	case prefH != prefL:
+		return whiteFirst(lower, higher, prefL)
+	case prefH == 0:
+		// nobody has played yet: alternate colours of the top seeds by board
+		if board%2 == 0 {
+			return higher, lower
+		}
+		return lower, higher
+	case strengthL > strengthH:
+		return whiteFirst(lower, higher, prefL)
+	default:
+		return whiteFirst(higher, lower, prefH)
+	}
+}
+
+// whiteFirst gives the player their preferred colour
+func whiteFirst(player, opponent int, pref int) (int, int) {
+	if pref > 0 {
+		return player, opponent
+	}
+	return opponent, player
+}
+
+// RoundRobinRounds returns how many rounds a round-robin between n players has
+func RoundRobinRounds(n int) int {
+	if n%2 == 1 {
+		n++
+	}
+	return n - 1
+}
+
+// RoundRobin returns the games of a round (starting at 1) of a round-robin by berger tables.
+// seeds keep their order for the whole tournament
+func RoundRobin(seeds []int, round int) ([]Game, error) {
+	if len(seeds) < 2 {
+		return nil, fmt.Errorf("need at least 2 players, got %d", len(seeds))
+	}
+	if round < 1 || round > RoundRobinRounds(len(seeds)) {
+		return nil, fmt.Errorf("round-robin of %d players has no round %d", len(seeds), round)
+	}
+
+	players := append([]int(nil), seeds...)
+	if len(players)%2 == 1 {
+		players = append(players, ByeID)
+	}
+	n := len(players)
+	fixed := players[n-1]
+	rotating := players[:n-1]
+
+	r := round - 1
+	shift := r * (n / 2) % (n - 1)
+	current := make([]int, n-1)
+	for i := range current {
+		current[i] = rotating[(i+shift)%(n-1)]
+	}
+
+	var games []Game
+	if r%2 == 1 {
+		games = append(games, Game{White: fixed, Black: current[0]})
+	} else {
+		games = append(games, Game{White: current[0], Black: fixed})
+	}
+	for i := 1; i < n/2; i++ {
+		games = append(games, Game{White: current[i], Black: current[n-1-i]})
+	}
+
+	// a bye is always stored with the sitting player as white and placed last
+	var paired []Game
+	var bye *Game
+	for _, g := range games {
+		switch {
+		case g.White == ByeID:
+			bye = &Game{White: g.Black, Black: ByeID}
+		case g.Black == ByeID:
+			bye = &Game{White: g.White, Black: ByeID}
+		default:
+			paired = append(paired, g)
+		}
+	}
+	if bye != nil {
+		paired = append(paired, *bye)
+	}
+	for i := range paired {
+		paired[i].Board = i + 1
+	}
+	return paired, nil
+}
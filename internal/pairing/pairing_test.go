@@ -0,0 +1,245 @@
+package pairing
+
+import (
+	"testing"
+)
+
+func seeds(n int) []int {
+	ids := make([]int, n)
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids
+}
+
+// playRound lets the better seed (lower id) win every game
+func playRound(number int, games []Game) Round {
+	for i, g := range games {
+		switch {
+		case g.IsBye():
+		case g.White < g.Black:
+			games[i].Result = WhiteWins
+		default:
+			games[i].Result = BlackWins
+		}
+	}
+	return Round{Number: number, Games: games}
+}
+
+func TestSwissFirstRoundPairsTopHalfWithBottomHalf(t *testing.T) {
+	games, err := Swiss(seeds(6), nil)
+	if err != nil {
+		t.Fatalf("swiss failed: %v", err)
+	}
+
+	want := []Game{
+		{Board: 1, White: 1, Black: 4},
+		{Board: 2, White: 5, Black: 2},
+		{Board: 3, White: 3, Black: 6},
+	}
+	if len(games) != len(want) {
+		t.Fatalf("got %d games, want %d: %+v", len(games), len(want), games)
+	}
+	for i := range want {
+		if games[i] != want[i] {
+			t.Errorf("board %d: got %+v, want %+v", i+1, games[i], want[i])
+		}
+	}
+}
+
+func TestSwissGivesByeToLowestPlayerOnce(t *testing.T) {
+	players := seeds(5)
+	var history []Round
+	byes := map[int]int{}
+
+	for round := 1; round <= 4; round++ {
+		games, err := Swiss(players, history)
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		last := games[len(games)-1]
+		if !last.IsBye() {
+			t.Fatalf("round %d: expected a bye on the last board, got %+v", round, last)
+		}
+		byes[last.White]++
+		if round == 1 && last.White != 5 {
+			t.Errorf("round 1 bye went to %d, want the lowest seed 5", last.White)
+		}
+		history = append(history, playRound(round, games))
+	}
+
+	for id, n := range byes {
+		if n > 1 {
+			t.Errorf("player %d got %d byes", id, n)
+		}
+	}
+}
+
+func TestSwissAvoidsRematchesAndBalancesColours(t *testing.T) {
+	players := seeds(10)
+	var history []Round
+
+	for round := 1; round <= 6; round++ {
+		games, err := Swiss(players, history)
+		if err != nil {
+			t.Fatalf("round %d: %v", round, err)
+		}
+		history = append(history, playRound(round, games))
+	}
+
+	met := map[[2]int]bool{}
+	balance := map[int]int{}
+	for _, round := range history {
+		seen := map[int]bool{}
+		for _, g := range round.Games {
+			if seen[g.White] || seen[g.Black] {
+				t.Fatalf("round %d: player paired twice: %+v", round.Number, round.Games)
+			}
+			seen[g.White], seen[g.Black] = true, true
+
+			key := [2]int{min(g.White, g.Black), max(g.White, g.Black)}
+			if met[key] {
+				t.Errorf("round %d: rematch %d-%d", round.Number, key[0], key[1])
+			}
+			met[key] = true
+			balance[g.White]++
+			balance[g.Black]--
+		}
+		if len(seen) != len(players) {
+			t.Errorf("round %d: %d players paired, want %d", round.Number, len(seen), len(players))
+		}
+	}
+
+	for id, diff := range balance {
+		if diff > 2 || diff < -2 {
+			t.Errorf("player %d has colour difference %d", id, diff)
+		}
+	}
+}
+
+func TestSwissFailsWhenEveryoneHasMet(t *testing.T) {
+	history := []Round{{Number: 1, Games: []Game{{White: 1, Black: 2, Result: Draw}}}}
+	if _, err := Swiss(seeds(2), history); err != ErrNoPairing {
+		t.Fatalf("expected ErrNoPairing, got %v", err)
+	}
+}
+
+func TestRoundRobinPlaysEveryPairOnce(t *testing.T) {
+	for _, n := range []int{4, 5, 8} {
+		players := seeds(n)
+		met := map[[2]int]int{}
+		whites := map[int]int{}
+
+		for round := 1; round <= RoundRobinRounds(n); round++ {
+			games, err := RoundRobin(players, round)
+			if err != nil {
+				t.Fatalf("n=%d round %d: %v", n, round, err)
+			}
+			for _, g := range games {
+				if g.IsBye() {
+					continue
+				}
+				met[[2]int{min(g.White, g.Black), max(g.White, g.Black)}]++
+				whites[g.White]++
+			}
+		}
+
+		if len(met) != n*(n-1)/2 {
+			t.Errorf("n=%d: %d distinct pairs, want %d", n, len(met), n*(n-1)/2)
+		}
+		for pair, count := range met {
+			if count != 1 {
+				t.Errorf("n=%d: %v met %d times", n, pair, count)
+			}
+		}
+		for id, w := range whites {
+			if games := n - 1; w < games/2 || w > (games+1)/2 {
+				t.Errorf("n=%d: player %d has %d whites out of %d games", n, id, w, games)
+			}
+		}
+	}
+
+	if _, err := RoundRobin(seeds(4), 4); err == nil {
+		t.Errorf("expected an error for a round past the end")
+	}
+}
+
+func TestPoints(t *testing.T) {
+	cases := []struct {
+		game Game
+		id   int
+		want float64
+	}{
+		{Game{White: 1, Black: 2, Result: WhiteWins}, 1, 1},
+		{Game{White: 1, Black: 2, Result: WhiteWins}, 2, 0},
+		{Game{White: 1, Black: 2, Result: Draw}, 2, 0.5},
+		{Game{White: 1, Black: 2, Result: BlackWins}, 2, 1},
+		{Game{White: 1, Black: 2}, 1, 0},
+		{Game{White: 3, Black: ByeID}, 3, 1},
+	}
+	for _, c := range cases {
+		if got := c.game.Points(c.id); got != c.want {
+			t.Errorf("%+v points for %d = %v, want %v", c.game, c.id, got, c.want)
+		}
+	}
+}
+
+func TestReportNeedsOpponentConfirmation(t *testing.T) {
+	game := Game{Board: 1, White: 1, Black: 2}
+
+	if _, err := game.Report(3, WhiteWins); err != ErrNotInGame {
+		t.Fatalf("outsider report: got %v, want ErrNotInGame", err)
+	}
+
+	outcome, err := game.Report(1, WhiteWins)
+	if err != nil || outcome != ReportPending || game.Result != NoResult {
+		t.Fatalf("first report: outcome %v, err %v, result %q", outcome, err, game.Result)
+	}
+
+	outcome, _ = game.Report(2, Draw)
+	if outcome != ReportDisputed || game.Reported != Draw || game.ReportedBy != 2 {
+		t.Fatalf("disputed report: outcome %v, game %+v", outcome, game)
+	}
+
+	outcome, _ = game.Report(1, Draw)
+	if outcome != ReportConfirmed || game.Result != Draw || game.ReportedBy != 0 {
+		t.Fatalf("confirmation: outcome %v, game %+v", outcome, game)
+	}
+
+	if _, err := game.Report(2, BlackWins); err != ErrResultIsFinal {
+		t.Fatalf("report after confirmation: got %v, want ErrResultIsFinal", err)
+	}
+}
+
+func TestParseResult(t *testing.T) {
+	for input, want := range map[string]Result{"1-0": WhiteWins, "0-1": BlackWins, "½-½": Draw, "1/2": Draw, "=": Draw} {
+		if got, ok := ParseResult(input); !ok || got != want {
+			t.Errorf("ParseResult(%q) = %q, %v", input, got, ok)
+		}
+	}
+	if _, ok := ParseResult("2-0"); ok {
+		t.Errorf("2-0 must not parse")
+	}
+}
+
+func TestStandingsTiebreaks(t *testing.T) {
+	// 1 beats 2, 3 beats 4, then 1 draws 3 and 2 beats 4
+	rounds := []Round{
+		{Number: 1, Games: []Game{{White: 1, Black: 2, Result: WhiteWins}, {White: 3, Black: 4, Result: WhiteWins}}},
+		{Number: 2, Games: []Game{{White: 3, Black: 1, Result: Draw}, {White: 2, Black: 4, Result: WhiteWins}}},
+	}
+
+	table := Standings(seeds(4), rounds)
+
+	want := []Standing{
+		{Player: 1, Score: 1.5, Buchholz: 2.5, SonnebornBerger: 1.75},
+		{Player: 3, Score: 1.5, Buchholz: 1.5, SonnebornBerger: 0.75},
+		{Player: 2, Score: 1, Buchholz: 1.5, SonnebornBerger: 0},
+		{Player: 4, Score: 0, Buchholz: 2.5, SonnebornBerger: 0},
+	}
+	for i := range want {
+		if table[i] != want[i] {
+			t.Errorf("place %d: got %+v, want %+v", i+1, table[i], want[i])
+		}
+	}
+}
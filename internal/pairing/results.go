@@ -0,0 +1,141 @@
+package pairing
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrNotInGame     = errors.New("player does not play this game")
+	ErrResultIsFinal = errors.New("the result is already confirmed")
+)
+
+// ParseResult understands 1-0, 0-1 and draws written as ½-½, 1/2, 0.5 or =
+func ParseResult(s string) (Result, bool) {
+	switch strings.ReplaceAll(strings.TrimSpace(s), " ", "") {
+	case "1-0":
+		return WhiteWins, true
+	case "0-1":
+		return BlackWins, true
+	case "½-½", "1/2-1/2", "1/2", "0.5-0.5", "0.5", "=", "½":
+		return Draw, true
+	}
+	return NoResult, false
+}
+
+// ReportOutcome says what a report did to the game
+type ReportOutcome int
+
+const (
+	// ReportPending means the result waits for the opponent
+	ReportPending ReportOutcome = iota
+	// ReportConfirmed means both players agree and the result is final
+	ReportConfirmed
+	// ReportDisputed means the opponent had reported a different result
+	ReportDisputed
+)
+
+// Report records the result claimed by one of the players.
+// the result becomes final once the opponent reports the same
+func (g *Game) Report(playerID int, result Result) (ReportOutcome, error) {
+	if g.IsBye() || (playerID != g.White && playerID != g.Black) {
+		return ReportPending, ErrNotInGame
+	}
+	if g.Result != NoResult {
+		return ReportPending, ErrResultIsFinal
+	}
+
+	if g.ReportedBy != 0 && g.ReportedBy != playerID {
+		if g.Reported == result {
+			g.Override(result)
+			return ReportConfirmed, nil
+		}
+		g.Reported, g.ReportedBy = result, playerID
+		return ReportDisputed, nil
+	}
+
+	g.Reported, g.ReportedBy = result, playerID
+	return ReportPending, nil
+}
+
+// Override sets the final result regardless of what the players reported
+func (g *Game) Override(result Result) {
+	g.Result = result
+	g.Reported, g.ReportedBy = NoResult, 0
+}
+
+// Unfinished returns boards of the round that still have no final result
+func (r Round) Unfinished() []int {
+	var boards []int
+	for _, g := range r.Games {
+		if !g.IsBye() && g.Result == NoResult {
+			boards = append(boards, g.Board)
+		}
+	}
+	return boards
+}
+
+// Standing is a line of the tournament table
+type Standing struct {
+	Player          int
+	Score           float64
+	Buchholz        float64
+	SonnebornBerger float64
+}
+
+// Standings ranks players by score, then buchholz, then sonneborn-berger, then seed.
+// buchholz sums the scores of everyone the player met; sonneborn-berger sums
+// the scores of beaten opponents and half the scores of drawn ones. byes add to neither
+func Standings(seeds []int, rounds []Round) []Standing {
+	recs := records(seeds, rounds)
+
+	order := append([]int(nil), seeds...)
+	seen := make(map[int]bool, len(seeds))
+	for _, id := range seeds {
+		seen[id] = true
+	}
+	for _, round := range rounds {
+		for _, g := range round.Games {
+			for _, id := range []int{g.White, g.Black} {
+				if id != ByeID && !seen[id] {
+					seen[id] = true
+					order = append(order, id)
+				}
+			}
+		}
+	}
+
+	table := make([]Standing, len(order))
+	index := make(map[int]int, len(order))
+	for i, id := range order {
+		table[i] = Standing{Player: id, Score: recs[id].score}
+		index[id] = i
+	}
+
+	for _, round := range rounds {
+		for _, g := range round.Games {
+			if g.IsBye() {
+				continue
+			}
+			for _, side := range [][2]int{{g.White, g.Black}, {g.Black, g.White}} {
+				player, opponent := side[0], side[1]
+				s := &table[index[player]]
+				s.Buchholz += recs[opponent].score
+				s.SonnebornBerger += g.Points(player) * recs[opponent].score
+			}
+		}
+	}
+
+	sort.SliceStable(table, func(i, j int) bool {
+		a, b := table[i], table[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Buchholz != b.Buchholz {
+			return a.Buchholz > b.Buchholz
+		}
+		return a.SonnebornBerger > b.SonnebornBerger
+	})
+	return table
+}
@@ -0,0 +1,65 @@
+// Package rating computes the club elo rating from over-the-board games
+package rating
+
+import "math"
+
+// Initial is the rating of a player without rated games
+const Initial = 1500
+
+// provisionalGames is how many games a player needs before their rating settles
+const provisionalGames = 30
+
+// Player is a rating with the number of games it is based on
+type Player struct {
+	Rating int
+	Games  int
+}
+
+// Game is a finished game; Score is what white scored
+type Game struct {
+	White int
+	Black int
+	Score float64
+}
+
+// KFactor is large for newcomers so their rating finds its level quickly
+func KFactor(games int) float64 {
+	if games < provisionalGames {
+		return 40
+	}
+	return 20
+}
+
+// Expected is the score a player rated a expects against a player rated b
+func Expected(a, b int) float64 {
+	return 1 / (1 + math.Pow(10, float64(b-a)/400))
+}
+
+// Apply rates one tournament: every game is scored against the ratings players had
+// before the tournament and the changes are summed, so the order of games does not matter.
+// players missing from the map start at Initial. returns the new ratings of everyone who played
+func Apply(players map[int]Player, games []Game) map[int]Player {
+	before := func(id int) Player {
+		if p, ok := players[id]; ok {
+			return p
+		}
+		return Player{Rating: Initial}
+	}
+
+	delta := make(map[int]float64)
+	played := make(map[int]int)
+	for _, g := range games {
+		white, black := before(g.White), before(g.Black)
+		delta[g.White] += KFactor(white.Games) * (g.Score - Expected(white.Rating, black.Rating))
+		delta[g.Black] += KFactor(black.Games) * ((1 - g.Score) - Expected(black.Rating, white.Rating))
+		played[g.White]++
+		played[g.Black]++
+	}
+
+	after := make(map[int]Player, len(played))
+	for id, n := range played {
+		p := before(id)
+		after[id] = Player{Rating: p.Rating + int(math.Round(delta[id])), Games: p.Games + n}
+	}
+	return after
+}
@@ -0,0 +1,51 @@
+package rating
+
+import (
+	"math"
+	"testing"
+)
+
+func TestExpected(t *testing.T) {
+	if got := Expected(1500, 1500); got != 0.5 {
+		t.Errorf("equal ratings: expected %v, want 0.5", got)
+	}
+	if got := Expected(1900, 1500); math.Abs(got-0.909) > 0.001 {
+		t.Errorf("400 points stronger: expected %v, want about 0.909", got)
+	}
+}
+
+func TestApplyNewcomers(t *testing.T) {
+	after := Apply(nil, []Game{{White: 1, Black: 2, Score: 1}})
+
+	if after[1] != (Player{Rating: 1520, Games: 1}) {
+		t.Errorf("winner: got %+v", after[1])
+	}
+	if after[2] != (Player{Rating: 1480, Games: 1}) {
+		t.Errorf("loser: got %+v", after[2])
+	}
+}
+
+func TestApplyUsesRatingsFromBeforeTheTournament(t *testing.T) {
+	players := map[int]Player{
+		1: {Rating: 1600, Games: 50},
+		2: {Rating: 1600, Games: 50},
+		3: {Rating: 1600, Games: 50},
+	}
+	games := []Game{
+		{White: 1, Black: 2, Score: 1},
+		{White: 3, Black: 1, Score: 0.5},
+	}
+
+	after := Apply(players, games)
+
+	// +10 for the win and 0 for the draw, both against 1600
+	if after[1] != (Player{Rating: 1610, Games: 52}) {
+		t.Errorf("player 1: got %+v", after[1])
+	}
+	if after[3] != (Player{Rating: 1600, Games: 51}) {
+		t.Errorf("player 3: got %+v", after[3])
+	}
+	if len(after) != 3 {
+		t.Errorf("got %d rated players, want 3", len(after))
+	}
+}
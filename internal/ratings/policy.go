@@ -0,0 +1,251 @@
+package ratings
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeControl is a rating pool on a site
+type TimeControl string
+
+const (
+	Bullet         TimeControl = "bullet"
+	Blitz          TimeControl = "blitz"
+	Rapid          TimeControl = "rapid"
+	Classical      TimeControl = "classical"
+	Correspondence TimeControl = "correspondence"
+	Variants       TimeControl = "variants"
+)
+
+// TimeControls lists every pool from fastest to slowest, variants last
+var TimeControls = []TimeControl{Bullet, Blitz, Rapid, Classical, Correspondence, Variants}
+
+var labels = map[TimeControl]string{
+	Bullet:         "пуля",
+	Blitz:          "блиц",
+	Rapid:          "рапид",
+	Classical:      "классика",
+	Correspondence: "заочные",
+	Variants:       "варианты",
+}
+
+func (tc TimeControl) Label() string {
+	if label, ok := labels[tc]; ok {
+		return label
+	}
+	return string(tc)
+}
+
+// Point is the rating an account had on some day
+type Point struct {
+	Rating      int       `json:"rating"`
+	Date        time.Time `json:"date"`
+	Provisional bool      `json:"provisional,omitempty"`
+}
+
+// History is every known rating of an account by time control
+type History map[TimeControl][]Point
+
+// defaultTimeControls are the pools that counted before policies were configurable
+var defaultTimeControls = []TimeControl{Blitz, Rapid, Classical}
+
+// Policy decides which ratings count as a peak for a tournament.
+// the zero value counts blitz, rapid and classical over all time and skips provisional ratings
+type Policy struct {
+	TimeControls     []TimeControl `json:"time_controls,omitempty"`
+	CountProvisional bool          `json:"count_provisional,omitempty"`
+	Months           int           `json:"months,omitempty"`
+}
+
+func (p Policy) timeControls() []TimeControl {
+	if len(p.TimeControls) == 0 {
+		return defaultTimeControls
+	}
+	return p.TimeControls
+}
+
+// Peaks picks the best counted rating of every time control the policy looks at
+func (p Policy) Peaks(history History, now time.Time) Peaks {
+	var since time.Time
+	if p.Months > 0 {
+		since = now.AddDate(0, -p.Months, 0)
+	}
+
+	peaks := make(Peaks)
+	for _, tc := range p.timeControls() {
+		for _, point := range history[tc] {
+			if point.Provisional && !p.CountProvisional {
+				continue
+			}
+			if point.Date.Before(since) {
+				continue
+			}
+			if best, ok := peaks[tc]; !ok || point.Rating > best.Rating {
+				peaks[tc] = point
+			}
+		}
+	}
+	return peaks
+}
+
+// AllPools counts every pool over all time, for showing the whole record of an account
+var AllPools = Policy{TimeControls: TimeControls}
+
+// Set changes one field from an admin spec. keys are
+// peaks=blitz+rapid (or all, or default), provisional=yes|no and months=12 (0 for all time).
+// reports false if the key is not a policy key
+func (p *Policy) Set(key, value string) (bool, error) {
+	switch strings.ToLower(key) {
+	case "peaks":
+		controls, err := parseTimeControls(value)
+		if err != nil {
+			return true, err
+		}
+		p.TimeControls = controls
+	case "provisional":
+		switch strings.ToLower(value) {
+		case "yes", "да", "1":
+			p.CountProvisional = true
+		case "no", "нет", "0":
+			p.CountProvisional = false
+		default:
+			return true, fmt.Errorf("provisional должно быть yes или no")
+		}
+	case "months":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, fmt.Errorf("months должно быть неотрицательным числом")
+		}
+		p.Months = n
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+func parseTimeControls(value string) ([]TimeControl, error) {
+	switch strings.ToLower(value) {
+	case "default", "":
+		return nil, nil
+	case "all":
+		return append([]TimeControl(nil), TimeControls...), nil
+	}
+
+	var controls []TimeControl
+	for _, name := range strings.Split(strings.ToLower(value), "+") {
+		tc := TimeControl(name)
+		if _, ok := labels[tc]; !ok {
+			return nil, fmt.Errorf("неизвестный контроль %q, есть: bullet, blitz, rapid, classical, correspondence, variants", name)
+		}
+		controls = append(controls, tc)
+	}
+	return controls, nil
+}
+
+// ParsePolicy reads a spec written by Spec
+func ParsePolicy(spec string) (Policy, error) {
+	var p Policy
+	for _, token := range strings.Fields(spec) {
+		key, value, _ := strings.Cut(token, "=")
+		ok, err := p.Set(key, value)
+		if err != nil {
+			return Policy{}, err
+		}
+		if !ok {
+			return Policy{}, fmt.Errorf("неизвестное поле %q", key)
+		}
+	}
+	return p, nil
+}
+
+// Spec is the policy in the form admins type it; empty for the default policy
+func (p Policy) Spec() string {
+	var fields []string
+	if len(p.TimeControls) > 0 {
+		names := make([]string, 0, len(p.TimeControls))
+		for _, tc := range p.TimeControls {
+			names = append(names, string(tc))
+		}
+		fields = append(fields, "peaks="+strings.Join(names, "+"))
+	}
+	if p.CountProvisional {
+		fields = append(fields, "provisional=yes")
+	}
+	if p.Months > 0 {
+		fields = append(fields, fmt.Sprintf("months=%d", p.Months))
+	}
+	return strings.Join(fields, " ")
+}
+
+func (p Policy) String() string {
+	names := make([]string, 0, len(p.timeControls()))
+	for _, tc := range p.timeControls() {
+		names = append(names, tc.Label())
+	}
+	s := strings.Join(names, "+")
+	if !p.CountProvisional {
+		s += ", без провизорных"
+	}
+	if p.Months > 0 {
+		s += fmt.Sprintf(", за %d мес", p.Months)
+	}
+	return s
+}
+
+// Peaks are the best counted ratings by time control
+type Peaks map[TimeControl]Point
+
+// Peak is one entry of Peaks
+type Peak struct {
+	TimeControl TimeControl
+	Point
+}
+
+// Sorted lists the peaks in the order of TimeControls
+func (p Peaks) Sorted() []Peak {
+	order := make(map[TimeControl]int, len(TimeControls))
+	for i, tc := range TimeControls {
+		order[tc] = i
+	}
+
+	sorted := make([]Peak, 0, len(p))
+	for tc, point := range p {
+		sorted = append(sorted, Peak{TimeControl: tc, Point: point})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return order[sorted[i].TimeControl] < order[sorted[j].TimeControl]
+	})
+	return sorted
+}
+
+// Over returns the peaks at or above limit
+func (p Peaks) Over(limit int) []Peak {
+	var over []Peak
+	for _, peak := range p.Sorted() {
+		if peak.Rating >= limit {
+			over = append(over, peak)
+		}
+	}
+	return over
+}
+
+func (p Peak) String() string {
+	if p.Date.IsZero() {
+		return fmt.Sprintf("%s %d", p.TimeControl.Label(), p.Rating)
+	}
+	return fmt.Sprintf("%s %d (%s)", p.TimeControl.Label(), p.Rating, p.Date.Format("02.01.2006"))
+}
+
+func (p Peaks) String() string {
+	if len(p) == 0 {
+		return "нет рейтинга"
+	}
+	parts := make([]string, 0, len(p))
+	for _, peak := range p.Sorted() {
+		parts = append(parts, fmt.Sprintf("%s %d", peak.TimeControl.Label(), peak.Rating))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,84 @@
+package ratings
+
+import (
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+var now = day(2025, time.June, 1)
+
+var history = History{
+	Bullet: {{Rating: 2000, Date: day(2025, time.January, 1)}},
+	Blitz: {
+		{Rating: 1900, Date: day(2020, time.March, 1), Provisional: true},
+		{Rating: 1700, Date: day(2021, time.March, 1)},
+		{Rating: 1600, Date: day(2025, time.February, 1)},
+	},
+	Rapid: {{Rating: 1650, Date: day(2024, time.December, 1)}},
+}
+
+func TestDefaultPolicy(t *testing.T) {
+	peaks := Policy{}.Peaks(history, now)
+
+	if got := peaks.String(); got != "блиц 1700, рапид 1650" {
+		t.Errorf("got %q: bullet and the provisional blitz rating must not count", got)
+	}
+}
+
+func TestPolicyOptions(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string
+	}{
+		{"provisional=yes", "блиц 1900, рапид 1650"},
+		{"months=12", "блиц 1600, рапид 1650"},
+		{"peaks=blitz+bullet", "пуля 2000, блиц 1700"},
+		{"peaks=all months=6", "пуля 2000, блиц 1600, рапид 1650"},
+		{"peaks=classical", "нет рейтинга"},
+	}
+	for _, tt := range tests {
+		policy, err := ParsePolicy(tt.spec)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.spec, err)
+		}
+		if got := policy.Peaks(history, now).String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestOverListsEveryPeakAboveTheLimit(t *testing.T) {
+	over := Policy{}.Peaks(history, now).Over(1650)
+
+	if len(over) != 2 {
+		t.Fatalf("got %v", over)
+	}
+	if got := over[0].String(); got != "блиц 1700 (01.03.2021)" {
+		t.Errorf("got %q", got)
+	}
+	if got := over[1].String(); got != "рапид 1650 (01.12.2024)" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestPolicySpecRoundTrip(t *testing.T) {
+	for _, spec := range []string{"", "peaks=blitz+rapid provisional=yes months=12", "months=3"} {
+		policy, err := ParsePolicy(spec)
+		if err != nil {
+			t.Fatalf("%q: %v", spec, err)
+		}
+		if got := policy.Spec(); got != spec {
+			t.Errorf("got %q, want %q", got, spec)
+		}
+	}
+
+	for _, spec := range []string{"peaks=blitz+chess960", "months=-1", "provisional=maybe", "colour=white"} {
+		if _, err := ParsePolicy(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+}
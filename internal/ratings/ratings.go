@@ -0,0 +1,296 @@
+// Package ratings reads rating histories of players from lichess and chess.com
+package ratings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LichessURL  = "https://lichess.org"
+	ChessComURL = "https://api.chess.com"
+
+	userAgent  = "mshkbot (+https://github.com/sukalov/mshkbot)"
+	maxRetries = 3
+	maxBackoff = 30 * time.Second
+)
+
+var (
+	ErrNotFound    = errors.New("account not found")
+	ErrRateLimited = errors.New("rate limited by the rating site")
+)
+
+// Provider reads public data of an account on one site
+type Provider interface {
+	Site() string
+	History(ctx context.Context, username string) (History, error)
+	// Profile returns the free text fields of the profile a player can edit
+	Profile(ctx context.Context, username string) (string, error)
+}
+
+// Providers are the sites the bot checks
+type Providers struct {
+	Lichess  Provider
+	ChessCom Provider
+}
+
+// NewHTTPClient returns the client shared by all providers
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: 10 * time.Second}
+}
+
+// fetcher does GET requests that identify the bot and wait out 429 responses
+type fetcher struct {
+	baseURL string
+	client  *http.Client
+	sleep   func(context.Context, time.Duration) error
+}
+
+func newFetcher(baseURL string, client *http.Client) fetcher {
+	if client == nil {
+		client = NewHTTPClient()
+	}
+	return fetcher{baseURL: strings.TrimRight(baseURL, "/"), client: client, sleep: sleepContext}
+}
+
+// getJSON decodes the response of baseURL+path into v
+func (f fetcher) getJSON(ctx context.Context, path string, v interface{}) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+path, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := f.client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			defer resp.Body.Close()
+			return json.NewDecoder(resp.Body).Decode(v)
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+			return ErrNotFound
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries:
+			wait := retryAfter(resp.Header.Get("Retry-After"), attempt)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if err := f.sleep(ctx, wait); err != nil {
+				return err
+			}
+		case resp.StatusCode == http.StatusTooManyRequests:
+			resp.Body.Close()
+			return ErrRateLimited
+		default:
+			resp.Body.Close()
+			return fmt.Errorf("unexpected response from %s: %s", f.baseURL, resp.Status)
+		}
+	}
+}
+
+// retryAfter honours the Retry-After header and falls back to exponential backoff
+func retryAfter(header string, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, maxBackoff)
+	}
+	return min(time.Second<<attempt, maxBackoff)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lichessProvisionalPoints is how many days of a new lichess rating are treated as provisional.
+// the history api does not say when the rating deviation settled
+const lichessProvisionalPoints = 5
+
+// lichessPools maps lichess perf names; anything else but puzzles is a variant
+var lichessPools = map[string]TimeControl{
+	"UltraBullet":    Bullet,
+	"Bullet":         Bullet,
+	"Blitz":          Blitz,
+	"Rapid":          Rapid,
+	"Classical":      Classical,
+	"Correspondence": Correspondence,
+}
+
+// Lichess reads the rating history api
+type Lichess struct {
+	fetcher
+}
+
+func NewLichess(baseURL string, client *http.Client) *Lichess {
+	return &Lichess{fetcher: newFetcher(baseURL, client)}
+}
+
+func (l *Lichess) Site() string {
+	return "lichess"
+}
+
+func (l *Lichess) History(ctx context.Context, username string) (History, error) {
+	var perfs []struct {
+		Name   string  `json:"name"`
+		Points [][]int `json:"points"`
+	}
+	if err := l.getJSON(ctx, "/api/user/"+url.PathEscape(username)+"/rating-history", &perfs); err != nil {
+		return nil, err
+	}
+
+	history := make(History)
+	for _, perf := range perfs {
+		if perf.Name == "Puzzles" {
+			continue
+		}
+		tc, ok := lichessPools[perf.Name]
+		if !ok {
+			tc = Variants
+		}
+		// points are [year, month from 0, day, rating]
+		for i, point := range perf.Points {
+			if len(point) < 4 {
+				continue
+			}
+			history[tc] = append(history[tc], Point{
+				Rating:      point[3],
+				Date:        time.Date(point[0], time.Month(point[1]+1), point[2], 0, 0, 0, 0, time.UTC),
+				Provisional: i < lichessProvisionalPoints,
+			})
+		}
+	}
+	return history, nil
+}
+
+// Profile returns the bio and the location
+func (l *Lichess) Profile(ctx context.Context, username string) (string, error) {
+	var user struct {
+		Profile struct {
+			Bio      string `json:"bio"`
+			Location string `json:"location"`
+		} `json:"profile"`
+	}
+	if err := l.getJSON(ctx, "/api/user/"+url.PathEscape(username), &user); err != nil {
+		return "", err
+	}
+	return user.Profile.Bio + "\n" + user.Profile.Location, nil
+}
+
+// chesscomPools maps chess.com stats keys; daily games are correspondence, not classical
+var chesscomPools = map[string]TimeControl{
+	"chess_bullet":   Bullet,
+	"chess_blitz":    Blitz,
+	"chess_rapid":    Rapid,
+	"chess_daily":    Correspondence,
+	"chess960_daily": Variants,
+}
+
+// ChessCom reads the player stats api. it only knows the best and the current rating
+// of every pool and does not say whether the best one was provisional
+type ChessCom struct {
+	fetcher
+}
+
+func NewChessCom(baseURL string, client *http.Client) *ChessCom {
+	return &ChessCom{fetcher: newFetcher(baseURL, client)}
+}
+
+func (c *ChessCom) Site() string {
+	return "chesscom"
+}
+
+func (c *ChessCom) History(ctx context.Context, username string) (History, error) {
+	type rating struct {
+		Rating int   `json:"rating"`
+		Date   int64 `json:"date"`
+	}
+	// stats also hold fields of other shapes like "fide": 1700, so only known pools are decoded
+	var stats map[string]json.RawMessage
+	if err := c.getJSON(ctx, "/pub/player/"+url.PathEscape(strings.ToLower(username))+"/stats", &stats); err != nil {
+		return nil, err
+	}
+
+	history := make(History)
+	for key, tc := range chesscomPools {
+		data, ok := stats[key]
+		if !ok {
+			continue
+		}
+		var pool struct {
+			Last *rating `json:"last"`
+			Best *rating `json:"best"`
+		}
+		if err := json.Unmarshal(data, &pool); err != nil {
+			return nil, fmt.Errorf("failed to parse chess.com %s: %w", key, err)
+		}
+		for _, r := range []*rating{pool.Best, pool.Last} {
+			if r == nil || r.Rating == 0 {
+				continue
+			}
+			history[tc] = append(history[tc], Point{Rating: r.Rating, Date: time.Unix(r.Date, 0).UTC()})
+		}
+	}
+	return history, nil
+}
+
+// Profile returns the location; the public api does not expose the bio
+func (c *ChessCom) Profile(ctx context.Context, username string) (string, error) {
+	var player struct {
+		Location string `json:"location"`
+	}
+	if err := c.getJSON(ctx, "/pub/player/"+url.PathEscape(strings.ToLower(username)), &player); err != nil {
+		return "", err
+	}
+	return player.Location, nil
+}
+
+// Cache keeps histories for a while so repeated check-ins do not hit the sites
+type Cache interface {
+	Get(ctx context.Context, key string) (History, bool, error)
+	Set(ctx context.Context, key string, history History, ttl time.Duration) error
+}
+
+// Cached serves histories from the cache and asks the provider only on a miss.
+// profiles are never cached: verification has to see the latest edit
+type Cached struct {
+	Provider
+	cache Cache
+	ttl   time.Duration
+}
+
+func NewCached(provider Provider, cache Cache, ttl time.Duration) *Cached {
+	return &Cached{Provider: provider, cache: cache, ttl: ttl}
+}
+
+func (c *Cached) History(ctx context.Context, username string) (History, error) {
+	key := c.Site() + ":" + strings.ToLower(username)
+
+	if history, ok, err := c.cache.Get(ctx, key); err == nil && ok {
+		return history, nil
+	}
+
+	history, err := c.Provider.History(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	// a failing cache only costs an extra request next time
+	_ = c.cache.Set(ctx, key, history, c.ttl)
+	return history, nil
+}
@@ -0,0 +1,240 @@
+package ratings
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func noSleep(context.Context, time.Duration) error { return nil }
+
+func TestLichessHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/user/someone/rating-history" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("user agent: got %q", r.Header.Get("User-Agent"))
+		}
+		fmt.Fprint(w, `[
+			{"name": "Blitz", "points": [[2020,0,1,1500],[2020,0,2,1510],[2020,0,3,1520],[2020,0,4,1530],[2020,0,5,1540],[2020,0,6,1800],[2020,0,7,1700]]},
+			{"name": "Rapid", "points": []},
+			{"name": "Correspondence", "points": [[2021,11,31,1650]]},
+			{"name": "Atomic", "points": [[2022,0,1,1900]]},
+			{"name": "Puzzles", "points": [[2022,0,1,2500]]}
+		]`)
+	}))
+	defer server.Close()
+
+	history, err := NewLichess(server.URL, server.Client()).History(context.Background(), "someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history[Blitz]) != 7 || history[Blitz][5].Rating != 1800 {
+		t.Errorf("blitz: got %+v", history[Blitz])
+	}
+	if !history[Blitz][4].Provisional || history[Blitz][5].Provisional {
+		t.Errorf("the first %d points should be provisional: %+v", lichessProvisionalPoints, history[Blitz])
+	}
+	want := Point{Rating: 1650, Date: time.Date(2021, time.December, 31, 0, 0, 0, 0, time.UTC), Provisional: true}
+	if len(history[Correspondence]) != 1 || history[Correspondence][0] != want {
+		t.Errorf("correspondence: got %+v, want %+v", history[Correspondence], want)
+	}
+	if len(history[Variants]) != 1 || history[Variants][0].Rating != 1900 {
+		t.Errorf("variants: got %+v", history[Variants])
+	}
+	if len(history) != 3 {
+		t.Errorf("got pools %v, want blitz, correspondence and variants", history)
+	}
+}
+
+func TestChessComHistory(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/pub/player/someone/stats" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{
+			"chess_bullet": {"last": {"rating": 1500, "date": 1700000000}, "best": {"rating": 1600, "date": 1600000000}},
+			"chess_blitz": {"best": {"rating": 1650, "date": 1600000000}},
+			"chess_rapid": {"best": {"rating": 1750, "date": 1600000000}},
+			"chess_daily": {"best": {"rating": 1400, "date": 1600000000}},
+			"tactics": {"highest": {"rating": 2400}},
+			"fide": 1700
+		}`)
+	}))
+	defer server.Close()
+
+	history, err := NewChessCom(server.URL, server.Client()).History(context.Background(), "Someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peaks := Policy{TimeControls: TimeControls}.Peaks(history, time.Now())
+	if got := peaks.String(); got != "пуля 1600, блиц 1650, рапид 1750, заочные 1400" {
+		t.Errorf("got %q", got)
+	}
+	if _, ok := history[Classical]; ok {
+		t.Errorf("daily games must not count as classical: %+v", history[Classical])
+	}
+	if len(history[Bullet]) != 2 {
+		t.Errorf("bullet should keep the best and the last rating: %+v", history[Bullet])
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewChessCom(server.URL, server.Client()).History(context.Background(), "nobody")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRetriesAfterTooManyRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"chess_blitz": {"best": {"rating": 1650, "date": 1600000000}}}`)
+	}))
+	defer server.Close()
+
+	var waits []time.Duration
+	provider := NewChessCom(server.URL, server.Client())
+	provider.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	history, err := provider.History(context.Background(), "someone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history[Blitz]) != 1 || history[Blitz][0].Rating != 1650 {
+		t.Errorf("got %+v", history)
+	}
+	if len(waits) != 2 || waits[0] != 7*time.Second {
+		t.Errorf("waits: got %v, want two waits of 7s", waits)
+	}
+}
+
+func TestGivesUpWhenStillRateLimited(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	provider := NewLichess(server.URL, server.Client())
+	provider.sleep = noSleep
+
+	_, err := provider.History(context.Background(), "someone")
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("got %v, want ErrRateLimited", err)
+	}
+	if calls.Load() != maxRetries+1 {
+		t.Errorf("got %d requests, want %d", calls.Load(), maxRetries+1)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	if got := retryAfter("", 0); got != time.Second {
+		t.Errorf("first backoff: got %v", got)
+	}
+	if got := retryAfter("", 2); got != 4*time.Second {
+		t.Errorf("third backoff: got %v", got)
+	}
+	if got := retryAfter("3600", 0); got != maxBackoff {
+		t.Errorf("long retry-after: got %v, want capped at %v", got, maxBackoff)
+	}
+}
+
+type memoryCache map[string]History
+
+func (m memoryCache) Get(_ context.Context, key string) (History, bool, error) {
+	history, ok := m[key]
+	return history, ok, nil
+}
+
+func (m memoryCache) Set(_ context.Context, key string, history History, _ time.Duration) error {
+	m[key] = history
+	return nil
+}
+
+func TestCachedAsksTheSiteOnce(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		fmt.Fprint(w, `{"chess_rapid": {"best": {"rating": 1750, "date": 1600000000}}}`)
+	}))
+	defer server.Close()
+
+	cache := memoryCache{}
+	provider := NewCached(NewChessCom(server.URL, server.Client()), cache, time.Hour)
+
+	for _, username := range []string{"Someone", "someone"} {
+		history, err := provider.History(context.Background(), username)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(history[Rapid]) != 1 {
+			t.Errorf("got %+v", history)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("got %d requests, want 1", calls.Load())
+	}
+	if _, ok := cache["chesscom:someone"]; !ok {
+		t.Errorf("cache keys: %v", cache)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/user/someone":
+			fmt.Fprint(w, `{"id": "someone", "profile": {"bio": "hi", "location": "Moscow MSHK-0A1B2C3D"}}`)
+		case "/pub/player/someone":
+			fmt.Fprint(w, `{"username": "someone", "location": "Moscow"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	token := "mshk-0a1b2c3d"
+
+	if ok, err := Verify(ctx, NewLichess(server.URL, server.Client()), "someone", token); err != nil || !ok {
+		t.Errorf("lichess: got %v, %v; want the token found in the location", ok, err)
+	}
+	if ok, err := Verify(ctx, NewChessCom(server.URL, server.Client()), "someone", token); err != nil || ok {
+		t.Errorf("chess.com: got %v, %v; want no token", ok, err)
+	}
+	if ok, _ := Verify(ctx, NewLichess(server.URL, server.Client()), "someone", ""); ok {
+		t.Errorf("an empty token must never verify")
+	}
+	if _, err := Verify(ctx, NewLichess(server.URL, server.Client()), "nobody", token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	a, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewToken()
+	if a == b || len(a) != len(tokenPrefix)+8 {
+		t.Errorf("tokens %q and %q should be distinct and %d characters long", a, b, len(tokenPrefix)+8)
+	}
+}
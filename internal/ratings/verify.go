@@ -0,0 +1,32 @@
+package ratings
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// tokenPrefix makes verification codes easy to spot in a profile
+const tokenPrefix = "mshk-"
+
+// NewToken returns a one-time code a player puts in their profile to prove the account is theirs
+func NewToken() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return tokenPrefix + hex.EncodeToString(b), nil
+}
+
+// Verify reports whether the public profile of the account contains the token
+func Verify(ctx context.Context, provider Provider, username, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	profile, err := provider.Profile(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(strings.ToLower(profile), strings.ToLower(token)), nil
+}
@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	redisClient "github.com/go-redis/redis/v8"
+)
+
+// adminProcessesKey is a sorted set of admin process keys scored by when they expire
+const adminProcessesKey = "admin_processes"
+
+// adminProcessGrace keeps a timed out process around long enough to cancel its prompt,
+// even if the bot was down when it expired
+const adminProcessGrace = 24 * time.Hour
+
+// AdminProcesses stores admin processes under admin_process:<chat id>:<admin id>
+type AdminProcesses struct{}
+
+func adminProcessKey(key string) string {
+	return fmt.Sprintf("admin_process:%s", key)
+}
+
+func (AdminProcesses) Load(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := Client.Get(ctx, adminProcessKey(key)).Bytes()
+	if err == redisClient.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (AdminProcesses) Save(ctx context.Context, key string, data []byte, expiresAt time.Time) error {
+	_, err := Client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		pipe.Set(ctx, adminProcessKey(key), data, time.Until(expiresAt)+adminProcessGrace)
+		pipe.ZAdd(ctx, adminProcessesKey, &redisClient.Z{Score: float64(expiresAt.Unix()), Member: key})
+		return nil
+	})
+	return err
+}
+
+func (AdminProcesses) Delete(ctx context.Context, key string) error {
+	_, err := Client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		pipe.Del(ctx, adminProcessKey(key))
+		pipe.ZRem(ctx, adminProcessesKey, key)
+		return nil
+	})
+	return err
+}
+
+func (AdminProcesses) Expired(ctx context.Context, now time.Time) ([]string, error) {
+	return Client.ZRangeByScore(ctx, adminProcessesKey, &redisClient.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.Unix(), 10),
+	}).Result()
+}
@@ -3,21 +3,105 @@ package redis
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 
 	redisClient "github.com/go-redis/redis/v8"
 	"github.com/sukalov/mshkbot/internal/types"
 )
 
-func SetList(ctx context.Context, list []types.Player) error {
+const tournamentIDsKey = "tournaments"
+
+// maxUpdateAttempts bounds retries of a list update that keeps losing to other writers
+const maxUpdateAttempts = 10
+
+// keys used before tournaments were keyed by id
+const (
+	legacyListKey     = "tournament_list"
+	legacyMetadataKey = "tournament_metadata"
+)
+
+func listKey(tournamentID string) string {
+	return fmt.Sprintf("tournament:%s:list", tournamentID)
+}
+
+func departedKey(tournamentID string) string {
+	return fmt.Sprintf("tournament:%s:departed", tournamentID)
+}
+
+func metadataKey(tournamentID string) string {
+	return fmt.Sprintf("tournament:%s:metadata", tournamentID)
+}
+
+func roundsKey(tournamentID string) string {
+	return fmt.Sprintf("tournament:%s:rounds", tournamentID)
+}
+
+// Tournaments stores open tournaments under tournament:<id>:<part> and their ids in a set
+type Tournaments struct{}
+
+func (Tournaments) SetList(ctx context.Context, tournamentID string, list []types.Player) error {
 	listJSON, err := json.Marshal(list)
 	if err != nil {
 		return err
 	}
-	return Client.Set(ctx, "tournament_list", listJSON, 0).Err()
+	return Client.Set(ctx, listKey(tournamentID), listJSON, 0).Err()
+}
+
+func (Tournaments) GetList(ctx context.Context, tournamentID string) ([]types.Player, error) {
+	return getList(ctx, Client, listKey(tournamentID))
+}
+
+// UpdateList watches the list and departed keys, so the write fails and fn runs again if
+// another replica changed either after they were read
+func (Tournaments) UpdateList(ctx context.Context, tournamentID string, fn func(list, departed []types.Player) ([]types.Player, []types.Player, error)) ([]types.Player, []types.Player, error) {
+	key, departedKey := listKey(tournamentID), departedKey(tournamentID)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var updated, updatedDeparted []types.Player
+		err := Client.Watch(ctx, func(tx *redisClient.Tx) error {
+			list, err := getList(ctx, tx, key)
+			if err != nil {
+				return err
+			}
+			departed, err := getList(ctx, tx, departedKey)
+			if err != nil {
+				return err
+			}
+			if updated, updatedDeparted, err = fn(list, departed); err != nil {
+				return err
+			}
+			listJSON, err := json.Marshal(updated)
+			if err != nil {
+				return err
+			}
+			departedJSON, err := json.Marshal(updatedDeparted)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+				pipe.Set(ctx, key, listJSON, 0)
+				pipe.Set(ctx, departedKey, departedJSON, 0)
+				return nil
+			})
+			return err
+		}, key, departedKey)
+		if err == redisClient.TxFailedErr {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return updated, updatedDeparted, nil
+	}
+	return nil, nil, fmt.Errorf("list of tournament %s kept changing, gave up after %d attempts", tournamentID, maxUpdateAttempts)
+}
+
+// getter is the client or a transaction
+type getter interface {
+	Get(ctx context.Context, key string) *redisClient.StringCmd
 }
 
-func GetList(ctx context.Context) ([]types.Player, error) {
-	data, err := Client.Get(ctx, "tournament_list").Bytes()
+func getList(ctx context.Context, client getter, key string) ([]types.Player, error) {
+	data, err := client.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redisClient.Nil {
 			return []types.Player{}, nil
@@ -31,16 +115,33 @@ func GetList(ctx context.Context) ([]types.Player, error) {
 	return list, nil
 }
 
-func SetMetadata(ctx context.Context, metadata types.TournamentMetadata) error {
+// SetDeparted stores players that were removed from the list of a tournament
+func (Tournaments) SetDeparted(ctx context.Context, tournamentID string, list []types.Player) error {
+	listJSON, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return Client.Set(ctx, departedKey(tournamentID), listJSON, 0).Err()
+}
+
+func (Tournaments) GetDeparted(ctx context.Context, tournamentID string) ([]types.Player, error) {
+	return getList(ctx, Client, departedKey(tournamentID))
+}
+
+func (Tournaments) SetMetadata(ctx context.Context, tournamentID string, metadata types.TournamentMetadata) error {
 	metadataJSON, err := json.Marshal(metadata)
 	if err != nil {
 		return err
 	}
-	return Client.Set(ctx, "tournament_metadata", metadataJSON, 0).Err()
+	return Client.Set(ctx, metadataKey(tournamentID), metadataJSON, 0).Err()
 }
 
-func GetMetadata(ctx context.Context) (types.TournamentMetadata, error) {
-	data, err := Client.Get(ctx, "tournament_metadata").Bytes()
+func (Tournaments) GetMetadata(ctx context.Context, tournamentID string) (types.TournamentMetadata, error) {
+	return getMetadata(ctx, metadataKey(tournamentID))
+}
+
+func getMetadata(ctx context.Context, key string) (types.TournamentMetadata, error) {
+	data, err := Client.Get(ctx, key).Bytes()
 	if err != nil {
 		if err == redisClient.Nil {
 			return types.TournamentMetadata{}, nil
@@ -53,3 +154,65 @@ func GetMetadata(ctx context.Context) (types.TournamentMetadata, error) {
 	}
 	return metadata, nil
 }
+
+// SetRounds stores the paired rounds of a tournament
+func (Tournaments) SetRounds(ctx context.Context, tournamentID string, rounds []types.Round) error {
+	roundsJSON, err := json.Marshal(rounds)
+	if err != nil {
+		return err
+	}
+	return Client.Set(ctx, roundsKey(tournamentID), roundsJSON, 0).Err()
+}
+
+func (Tournaments) GetRounds(ctx context.Context, tournamentID string) ([]types.Round, error) {
+	data, err := Client.Get(ctx, roundsKey(tournamentID)).Bytes()
+	if err != nil {
+		if err == redisClient.Nil {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rounds []types.Round
+	if err := json.Unmarshal(data, &rounds); err != nil {
+		return nil, err
+	}
+	return rounds, nil
+}
+
+// AddTournamentID registers a tournament id in the set of open tournaments
+func (Tournaments) AddTournamentID(ctx context.Context, tournamentID string) (bool, error) {
+	added, err := Client.SAdd(ctx, tournamentIDsKey, tournamentID).Result()
+	return added > 0, err
+}
+
+// GetTournamentIDs returns ids of all open tournaments
+func (Tournaments) GetTournamentIDs(ctx context.Context) ([]string, error) {
+	return Client.SMembers(ctx, tournamentIDsKey).Result()
+}
+
+// DeleteTournament removes list, departed players, metadata, rounds and the id of a tournament
+func (Tournaments) DeleteTournament(ctx context.Context, tournamentID string) error {
+	pipe := Client.TxPipeline()
+	pipe.Del(ctx, listKey(tournamentID), departedKey(tournamentID), metadataKey(tournamentID), roundsKey(tournamentID))
+	pipe.SRem(ctx, tournamentIDsKey, tournamentID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// GetLegacyTournament reads the single tournament stored under the old fixed keys
+func (Tournaments) GetLegacyTournament(ctx context.Context) ([]types.Player, types.TournamentMetadata, error) {
+	list, err := getList(ctx, Client, legacyListKey)
+	if err != nil {
+		return nil, types.TournamentMetadata{}, err
+	}
+	metadata, err := getMetadata(ctx, legacyMetadataKey)
+	if err != nil {
+		return nil, types.TournamentMetadata{}, err
+	}
+	return list, metadata, nil
+}
+
+// DeleteLegacyTournament drops the old fixed keys after migration
+func (Tournaments) DeleteLegacyTournament(ctx context.Context) error {
+	return Client.Del(ctx, legacyListKey, legacyMetadataKey).Err()
+}
@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	redisClient "github.com/go-redis/redis/v8"
+	"github.com/sukalov/mshkbot/internal/jobs"
+)
+
+// jobsKey is a sorted set of job ids scored by when they may run next, in unix milliseconds
+const jobsKey = "jobs"
+
+// claimJobs moves the due jobs forward by the lease and returns their ids, in one step,
+// so two replicas never claim the same job
+var claimJobs = redisClient.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+for _, id in ipairs(ids) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+return ids
+`)
+
+// finishJob deletes a job only if it was not scheduled again after it was claimed
+var finishJob = redisClient.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('DEL', KEYS[1])
+	redis.call('ZREM', KEYS[2], ARGV[2])
+end
+return 0
+`)
+
+// retryJob replaces a claimed job with its next attempt only if it was not scheduled again after it was claimed
+var retryJob = redisClient.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('SET', KEYS[1], ARGV[2])
+	redis.call('ZADD', KEYS[2], ARGV[3], ARGV[4])
+end
+return 0
+`)
+
+// Jobs stores jobs under job:<id> and their ids in a sorted set
+type Jobs struct{}
+
+func jobKey(id string) string {
+	return fmt.Sprintf("job:%s", id)
+}
+
+func (Jobs) Save(ctx context.Context, job jobs.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	_, err = Client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		pipe.Set(ctx, jobKey(job.ID), data, 0)
+		pipe.ZAdd(ctx, jobsKey, &redisClient.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+		return nil
+	})
+	return err
+}
+
+func (j Jobs) Claim(ctx context.Context, now time.Time, lease time.Duration) ([]jobs.Job, error) {
+	ids, err := claimJobs.Run(ctx, Client, []string{jobsKey},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(lease).UnixMilli(), 10),
+	).StringSlice()
+	if err != nil {
+		return nil, err
+	}
+	return j.load(ctx, ids)
+}
+
+func (Jobs) Finish(ctx context.Context, job jobs.Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return finishJob.Run(ctx, Client, []string{jobKey(job.ID), jobsKey}, data, job.ID).Err()
+}
+
+func (Jobs) Retry(ctx context.Context, claimed, next jobs.Job) error {
+	claimedData, err := json.Marshal(claimed)
+	if err != nil {
+		return err
+	}
+	nextData, err := json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	return retryJob.Run(ctx, Client, []string{jobKey(claimed.ID), jobsKey},
+		claimedData, nextData, strconv.FormatInt(next.RunAt.UnixMilli(), 10), next.ID,
+	).Err()
+}
+
+func (Jobs) Delete(ctx context.Context, id string) error {
+	_, err := Client.TxPipelined(ctx, func(pipe redisClient.Pipeliner) error {
+		pipe.Del(ctx, jobKey(id))
+		pipe.ZRem(ctx, jobsKey, id)
+		return nil
+	})
+	return err
+}
+
+func (j Jobs) List(ctx context.Context) ([]jobs.Job, error) {
+	ids, err := Client.ZRange(ctx, jobsKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return j.load(ctx, ids)
+}
+
+// load reads the jobs with the ids, dropping ids whose job is gone
+func (Jobs) load(ctx context.Context, ids []string) ([]jobs.Job, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = jobKey(id)
+	}
+	values, err := Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make([]jobs.Job, 0, len(ids))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			if err := Client.ZRem(ctx, jobsKey, ids[i]).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var job jobs.Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, fmt.Errorf("failed to decode job %s: %w", ids[i], err)
+		}
+		loaded = append(loaded, job)
+	}
+	return loaded, nil
+}
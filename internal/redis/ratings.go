@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	redisClient "github.com/go-redis/redis/v8"
+	"github.com/sukalov/mshkbot/internal/ratings"
+)
+
+// RatingsCache stores rating histories under ratings:<site>:<username> until they expire
+type RatingsCache struct{}
+
+func ratingsKey(key string) string {
+	return fmt.Sprintf("ratings:%s", key)
+}
+
+func (RatingsCache) Get(ctx context.Context, key string) (ratings.History, bool, error) {
+	data, err := Client.Get(ctx, ratingsKey(key)).Result()
+	if err == redisClient.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var history ratings.History
+	if err := json.Unmarshal([]byte(data), &history); err != nil {
+		return nil, false, err
+	}
+	return history, true, nil
+}
+
+func (RatingsCache) Set(ctx context.Context, key string, history ratings.History, ttl time.Duration) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return Client.Set(ctx, ratingsKey(key), data, ttl).Err()
+}
@@ -3,41 +3,34 @@ package redis
 import (
 	"context"
 	"fmt"
-	"os"
 	"time"
 
 	redisClient "github.com/go-redis/redis/v8"
-	"github.com/sukalov/mshkbot/internal/utils"
 )
 
 var Client *redisClient.Client
 
 type RedisClient *redisClient.Client
 
-func init() {
-	env, err := utils.LoadEnv([]string{"REDIS_URL", "REDIS_PASSWORD"})
+// Connect opens the connection the stores of this package use and checks it with a ping
+func Connect(url, password string) error {
+	opt, err := redisClient.ParseURL(fmt.Sprintf("rediss://default:%s@%s", password, url))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load redis db env %s.", err)
-		os.Exit(1)
+		return fmt.Errorf("failed to parse redis url: %w", err)
 	}
 
-	opt, err := redisClient.ParseURL(fmt.Sprintf("rediss://default:%s@%s", env["REDIS_PASSWORD"], env["REDIS_URL"]))
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse redis URL: %s.", err)
-		os.Exit(1)
-	}
-
-	Client = redisClient.NewClient(opt)
+	client := redisClient.NewClient(opt)
 
-	// Ping to verify connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err = Client.Ping(ctx).Result()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to connect to redis: %s.", err)
-		os.Exit(1)
+	if _, err := client.Ping(ctx).Result(); err != nil {
+		client.Close()
+		return fmt.Errorf("failed to connect to redis: %w", err)
 	}
+
+	Client = client
+	return nil
 }
 
 // Close closes the redis connection
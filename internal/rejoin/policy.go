@@ -0,0 +1,142 @@
+// Package rejoin decides whether and when a player who checked out may check in again
+package rejoin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultCooldownMinutes is the wait after a checkout used before policies were configurable
+const DefaultCooldownMinutes = 15
+
+// Policy says whether a player who checked out may come back to the tournament.
+// the zero value lets them back at the end of the list after the default cooldown, as many times as they like
+type Policy struct {
+	// CooldownMinutes is how long a player waits after checking out, nil for the default
+	CooldownMinutes *int `json:"cooldown_minutes,omitempty"`
+	Forbidden       bool `json:"forbidden,omitempty"`
+	// KeepPlace puts a player who comes back where they were in the list,
+	// so they are ahead of everyone who checked in after them
+	KeepPlace bool `json:"keep_place,omitempty"`
+	// MaxCheckouts is how many times a player may check out of one tournament, 0 for no limit.
+	// the last allowed checkout is final
+	MaxCheckouts int `json:"max_checkouts,omitempty"`
+}
+
+// Cooldown is how long a player waits after checking out
+func (p Policy) Cooldown() time.Duration {
+	minutes := DefaultCooldownMinutes
+	if p.CooldownMinutes != nil {
+		minutes = *p.CooldownMinutes
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Allows reports whether a player who checked out the given number of times may come back at all
+func (p Policy) Allows(checkouts int) bool {
+	if p.Forbidden {
+		return false
+	}
+	return p.MaxCheckouts == 0 || checkouts < p.MaxCheckouts
+}
+
+// RejoinAt is when a player who checked out at checkedOutAt may come back
+func (p Policy) RejoinAt(checkedOutAt time.Time) time.Time {
+	return checkedOutAt.Add(p.Cooldown())
+}
+
+// Set changes one field from an admin spec. keys are
+// cooldown=15 (minutes, 0 to come back right away), rejoin=yes|no, place=back|keep
+// and checkouts=2 (0 for no limit). reports false if the key is not a policy key
+func (p *Policy) Set(key, value string) (bool, error) {
+	switch strings.ToLower(key) {
+	case "cooldown":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, fmt.Errorf("cooldown должно быть неотрицательным числом минут")
+		}
+		p.CooldownMinutes = &n
+	case "rejoin":
+		switch strings.ToLower(value) {
+		case "yes", "да", "1":
+			p.Forbidden = false
+		case "no", "нет", "0":
+			p.Forbidden = true
+		default:
+			return true, fmt.Errorf("rejoin должно быть yes или no")
+		}
+	case "place":
+		switch strings.ToLower(value) {
+		case "back":
+			p.KeepPlace = false
+		case "keep":
+			p.KeepPlace = true
+		default:
+			return true, fmt.Errorf("place должно быть back или keep")
+		}
+	case "checkouts":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return true, fmt.Errorf("checkouts должно быть неотрицательным числом")
+		}
+		p.MaxCheckouts = n
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// ParsePolicy reads a spec written by Spec
+func ParsePolicy(spec string) (Policy, error) {
+	var p Policy
+	for _, token := range strings.Fields(spec) {
+		key, value, _ := strings.Cut(token, "=")
+		ok, err := p.Set(key, value)
+		if err != nil {
+			return Policy{}, err
+		}
+		if !ok {
+			return Policy{}, fmt.Errorf("неизвестное поле %q", key)
+		}
+	}
+	return p, nil
+}
+
+// Spec is the policy in the form admins type it; empty for the default policy
+func (p Policy) Spec() string {
+	var fields []string
+	if p.CooldownMinutes != nil {
+		fields = append(fields, fmt.Sprintf("cooldown=%d", *p.CooldownMinutes))
+	}
+	if p.Forbidden {
+		fields = append(fields, "rejoin=no")
+	}
+	if p.KeepPlace {
+		fields = append(fields, "place=keep")
+	}
+	if p.MaxCheckouts > 0 {
+		fields = append(fields, fmt.Sprintf("checkouts=%d", p.MaxCheckouts))
+	}
+	return strings.Join(fields, " ")
+}
+
+func (p Policy) String() string {
+	if p.Forbidden {
+		return "без возврата"
+	}
+	s := "возврат сразу"
+	if minutes := int(p.Cooldown() / time.Minute); minutes > 0 {
+		s = fmt.Sprintf("возврат через %d мин", minutes)
+	}
+	if p.KeepPlace {
+		s += " на своё место"
+	} else {
+		s += " в конец списка"
+	}
+	if p.MaxCheckouts > 0 {
+		s += fmt.Sprintf(", выйти можно не больше %d раз", p.MaxCheckouts)
+	}
+	return s
+}
@@ -0,0 +1,39 @@
+package rejoin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicySpecRoundTrip(t *testing.T) {
+	for _, spec := range []string{"", "cooldown=0", "cooldown=30 place=keep checkouts=2", "rejoin=no"} {
+		policy, err := ParsePolicy(spec)
+		if err != nil {
+			t.Fatalf("%q: %v", spec, err)
+		}
+		if got := policy.Spec(); got != spec {
+			t.Errorf("%q came back as %q", spec, got)
+		}
+	}
+}
+
+func TestPolicyDecisions(t *testing.T) {
+	checkedOut := time.Date(2026, time.October, 17, 18, 0, 0, 0, time.UTC)
+
+	policy := Policy{}
+	if !policy.Allows(5) || !policy.RejoinAt(checkedOut).Equal(checkedOut.Add(15*time.Minute)) {
+		t.Errorf("default policy must let players back after 15 minutes however often they leave")
+	}
+
+	policy, _ = ParsePolicy("cooldown=0 checkouts=2")
+	if !policy.RejoinAt(checkedOut).Equal(checkedOut) {
+		t.Errorf("cooldown=0 must let players back right away")
+	}
+	if !policy.Allows(1) || policy.Allows(2) {
+		t.Errorf("checkouts=2 must make the second checkout final")
+	}
+
+	if _, err := ParsePolicy("place=front"); err == nil {
+		t.Errorf("unknown place was accepted")
+	}
+}
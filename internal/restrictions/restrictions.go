@@ -0,0 +1,92 @@
+// Package restrictions parses and describes how long a ban or a green suspension lasts
+package restrictions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// foreverThreshold makes restrictions ending further away than this permanent
+const foreverThreshold = 50 * 365 * 24 * time.Hour
+
+// Forever is the end of a permanent restriction
+func Forever(now time.Time) time.Time {
+	return now.AddDate(100, 0, 0)
+}
+
+// IsForever reports whether a restriction ending at until is permanent
+func IsForever(until, now time.Time) bool {
+	return until.Sub(now) > foreverThreshold
+}
+
+var relative = regexp.MustCompile(`^(\d+)\s*([a-zа-я]+)$`)
+
+// units are the suffixes of relative durations; m is a month, bans are never set in minutes
+var units = map[string]func(t time.Time, n int) time.Time{
+	"h":  func(t time.Time, n int) time.Time { return t.Add(time.Duration(n) * time.Hour) },
+	"ч":  func(t time.Time, n int) time.Time { return t.Add(time.Duration(n) * time.Hour) },
+	"d":  func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n) },
+	"д":  func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n) },
+	"w":  func(t time.Time, n int) time.Time { return t.AddDate(0, 0, 7*n) },
+	"н":  func(t time.Time, n int) time.Time { return t.AddDate(0, 0, 7*n) },
+	"m":  func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) },
+	"mo": func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) },
+	"м":  func(t time.Time, n int) time.Time { return t.AddDate(0, n, 0) },
+	"y":  func(t time.Time, n int) time.Time { return t.AddDate(n, 0, 0) },
+	"г":  func(t time.Time, n int) time.Time { return t.AddDate(n, 0, 0) },
+}
+
+var dateLayouts = []string{"2006-01-02", "02.01.2006"}
+
+// ParseUntil turns what an admin typed into the end of a restriction. it accepts
+// forever, month, relative durations like 12h, 10d, 2w, 3m, 1y and dates like
+// "until 2026-12-01" or "до 01.12.2026", which end at the start of that day in loc
+func ParseUntil(text string, now time.Time, loc *time.Location) (time.Time, error) {
+	text = strings.ToLower(strings.TrimSpace(text))
+
+	switch text {
+	case "forever", "навсегда":
+		return Forever(now), nil
+	case "month", "месяц":
+		return now.AddDate(0, 1, 0), nil
+	case "week", "неделя":
+		return now.AddDate(0, 0, 7), nil
+	}
+
+	if m := relative.FindStringSubmatch(text); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n <= 0 {
+			return time.Time{}, fmt.Errorf("срок должен быть больше нуля")
+		}
+		add, ok := units[m[2]]
+		if !ok {
+			return time.Time{}, fmt.Errorf("непонятная единица %q, есть h, d, w, m, y", m[2])
+		}
+		return add(now, n), nil
+	}
+
+	date := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(text, "until"), "до"))
+	for _, layout := range dateLayouts {
+		until, err := time.ParseInLocation(layout, date, loc)
+		if err != nil {
+			continue
+		}
+		if !until.After(now) {
+			return time.Time{}, fmt.Errorf("дата %s уже прошла", date)
+		}
+		return until, nil
+	}
+
+	return time.Time{}, fmt.Errorf("не понял срок %q. примеры: 2w, 10d, 3m, навсегда, до 01.12.2026", text)
+}
+
+// Describe says how long a restriction lasts, like "навсегда" or "до 01.12.2026 00:00"
+func Describe(until, now time.Time, loc *time.Location) string {
+	if IsForever(until, now) {
+		return "навсегда"
+	}
+	return "до " + until.In(loc).Format("02.01.2006 15:04")
+}
@@ -0,0 +1,56 @@
+package restrictions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUntil(t *testing.T) {
+	moscow := time.FixedZone("moscow", 3*60*60)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, moscow)
+
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"2w", now.AddDate(0, 0, 14)},
+		{"10d", now.AddDate(0, 0, 10)},
+		{"12h", now.Add(12 * time.Hour)},
+		{"3m", now.AddDate(0, 3, 0)},
+		{"1 y", now.AddDate(1, 0, 0)},
+		{"2н", now.AddDate(0, 0, 14)},
+		{"month", now.AddDate(0, 1, 0)},
+		{"Навсегда", Forever(now)},
+		{"until 2026-12-01", time.Date(2026, 12, 1, 0, 0, 0, 0, moscow)},
+		{"до 01.12.2026", time.Date(2026, 12, 1, 0, 0, 0, 0, moscow)},
+		{"2027-01-15", time.Date(2027, 1, 15, 0, 0, 0, 0, moscow)},
+	}
+	for _, tt := range tests {
+		got, err := ParseUntil(tt.text, now, moscow)
+		if err != nil {
+			t.Errorf("ParseUntil(%q) failed: %v", tt.text, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("ParseUntil(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	for _, text := range []string{"", "0d", "5x", "until 2026-01-01", "скоро"} {
+		if _, err := ParseUntil(text, now, moscow); err == nil {
+			t.Errorf("ParseUntil(%q) should fail", text)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	moscow := time.FixedZone("moscow", 3*60*60)
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, moscow)
+
+	if got := Describe(Forever(now), now, moscow); got != "навсегда" {
+		t.Errorf("forever described as %q", got)
+	}
+	if got := Describe(time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC), now, moscow); got != "до 01.12.2026 03:00" {
+		t.Errorf("date described as %q", got)
+	}
+}
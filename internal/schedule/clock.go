@@ -0,0 +1,44 @@
+package schedule
+
+import (
+	"log"
+	"time"
+	_ "time/tzdata"
+)
+
+// Clock is the source of time for the scheduler so tests can control it
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+// RealClock returns the system clock
+func RealClock() Clock {
+	return realClock{}
+}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var moscow = loadMoscow()
+
+// Moscow returns the time zone the schedule runs in
+func Moscow() *time.Location {
+	return moscow
+}
+
+func loadMoscow() *time.Location {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		log.Printf("failed to load moscow timezone, falling back to utc+3: %v", err)
+		return time.FixedZone("moscow", 3*60*60)
+	}
+	return loc
+}
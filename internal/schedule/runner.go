@@ -0,0 +1,62 @@
+package schedule
+
+import (
+	"log"
+	"time"
+)
+
+// how long to wait before retrying when the schedule cannot be loaded
+const retryDelay = time.Minute
+
+// Runner fires open and close actions of recurring events at their wall-clock times.
+// every wait is computed from the current schedule, so edits and clock drift never accumulate
+type Runner struct {
+	Location *time.Location
+	Clock    Clock
+	Load     func() ([]Event, error)
+	Execute  func(Action)
+	Reload   <-chan struct{}
+	// Reloaded is called after every edit of the schedule, before the next wait is computed
+	Reloaded func()
+	Stop     <-chan struct{}
+}
+
+// Run blocks until Stop is closed
+func (r *Runner) Run() {
+	after := r.Clock.Now()
+
+	for {
+		events, err := r.Load()
+		if err != nil {
+			log.Printf("failed to load schedule: %v", err)
+		}
+
+		var timer <-chan time.Time
+		at, actions := NextActions(events, after, r.Location)
+		if len(actions) > 0 {
+			wait := at.Sub(r.Clock.Now())
+			log.Printf("next scheduled action in %v (at %s)", wait.Round(time.Second), at.In(r.Location).Format("2006-01-02 15:04:05"))
+			timer = r.Clock.After(wait)
+		} else if err != nil {
+			timer = r.Clock.After(retryDelay)
+		}
+
+		select {
+		case <-timer:
+			for _, action := range actions {
+				r.Execute(action)
+			}
+			if len(actions) > 0 {
+				after = at
+			}
+		case <-r.Reload:
+			log.Println("schedule changed, reloading")
+			if r.Reloaded != nil {
+				r.Reloaded()
+			}
+			after = r.Clock.Now()
+		case <-r.Stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/rejoin"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// Event is a recurring weekly tournament: registration opens and closes on the same weekday
+type Event struct {
+	ID                  uint
+	Key                 string
+	Name                string
+	Weekday             time.Weekday
+	OpenHour            int
+	OpenMinute          int
+	CloseHour           int
+	CloseMinute         int
+	Limit               int
+	LichessRatingLimit  int
+	ChesscomRatingLimit int
+	ClubRatingLimit     int
+	AnnouncementIntro   string
+	ConfirmationMinutes int
+	PeakPolicy          ratings.Policy
+	RejoinPolicy        rejoin.Policy
+	RequireVerified     bool
+	Paused              bool
+}
+
+// DefaultEvents is the schedule the club used before it became editable
+func DefaultEvents() []Event {
+	return []Event{
+		{
+			Key:               "south",
+			Name:              "южный",
+			Weekday:           time.Monday,
+			OpenHour:          15,
+			OpenMinute:        35,
+			CloseHour:         21,
+			Limit:             26,
+			AnnouncementIntro: "запись на южный турнир открыта. нажмите /checkin чтобы записаться",
+		},
+		{
+			Key:                 "green",
+			Name:                "зелёный",
+			Weekday:             time.Tuesday,
+			OpenHour:            12,
+			CloseHour:           21,
+			Limit:               24,
+			LichessRatingLimit:  1600,
+			ChesscomRatingLimit: 1400,
+			AnnouncementIntro:   "открыта запись на зелёный турнир. нажмите /checkin чтобы записаться",
+		},
+		{
+			Key:               "ladya",
+			Name:              "ладья",
+			Weekday:           time.Wednesday,
+			OpenHour:          12,
+			CloseHour:         21,
+			Limit:             24,
+			AnnouncementIntro: "можно записываться на турнир в ладье. нажмите /checkin чтобы записаться",
+		},
+	}
+}
+
+// Metadata builds the tournament of the window that opened last at or before now.
+// registration closes when play starts, so the close time doubles as the start time
+func (e Event) Metadata(now time.Time, loc *time.Location) types.TournamentMetadata {
+	return types.TournamentMetadata{
+		ID:                  e.Key,
+		Name:                e.Name,
+		Limit:               e.Limit,
+		LichessRatingLimit:  e.LichessRatingLimit,
+		ChesscomRatingLimit: e.ChesscomRatingLimit,
+		ClubRatingLimit:     e.ClubRatingLimit,
+		AnnouncementIntro:   e.AnnouncementIntro,
+		ConfirmationMinutes: e.ConfirmationMinutes,
+		PeakPolicy:          e.PeakPolicy,
+		RejoinPolicy:        e.RejoinPolicy,
+		RequireVerified:     e.RequireVerified,
+		StartsAt:            e.closeAfter(e.lastOpen(now, loc), loc),
+	}
+}
+
+// closesNextDay reports whether registration closes after midnight
+func (e Event) closesNextDay() bool {
+	return e.CloseHour*60+e.CloseMinute <= e.OpenHour*60+e.OpenMinute
+}
+
+func (e Event) String() string {
+	status := ""
+	if e.Paused {
+		status = " (на паузе)"
+	}
+	limits := fmt.Sprintf("лимит %d", e.Limit)
+	if e.LichessRatingLimit > 0 {
+		limits += fmt.Sprintf(", lichess < %d", e.LichessRatingLimit)
+	}
+	if e.ChesscomRatingLimit > 0 {
+		limits += fmt.Sprintf(", chess.com < %d", e.ChesscomRatingLimit)
+	}
+	if e.ClubRatingLimit > 0 {
+		limits += fmt.Sprintf(", клуб < %d", e.ClubRatingLimit)
+	}
+	if e.ConfirmationMinutes > 0 {
+		limits += fmt.Sprintf(", подтверждение %d мин", e.ConfirmationMinutes)
+	}
+	if e.PeakPolicy.Spec() != "" {
+		limits += fmt.Sprintf(", пики: %s", e.PeakPolicy)
+	}
+	if e.RejoinPolicy.Spec() != "" {
+		limits += fmt.Sprintf(", %s", e.RejoinPolicy)
+	}
+	if e.RequireVerified {
+		limits += ", только подтверждённые аккаунты"
+	}
+	return fmt.Sprintf("%s — %s, %s %02d:%02d–%02d:%02d, %s%s",
+		e.Key, e.Name, weekdayNames[e.Weekday], e.OpenHour, e.OpenMinute, e.CloseHour, e.CloseMinute, limits, status)
+}
+
+var weekdayNames = map[time.Weekday]string{
+	time.Monday:    "пн",
+	time.Tuesday:   "вт",
+	time.Wednesday: "ср",
+	time.Thursday:  "чт",
+	time.Friday:    "пт",
+	time.Saturday:  "сб",
+	time.Sunday:    "вс",
+}
+
+var weekdayAliases = map[string]time.Weekday{
+	"пн": time.Monday, "mon": time.Monday, "monday": time.Monday, "понедельник": time.Monday,
+	"вт": time.Tuesday, "tue": time.Tuesday, "tuesday": time.Tuesday, "вторник": time.Tuesday,
+	"ср": time.Wednesday, "wed": time.Wednesday, "wednesday": time.Wednesday, "среда": time.Wednesday,
+	"чт": time.Thursday, "thu": time.Thursday, "thursday": time.Thursday, "четверг": time.Thursday,
+	"пт": time.Friday, "fri": time.Friday, "friday": time.Friday, "пятница": time.Friday,
+	"сб": time.Saturday, "sat": time.Saturday, "saturday": time.Saturday, "суббота": time.Saturday,
+	"вс": time.Sunday, "sun": time.Sunday, "sunday": time.Sunday, "воскресенье": time.Sunday,
+}
+
+// Apply updates the event from a spec like
+// "вт 12:00-21:00 limit=24 lichess=1600 chesscom=1400 club=1500 confirm=30 verified=yes name=зелёный | intro text".
+// peaks=, provisional= and months= set the peak policy (see ratings.Policy.Set),
+// cooldown=, rejoin=, place= and checkouts= the rejoin policy (see rejoin.Policy.Set). fields that are not mentioned keep their values
+func (e *Event) Apply(spec string) error {
+	fields, intro, hasIntro := strings.Cut(spec, "|")
+	if hasIntro {
+		e.AnnouncementIntro = strings.TrimSpace(intro)
+	}
+
+	for _, token := range strings.Fields(fields) {
+		lower := strings.ToLower(token)
+
+		if weekday, ok := weekdayAliases[lower]; ok {
+			e.Weekday = weekday
+			continue
+		}
+
+		if open, close, ok := strings.Cut(lower, "-"); ok && strings.Contains(open, ":") {
+			openHour, openMinute, err := parseClock(open)
+			if err != nil {
+				return err
+			}
+			closeHour, closeMinute, err := parseClock(close)
+			if err != nil {
+				return err
+			}
+			e.OpenHour, e.OpenMinute = openHour, openMinute
+			e.CloseHour, e.CloseMinute = closeHour, closeMinute
+			continue
+		}
+
+		key, value, ok := strings.Cut(token, "=")
+		if !ok {
+			return fmt.Errorf("не понял %q", token)
+		}
+
+		switch strings.ToLower(key) {
+		case "name":
+			e.Name = value
+		case "verified":
+			switch strings.ToLower(value) {
+			case "yes", "да", "1":
+				e.RequireVerified = true
+			case "no", "нет", "0":
+				e.RequireVerified = false
+			default:
+				return fmt.Errorf("verified должно быть yes или no")
+			}
+		case "limit", "lichess", "chesscom", "club", "confirm":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("%s должен быть неотрицательным числом", key)
+			}
+			switch strings.ToLower(key) {
+			case "limit":
+				e.Limit = n
+			case "lichess":
+				e.LichessRatingLimit = n
+			case "chesscom":
+				e.ChesscomRatingLimit = n
+			case "club":
+				e.ClubRatingLimit = n
+			case "confirm":
+				e.ConfirmationMinutes = n
+			}
+		default:
+			ok, err := e.PeakPolicy.Set(key, value)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				ok, err = e.RejoinPolicy.Set(key, value)
+			}
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("неизвестное поле %q", key)
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseClock(s string) (int, int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("время должно быть в формате чч:мм, а не %q", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// ActionKind says whether a scheduled action opens or closes registration
+type ActionKind string
+
+const (
+	ActionOpen  ActionKind = "open"
+	ActionClose ActionKind = "close"
+)
+
+// Action is one moment at which the scheduler has to do something
+type Action struct {
+	Kind  ActionKind
+	Event Event
+	At    time.Time
+}
+
+// NextActions returns the earliest moment strictly after the given time
+// together with every action due at that moment. paused events are skipped
+func NextActions(events []Event, after time.Time, loc *time.Location) (time.Time, []Action) {
+	var all []Action
+	for _, e := range events {
+		if e.Paused {
+			continue
+		}
+		closeWeekday := e.Weekday
+		if e.closesNextDay() {
+			closeWeekday = (e.Weekday + 1) % 7
+		}
+		all = append(all,
+			Action{Kind: ActionOpen, Event: e, At: nextOccurrence(after, e.Weekday, e.OpenHour, e.OpenMinute, loc)},
+			Action{Kind: ActionClose, Event: e, At: nextOccurrence(after, closeWeekday, e.CloseHour, e.CloseMinute, loc)},
+		)
+	}
+	if len(all) == 0 {
+		return time.Time{}, nil
+	}
+
+	sort.SliceStable(all, func(i, j int) bool { return all[i].At.Before(all[j].At) })
+
+	at := all[0].At
+	var due []Action
+	for _, action := range all {
+		if !action.At.Equal(at) {
+			break
+		}
+		due = append(due, action)
+	}
+	return at, due
+}
+
+// nextOccurrence returns the first weekday/hour/minute in loc strictly after the given time.
+// dates are built from the local calendar so daylight saving shifts keep the wall-clock time
+func nextOccurrence(after time.Time, weekday time.Weekday, hour, minute int, loc *time.Location) time.Time {
+	local := after.In(loc)
+	daysUntil := (int(weekday) - int(local.Weekday()) + 7) % 7
+
+	target := time.Date(local.Year(), local.Month(), local.Day()+daysUntil, hour, minute, 0, 0, loc)
+	if !target.After(after) {
+		target = time.Date(local.Year(), local.Month(), local.Day()+daysUntil+7, hour, minute, 0, 0, loc)
+	}
+	return target
+}
+
+// lastOpen returns the latest opening of the event at or before now
+func (e Event) lastOpen(now time.Time, loc *time.Location) time.Time {
+	local := now.In(loc)
+	daysSince := (int(local.Weekday()) - int(e.Weekday) + 7) % 7
+
+	open := time.Date(local.Year(), local.Month(), local.Day()-daysSince, e.OpenHour, e.OpenMinute, 0, 0, loc)
+	if open.After(now) {
+		open = time.Date(local.Year(), local.Month(), local.Day()-daysSince-7, e.OpenHour, e.OpenMinute, 0, 0, loc)
+	}
+	return open
+}
+
+// closeAfter returns the closing that belongs to the given opening
+func (e Event) closeAfter(open time.Time, loc *time.Location) time.Time {
+	local := open.In(loc)
+	day := local.Day()
+	if e.closesNextDay() {
+		day++
+	}
+	return time.Date(local.Year(), local.Month(), day, e.CloseHour, e.CloseMinute, 0, 0, loc)
+}
+
+// IsActive reports whether registration of the event should be open right now
+func IsActive(e Event, now time.Time, loc *time.Location) bool {
+	if e.Paused {
+		return false
+	}
+	open := e.lastOpen(now, loc)
+	return now.Before(e.closeAfter(open, loc))
+}
+
+// LastClose returns the latest closing of the event at or before now
+func LastClose(e Event, now time.Time, loc *time.Location) time.Time {
+	open := e.lastOpen(now, loc)
+	closeTime := e.closeAfter(open, loc)
+	if closeTime.After(now) {
+		closeTime = e.closeAfter(open.AddDate(0, 0, -7), loc)
+	}
+	return closeTime
+}
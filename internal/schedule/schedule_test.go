@@ -0,0 +1,287 @@
+package schedule
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load %s: %v", name, err)
+	}
+	return loc
+}
+
+func greenEvent() Event {
+	return Event{Key: "green", Weekday: time.Tuesday, OpenHour: 12, CloseHour: 21, Limit: 24}
+}
+
+func TestNextOccurrenceKeepsWallClockAcrossDST(t *testing.T) {
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	// clocks go forward on 2026-03-29 at 02:00 in berlin
+	after := time.Date(2026, 3, 22, 13, 0, 0, 0, berlin)
+	next := nextOccurrence(after, time.Sunday, 12, 0, berlin)
+
+	want := time.Date(2026, 3, 29, 12, 0, 0, 0, berlin)
+	if !next.Equal(want) {
+		t.Fatalf("next occurrence = %s, want %s", next, want)
+	}
+	if next.Sub(after) == 7*24*time.Hour {
+		t.Fatalf("expected a 167h week across the dst switch, got exactly 168h")
+	}
+}
+
+func TestNextActionsReturnsSimultaneousActions(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	events := []Event{
+		greenEvent(),
+		{Key: "blitz", Weekday: time.Tuesday, OpenHour: 12, CloseHour: 20},
+		{Key: "paused", Weekday: time.Tuesday, OpenHour: 11, CloseHour: 20, Paused: true},
+	}
+
+	after := time.Date(2026, 10, 19, 23, 0, 0, 0, moscow) // monday
+	at, actions := NextActions(events, after, moscow)
+
+	want := time.Date(2026, 10, 20, 12, 0, 0, 0, moscow)
+	if !at.Equal(want) {
+		t.Fatalf("next action at %s, want %s", at, want)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("got %d actions, want 2 opens", len(actions))
+	}
+	for _, action := range actions {
+		if action.Kind != ActionOpen {
+			t.Errorf("action for %s is %s, want open", action.Event.Key, action.Kind)
+		}
+	}
+}
+
+func TestIsActiveAfterRestartInsideWindow(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	event := greenEvent()
+
+	cases := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{"before opening", time.Date(2026, 10, 20, 11, 59, 0, 0, moscow), false},
+		{"right at opening", time.Date(2026, 10, 20, 12, 0, 0, 0, moscow), true},
+		{"restart in the afternoon", time.Date(2026, 10, 20, 15, 30, 0, 0, moscow), true},
+		{"after closing", time.Date(2026, 10, 20, 21, 0, 0, 0, moscow), false},
+		{"another day", time.Date(2026, 10, 22, 15, 0, 0, 0, moscow), false},
+	}
+
+	for _, c := range cases {
+		if got := IsActive(event, c.now, moscow); got != c.want {
+			t.Errorf("%s: IsActive = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	paused := event
+	paused.Paused = true
+	if IsActive(paused, time.Date(2026, 10, 20, 15, 0, 0, 0, moscow), moscow) {
+		t.Errorf("paused event must never be active")
+	}
+}
+
+func TestLastClose(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	event := greenEvent()
+
+	now := time.Date(2026, 10, 22, 10, 0, 0, 0, moscow) // thursday
+	want := time.Date(2026, 10, 20, 21, 0, 0, 0, moscow)
+	if got := LastClose(event, now, moscow); !got.Equal(want) {
+		t.Fatalf("last close = %s, want %s", got, want)
+	}
+
+	// during the window the previous week's close is the latest one
+	now = time.Date(2026, 10, 20, 13, 0, 0, 0, moscow)
+	want = time.Date(2026, 10, 13, 21, 0, 0, 0, moscow)
+	if got := LastClose(event, now, moscow); !got.Equal(want) {
+		t.Fatalf("last close = %s, want %s", got, want)
+	}
+}
+
+func TestApply(t *testing.T) {
+	event := Event{Key: "rapid"}
+	if err := event.Apply("сб 11:00-01:30 limit=30 lichess=1800 name=рапид | запись на рапид открыта"); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	if event.Weekday != time.Saturday || event.OpenHour != 11 || event.CloseHour != 1 || event.CloseMinute != 30 {
+		t.Errorf("unexpected time fields: %+v", event)
+	}
+	if event.Limit != 30 || event.LichessRatingLimit != 1800 || event.Name != "рапид" {
+		t.Errorf("unexpected limits or name: %+v", event)
+	}
+	if event.AnnouncementIntro != "запись на рапид открыта" {
+		t.Errorf("intro = %q", event.AnnouncementIntro)
+	}
+	if !event.closesNextDay() {
+		t.Errorf("event closing at 01:30 must close the next day")
+	}
+
+	if err := event.Apply("limit=abc"); err == nil {
+		t.Errorf("expected an error for a non-numeric limit")
+	}
+
+	if err := event.Apply("peaks=blitz+rapid months=12"); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got := event.PeakPolicy.Spec(); got != "peaks=blitz+rapid months=12" {
+		t.Errorf("peak policy = %q", got)
+	}
+	if event.Limit != 30 {
+		t.Errorf("peak fields must not reset the limit: %+v", event)
+	}
+}
+
+// fakeClock only moves when the test advances it
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	added   chan struct{}
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, added: make(chan struct{}, 16)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	c.added <- struct{}{}
+	return ch
+}
+
+func (c *fakeClock) Advance(to time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = to
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.at.After(to) {
+			w.ch <- to
+			continue
+		}
+		remaining = append(remaining, w)
+	}
+	c.waiters = remaining
+}
+
+func (c *fakeClock) waitForTimer(t *testing.T) {
+	t.Helper()
+	select {
+	case <-c.added:
+	case <-time.After(time.Second):
+		t.Fatalf("runner did not start waiting")
+	}
+}
+
+func TestRunnerFiresAtWallClockTimes(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	clock := newFakeClock(time.Date(2026, 10, 19, 23, 0, 0, 0, moscow))
+
+	executed := make(chan Action, 4)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	runner := &Runner{
+		Location: moscow,
+		Clock:    clock,
+		Load:     func() ([]Event, error) { return []Event{greenEvent()}, nil },
+		Execute:  func(a Action) { executed <- a },
+		Reload:   make(chan struct{}),
+		Stop:     stop,
+	}
+	go runner.Run()
+
+	expect := func(kind ActionKind, at time.Time) {
+		t.Helper()
+		clock.waitForTimer(t)
+		clock.Advance(at)
+		select {
+		case action := <-executed:
+			if action.Kind != kind || !action.At.Equal(at) {
+				t.Fatalf("got %s at %s, want %s at %s", action.Kind, action.At, kind, at)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s at %s was not executed", kind, at)
+		}
+	}
+
+	expect(ActionOpen, time.Date(2026, 10, 20, 12, 0, 0, 0, moscow))
+	expect(ActionClose, time.Date(2026, 10, 20, 21, 0, 0, 0, moscow))
+	expect(ActionOpen, time.Date(2026, 10, 27, 12, 0, 0, 0, moscow))
+}
+
+func TestRunnerReloadsEditedSchedule(t *testing.T) {
+	moscow := mustLoad(t, "Europe/Moscow")
+	clock := newFakeClock(time.Date(2026, 10, 19, 23, 0, 0, 0, moscow))
+
+	var mu sync.Mutex
+	events := []Event{greenEvent()}
+
+	executed := make(chan Action, 4)
+	reload := make(chan struct{}, 1)
+	reloaded := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+
+	runner := &Runner{
+		Location: moscow,
+		Clock:    clock,
+		Load: func() ([]Event, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]Event(nil), events...), nil
+		},
+		Execute:  func(a Action) { executed <- a },
+		Reload:   reload,
+		Reloaded: func() { reloaded <- struct{}{} },
+		Stop:     stop,
+	}
+	go runner.Run()
+	clock.waitForTimer(t)
+
+	mu.Lock()
+	events[0].OpenHour = 10
+	mu.Unlock()
+	reload <- struct{}{}
+	clock.waitForTimer(t)
+	select {
+	case <-reloaded:
+	default:
+		t.Fatalf("reload hook was not called")
+	}
+
+	at := time.Date(2026, 10, 20, 10, 0, 0, 0, moscow)
+	clock.Advance(at)
+	select {
+	case action := <-executed:
+		if action.Kind != ActionOpen || !action.At.Equal(at) {
+			t.Fatalf("got %s at %s, want open at %s", action.Kind, action.At, at)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("edited opening was not executed")
+	}
+}
@@ -0,0 +1,187 @@
+// Package suspects finds users who may be the same person registered twice
+package suspects
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sukalov/mshkbot/internal/ratings"
+)
+
+// Person is what the checks know about a registered user
+type Person struct {
+	ID       int64
+	Username string
+	Name     string
+	Lichess  string
+	ChessCom string
+}
+
+func (p Person) String() string {
+	if p.Username != "" {
+		return fmt.Sprintf("%s (@%s, %d)", p.Name, p.Username, p.ID)
+	}
+	return fmt.Sprintf("%s (%d)", p.Name, p.ID)
+}
+
+// Pair is two people and why they look alike
+type Pair struct {
+	A, B   Person
+	Reason string
+}
+
+// minNameLength keeps short names like "max" from matching everything one letter away
+const minNameLength = 5
+
+// SimilarNames pairs people whose saved names differ at most by one edit
+// after dropping case, spaces, digits and punctuation
+func SimilarNames(people []Person) []Pair {
+	var pairs []Pair
+	for i := range people {
+		a := normalizeName(people[i].Name)
+		if a == "" {
+			continue
+		}
+		for j := i + 1; j < len(people); j++ {
+			b := normalizeName(people[j].Name)
+			if b == "" {
+				continue
+			}
+			switch {
+			case a == b:
+				pairs = append(pairs, Pair{A: people[i], B: people[j], Reason: "одинаковые ники"})
+			case len([]rune(a)) >= minNameLength && distance(a, b) <= 1:
+				pairs = append(pairs, Pair{A: people[i], B: people[j], Reason: "похожие ники"})
+			}
+		}
+	}
+	return pairs
+}
+
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// distance is the levenshtein distance between two strings
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// SharedAccounts pairs people who point at the same account. usernames are compared
+// without case because both sites ignore it, and a lichess name equal to someone
+// else's chess.com name is reported too since players usually keep one nickname
+func SharedAccounts(people []Person) []Pair {
+	var pairs []Pair
+	for i := range people {
+		for j := i + 1; j < len(people); j++ {
+			if reason := sharedAccount(people[i], people[j]); reason != "" {
+				pairs = append(pairs, Pair{A: people[i], B: people[j], Reason: reason})
+			}
+		}
+	}
+	return pairs
+}
+
+func sharedAccount(a, b Person) string {
+	same := func(x, y string) bool {
+		return x != "" && strings.EqualFold(x, y)
+	}
+	switch {
+	case same(a.Lichess, b.Lichess):
+		return "один аккаунт на личесе: " + a.Lichess
+	case same(a.ChessCom, b.ChessCom):
+		return "один аккаунт на чесскоме: " + a.ChessCom
+	case same(a.Lichess, b.ChessCom):
+		return fmt.Sprintf("личес одного совпадает с чесскомом другого: %s", a.Lichess)
+	case same(a.ChessCom, b.Lichess):
+		return fmt.Sprintf("чесском одного совпадает с личесом другого: %s", a.ChessCom)
+	}
+	return ""
+}
+
+// minSharedPoints is how many identical rating points two histories need to count as one
+const minSharedPoints = 5
+
+// HistoriesMatch reports whether two histories share enough days with the same rating
+// in the same pool to be the same account under different names
+func HistoriesMatch(a, b ratings.History) bool {
+	shared := 0
+	for tc, points := range a {
+		seen := make(map[string]bool, len(points))
+		for _, p := range points {
+			seen[pointKey(p)] = true
+		}
+		for _, p := range b[tc] {
+			if seen[pointKey(p)] {
+				shared++
+			}
+		}
+	}
+	return shared >= minSharedPoints
+}
+
+func pointKey(p ratings.Point) string {
+	return fmt.Sprintf("%s/%d", p.Date.Format("2006-01-02"), p.Rating)
+}
+
+// Account is a rating history of one linked account of a person
+type Account struct {
+	Person  Person
+	Site    string
+	History ratings.History
+}
+
+// MatchingHistories pairs different people whose accounts have matching histories
+func MatchingHistories(accounts []Account) []Pair {
+	var pairs []Pair
+	reported := make(map[[2]int64]bool)
+	for i := range accounts {
+		for j := i + 1; j < len(accounts); j++ {
+			a, b := accounts[i], accounts[j]
+			key := [2]int64{min(a.Person.ID, b.Person.ID), max(a.Person.ID, b.Person.ID)}
+			if a.Person.ID == b.Person.ID || reported[key] {
+				continue
+			}
+			if HistoriesMatch(a.History, b.History) {
+				reported[key] = true
+				pairs = append(pairs, Pair{A: a.Person, B: b.Person, Reason: fmt.Sprintf("совпадает история рейтинга (%s и %s)", a.Site, b.Site)})
+			}
+		}
+	}
+	return pairs
+}
+
+// Sort orders pairs by the ids of both people so reports are stable
+func Sort(pairs []Pair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].A.ID != pairs[j].A.ID {
+			return pairs[i].A.ID < pairs[j].A.ID
+		}
+		return pairs[i].B.ID < pairs[j].B.ID
+	})
+}
@@ -0,0 +1,97 @@
+package suspects
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/ratings"
+)
+
+func TestSimilarNames(t *testing.T) {
+	people := []Person{
+		{ID: 1, Name: "Ivan Petrov"},
+		{ID: 2, Name: "ivan_petrov2"},
+		{ID: 3, Name: "Ivan Petrow"},
+		{ID: 4, Name: "Max"},
+		{ID: 5, Name: "Mix"},
+		{ID: 6, Name: "Anna Smirnova"},
+	}
+
+	pairs := SimilarNames(people)
+
+	want := map[[2]int64]string{
+		{1, 2}: "одинаковые ники",
+		{1, 3}: "похожие ники",
+		{2, 3}: "похожие ники",
+	}
+	if len(pairs) != len(want) {
+		t.Fatalf("got %d pairs, want %d: %+v", len(pairs), len(want), pairs)
+	}
+	for _, p := range pairs {
+		if reason, ok := want[[2]int64{p.A.ID, p.B.ID}]; !ok || reason != p.Reason {
+			t.Errorf("unexpected pair %d–%d: %s", p.A.ID, p.B.ID, p.Reason)
+		}
+	}
+}
+
+func TestSharedAccounts(t *testing.T) {
+	people := []Person{
+		{ID: 1, Lichess: "Magnus"},
+		{ID: 2, Lichess: "magnus"},
+		{ID: 3, ChessCom: "MAGNUS"},
+		{ID: 4, Lichess: "hikaru", ChessCom: "someone"},
+	}
+
+	pairs := SharedAccounts(people)
+
+	if len(pairs) != 3 {
+		t.Fatalf("got %+v, want 1–2, 1–3 and 2–3", pairs)
+	}
+	if pairs[0].Reason != "один аккаунт на личесе: Magnus" {
+		t.Errorf("reason: %q", pairs[0].Reason)
+	}
+}
+
+func TestMatchingHistories(t *testing.T) {
+	history := func(start int, days int) ratings.History {
+		h := ratings.History{}
+		for d := 0; d < days; d++ {
+			h[ratings.Blitz] = append(h[ratings.Blitz], ratings.Point{
+				Rating: start + d,
+				Date:   time.Date(2024, time.January, 1+d, 0, 0, 0, 0, time.UTC),
+			})
+		}
+		return h
+	}
+
+	accounts := []Account{
+		{Person: Person{ID: 1}, Site: "lichess", History: history(1500, 10)},
+		{Person: Person{ID: 2}, Site: "lichess", History: history(1500, 10)},
+		{Person: Person{ID: 2}, Site: "chesscom", History: history(1500, 10)},
+		{Person: Person{ID: 3}, Site: "lichess", History: history(1600, 10)},
+		{Person: Person{ID: 4}, Site: "lichess", History: history(1500, 3)},
+	}
+
+	pairs := MatchingHistories(accounts)
+
+	if len(pairs) != 1 || pairs[0].A.ID != 1 || pairs[0].B.ID != 2 {
+		t.Errorf("got %+v, want only 1–2 reported once", pairs)
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"иван", "иван", 0},
+		{"иван", "иванн", 1},
+	}
+	for _, tt := range tests {
+		if got := distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
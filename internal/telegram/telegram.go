@@ -0,0 +1,213 @@
+// Package telegram talks to the Bot API: one http client for every call, retries when
+// telegram asks to slow down or fails on its side, requests to one chat go out one at a time, and refusals
+// come back as errors callers can branch on
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultURL is the Bot API host used when no other is configured
+const DefaultURL = "https://api.telegram.org"
+
+const (
+	// requestTimeout is above the 60 seconds getUpdates waits for new updates
+	requestTimeout = 75 * time.Second
+	maxRetries     = 3
+)
+
+// kinds of refusals, match them with errors.Is
+var (
+	ErrMessageNotModified = errors.New("message is not modified")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrBlocked            = errors.New("bot was blocked or can't write to the chat")
+	ErrRateLimited        = errors.New("too many requests")
+)
+
+// Error is a request telegram refused
+type Error struct {
+	Method      string
+	Code        int
+	Description string
+	kind        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("telegram %s: %d %s", e.Method, e.Code, e.Description)
+}
+
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+func classify(code int, description string) error {
+	description = strings.ToLower(description)
+	switch {
+	case code == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case code == http.StatusForbidden:
+		return ErrBlocked
+	case strings.Contains(description, "message is not modified"):
+		return ErrMessageNotModified
+	case strings.Contains(description, "message to edit not found"),
+		strings.Contains(description, "message to delete not found"),
+		strings.Contains(description, "message to pin not found"),
+		strings.Contains(description, "message to react not found"),
+		strings.Contains(description, "message not found"):
+		return ErrMessageNotFound
+	}
+	return nil
+}
+
+// Client wraps the library client; API is exposed for what the wrapper doesn't cover,
+// like receiving updates
+type Client struct {
+	API   *tgbotapi.BotAPI
+	sleep func(time.Duration)
+	chats sync.Map
+}
+
+// New connects to the Bot API at baseURL, DefaultURL if empty, and checks the token
+func New(token, baseURL string) (*Client, error) {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	endpoint := strings.TrimRight(baseURL, "/") + "/bot%s/%s"
+
+	api, err := tgbotapi.NewBotAPIWithClient(token, endpoint, &http.Client{Timeout: requestTimeout})
+	if err != nil {
+		return nil, sanitize(token, "getMe", err)
+	}
+	return &Client{API: api, sleep: time.Sleep}, nil
+}
+
+// Send sends a message and returns it as telegram stored it
+func (c *Client) Send(chattable tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var message tgbotapi.Message
+	err := c.do(chatOf(chattable), methodOf(chattable), func() error {
+		var err error
+		message, err = c.API.Send(chattable)
+		return err
+	})
+	return message, err
+}
+
+// Request makes any library request
+func (c *Client) Request(chattable tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := c.do(chatOf(chattable), methodOf(chattable), func() error {
+		var err error
+		resp, err = c.API.Request(chattable)
+		return err
+	})
+	return resp, err
+}
+
+// Call makes a request the library has no config for. chatID orders it with other
+// requests to the chat, 0 if it isn't about a chat
+func (c *Client) Call(chatID int64, method string, params tgbotapi.Params) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := c.do(chatID, method, func() error {
+		var err error
+		resp, err = c.API.MakeRequest(method, params)
+		return err
+	})
+	return resp, err
+}
+
+// do runs a request after the earlier requests to the same chat. it repeats the request
+// while telegram answers 429, waiting as long as it asks, and after network errors and 5xx
+// with a growing delay. the chat is not held while waiting, so other senders to it go on
+func (c *Client) do(chatID int64, method string, request func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := c.inOrder(chatID, request)
+		if err == nil {
+			return nil
+		}
+
+		wait, retry := retryDelay(err, attempt)
+		if !retry || attempt >= maxRetries {
+			return sanitize(c.API.Token, method, err)
+		}
+		log.Printf("telegram %s failed, retrying in %s: %v", method, wait, sanitize(c.API.Token, method, err))
+		c.sleep(wait)
+	}
+}
+
+// inOrder runs a request once, after the requests to the same chat that came before it
+func (c *Client) inOrder(chatID int64, request func() error) error {
+	if chatID == 0 {
+		return request()
+	}
+	lock, _ := c.chats.LoadOrStore(chatID, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+	return request()
+}
+
+// retryDelay says whether a failed request is worth repeating and after how long.
+// telegram refusals other than 429 and 5xx are final
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		// the request did not get an answer from telegram
+		return time.Duration(attempt+1) * time.Second, true
+	}
+	switch {
+	case apiErr.Code == http.StatusTooManyRequests:
+		wait := time.Duration(apiErr.RetryAfter) * time.Second
+		if wait <= 0 {
+			wait = time.Second
+		}
+		return wait, true
+	case apiErr.Code >= http.StatusInternalServerError:
+		return time.Duration(attempt+1) * time.Second, true
+	}
+	return 0, false
+}
+
+// sanitize turns library errors into Error and makes sure the token,
+// which is part of every request url, never ends up in logs
+func sanitize(token, method string, err error) error {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return &Error{Method: method, Code: apiErr.Code, Description: apiErr.Message, kind: classify(apiErr.Code, apiErr.Message)}
+	}
+	message := err.Error()
+	if token != "" {
+		message = strings.ReplaceAll(message, token, "<token>")
+	}
+	return fmt.Errorf("telegram %s: %s", method, message)
+}
+
+// chatOf finds the chat of the configs the bot sends, 0 for the rest
+func chatOf(chattable tgbotapi.Chattable) int64 {
+	switch c := chattable.(type) {
+	case tgbotapi.MessageConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return c.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return c.ChatID
+	case tgbotapi.DeleteMessageConfig:
+		return c.ChatID
+	case tgbotapi.PinChatMessageConfig:
+		return c.ChatID
+	case tgbotapi.UnpinChatMessageConfig:
+		return c.ChatID
+	}
+	return 0
+}
+
+// methodOf names a request in logs and errors
+func methodOf(chattable tgbotapi.Chattable) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", chattable), "tgbotapi.")
+}
@@ -0,0 +1,141 @@
+package telegram
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/telegramtest"
+)
+
+func newClient(t *testing.T) (*Client, *telegramtest.Server, *[]time.Duration) {
+	t.Helper()
+	s := telegramtest.NewServer()
+	t.Cleanup(s.Close)
+
+	c, err := New(telegramtest.Token, s.URL)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	var waits []time.Duration
+	c.sleep = func(d time.Duration) { waits = append(waits, d) }
+	return c, s, &waits
+}
+
+func TestRetriesAfterFloodLimit(t *testing.T) {
+	c, s, waits := newClient(t)
+	s.Fail("sendMessage", 429, "Too Many Requests: retry after 3", 3)
+	s.Fail("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+
+	if _, err := c.Send(tgbotapi.NewMessage(1, "привет")); err != nil {
+		t.Fatalf("send should succeed after retries: %v", err)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 3*time.Second || (*waits)[1] != time.Second {
+		t.Errorf("expected waits of 3s and 1s, got %v", *waits)
+	}
+	if m, ok := s.LastMessage(1); !ok || m.Text != "привет" {
+		t.Errorf("message not delivered: %+v", m)
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	c, s, _ := newClient(t)
+	for i := 0; i <= maxRetries; i++ {
+		s.Fail("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+	}
+	_, err := c.Send(tgbotapi.NewMessage(1, "привет"))
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestRetriesServerErrors(t *testing.T) {
+	c, s, waits := newClient(t)
+	s.Fail("sendMessage", 502, "Bad Gateway", 0)
+
+	if _, err := c.Send(tgbotapi.NewMessage(1, "привет")); err != nil {
+		t.Fatalf("send should succeed after a retry: %v", err)
+	}
+	if len(*waits) != 1 {
+		t.Errorf("expected one wait, got %v", *waits)
+	}
+}
+
+func TestDoesNotHoldTheChatWhileWaiting(t *testing.T) {
+	c, s, _ := newClient(t)
+	s.Fail("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+
+	// a second message to the chat goes out while the first one waits
+	waiting := make(chan struct{})
+	proceed := make(chan struct{})
+	c.sleep = func(time.Duration) {
+		close(waiting)
+		<-proceed
+	}
+	done := make(chan error)
+	go func() {
+		_, err := c.Send(tgbotapi.NewMessage(1, "первое"))
+		done <- err
+	}()
+	<-waiting
+
+	sent := make(chan error)
+	go func() {
+		_, err := c.Send(tgbotapi.NewMessage(1, "второе"))
+		sent <- err
+	}()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Errorf("second send failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("the chat was held while waiting")
+	}
+	close(proceed)
+	if err := <-done; err != nil {
+		t.Errorf("first send failed: %v", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	c, s, _ := newClient(t)
+
+	sent, err := c.Send(tgbotapi.NewMessage(-100, "список"))
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	_, err = c.Send(tgbotapi.NewEditMessageText(-100, sent.MessageID, "список"))
+	if !errors.Is(err, ErrMessageNotModified) {
+		t.Errorf("expected ErrMessageNotModified, got %v", err)
+	}
+	_, err = c.Call(-100, "pinChatMessage", tgbotapi.Params{"chat_id": "-100", "message_id": "999"})
+	if !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+
+	s.Block(7)
+	_, err = c.Send(tgbotapi.NewMessage(7, "привет"))
+	if !errors.Is(err, ErrBlocked) {
+		t.Errorf("expected ErrBlocked, got %v", err)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != 403 {
+		t.Errorf("expected *Error with code 403, got %#v", err)
+	}
+}
+
+func TestErrorsHideToken(t *testing.T) {
+	c, s, _ := newClient(t)
+	s.Close()
+
+	_, err := c.Send(tgbotapi.NewMessage(1, "привет"))
+	if err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	if strings.Contains(err.Error(), telegramtest.Token) {
+		t.Errorf("token leaked into error: %v", err)
+	}
+}
@@ -0,0 +1,479 @@
+// Package telegramtest is an in-process fake of the Telegram Bot API. it keeps the messages
+// the bot sent with their edits, pins and reactions, and hands out updates injected by a test
+package telegramtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is the only token the server accepts
+const Token = "123456:test-token"
+
+// BotUser is who the fake bot is
+var BotUser = tgbotapi.User{ID: 123456, IsBot: true, FirstName: "mshkbot", UserName: "mshkbot_test"}
+
+// Message is a message the bot sent as it looks now
+type Message struct {
+	ChatID      int64
+	MessageID   int
+	ReplyTo     int
+	Text        string
+	ReplyMarkup string
+	Edits       int
+	Pinned      bool
+	Deleted     bool
+	Reactions   []string
+}
+
+// Request is one call the bot made
+type Request struct {
+	Method string
+	Params url.Values
+}
+
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server is the fake Bot API; URL is what the bot should use instead of api.telegram.org
+type Server struct {
+	URL string
+
+	srv       *httptest.Server
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu            sync.Mutex
+	nextMessageID int
+	nextUpdateID  int
+	updates       []tgbotapi.Update
+	newUpdate     chan struct{}
+	requests      []Request
+	messages      map[int64]map[int]*Message
+	admins        map[int64][]tgbotapi.User
+	blocked       map[int64]bool
+	failures      map[string][]failure
+}
+
+func NewServer() *Server {
+	s := &Server{
+		closed:        make(chan struct{}),
+		nextMessageID: 1,
+		nextUpdateID:  1,
+		newUpdate:     make(chan struct{}, 1),
+		messages:      make(map[int64]map[int]*Message),
+		admins:        make(map[int64][]tgbotapi.User),
+		blocked:       make(map[int64]bool),
+		failures:      make(map[string][]failure),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close stops the server, waking up a pending getUpdates. closing twice is fine
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.srv.Close()
+	})
+}
+
+// Inject queues an update for the next getUpdates and returns its id
+func (s *Server) Inject(update tgbotapi.Update) int {
+	s.mu.Lock()
+	update.UpdateID = s.nextUpdateID
+	s.nextUpdateID++
+	s.updates = append(s.updates, update)
+	s.mu.Unlock()
+
+	select {
+	case s.newUpdate <- struct{}{}:
+	default:
+	}
+	return update.UpdateID
+}
+
+// SendText injects a message from a user, commands get their entity like in real updates.
+// returns the id of the message
+func (s *Server) SendText(chat tgbotapi.Chat, from tgbotapi.User, text string) int {
+	s.mu.Lock()
+	messageID := s.nextMessageID
+	s.nextMessageID++
+	s.mu.Unlock()
+
+	message := &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &from,
+		Chat:      &chat,
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len([]rune(command))}}
+	}
+	s.Inject(tgbotapi.Update{Message: message})
+	return messageID
+}
+
+// PressButton injects a press of an inline button under a message the bot sent
+func (s *Server) PressButton(chat tgbotapi.Chat, messageID int, from tgbotapi.User, data string) {
+	s.mu.Lock()
+	text := ""
+	if m, ok := s.messages[chat.ID][messageID]; ok {
+		text = m.Text
+	}
+	queryID := strconv.Itoa(s.nextUpdateID)
+	s.mu.Unlock()
+
+	s.Inject(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      queryID,
+		From:    &from,
+		Message: &tgbotapi.Message{MessageID: messageID, From: &BotUser, Chat: &chat, Text: text},
+		Data:    data,
+	}})
+}
+
+// SetAdmins sets what getChatAdministrators returns for the chat
+func (s *Server) SetAdmins(chatID int64, users ...tgbotapi.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.admins[chatID] = users
+}
+
+// Block makes the chat refuse messages like a user who blocked the bot
+func (s *Server) Block(chatID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked[chatID] = true
+}
+
+// Fail makes the next call of the method fail with the code and description.
+// retryAfter goes into the parameters like telegram does for 429
+func (s *Server) Fail(method string, code int, description string, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{code: code, description: description, retryAfter: retryAfter})
+}
+
+// Messages returns what the bot sent to the chat in order, deleted ones included
+func (s *Server) Messages(chatID int64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.messages[chatID]))
+	for _, m := range s.messages[chatID] {
+		copied := *m
+		copied.Reactions = append([]string(nil), m.Reactions...)
+		messages = append(messages, copied)
+	}
+	sort.Slice(messages, func(i, j int) bool { return messages[i].MessageID < messages[j].MessageID })
+	return messages
+}
+
+// Message returns one message in its current state
+func (s *Server) Message(chatID int64, messageID int) (Message, bool) {
+	for _, m := range s.Messages(chatID) {
+		if m.MessageID == messageID {
+			return m, true
+		}
+	}
+	return Message{}, false
+}
+
+// LastMessage returns the latest message the bot sent to the chat
+func (s *Server) LastMessage(chatID int64) (Message, bool) {
+	messages := s.Messages(chatID)
+	if len(messages) == 0 {
+		return Message{}, false
+	}
+	return messages[len(messages)-1], true
+}
+
+// Requests returns the calls of a method, or every call if method is empty
+func (s *Server) Requests(method string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var requests []Request
+	for _, r := range s.requests {
+		if method == "" || r.Method == method {
+			requests = append(requests, r)
+		}
+	}
+	return requests
+}
+
+// WaitFor polls cond until it holds or the timeout passes, handlers run in their own goroutines
+func (s *Server) WaitFor(timeout time.Duration, cond func() bool) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if cond() {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/bot")
+	token, method, ok := strings.Cut(path, "/")
+	if !ok || token != Token {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", 0)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: "+err.Error(), 0)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: method, Params: r.PostForm})
+	if queued := s.failures[method]; len(queued) > 0 {
+		s.failures[method] = queued[1:]
+		s.mu.Unlock()
+		writeError(w, queued[0].code, queued[0].description, queued[0].retryAfter)
+		return
+	}
+	s.mu.Unlock()
+
+	if method == "getUpdates" {
+		s.getUpdates(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "getMe":
+		writeResult(w, BotUser)
+	case "sendMessage":
+		s.sendMessage(w, r.PostForm)
+	case "editMessageText", "editMessageReplyMarkup":
+		s.editMessage(w, r.PostForm, method == "editMessageText")
+	case "pinChatMessage", "unpinChatMessage", "deleteMessage", "setMessageReaction":
+		s.changeMessage(w, r.PostForm, method)
+	case "getChatAdministrators":
+		chatID, _ := strconv.ParseInt(r.PostForm.Get("chat_id"), 10, 64)
+		members := make([]tgbotapi.ChatMember, 0, len(s.admins[chatID]))
+		for _, u := range s.admins[chatID] {
+			user := u
+			members = append(members, tgbotapi.ChatMember{User: &user, Status: "administrator"})
+		}
+		writeResult(w, members)
+	default:
+		// answerCallbackQuery and whatever else the bot calls just succeed
+		writeResult(w, true)
+	}
+}
+
+func (s *Server) getUpdates(w http.ResponseWriter, r *http.Request) {
+	offset, _ := strconv.Atoi(r.PostForm.Get("offset"))
+	timeout, _ := strconv.Atoi(r.PostForm.Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Second)
+
+	for {
+		s.mu.Lock()
+		var pending []tgbotapi.Update
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		// updates before the offset are confirmed and never asked for again
+		s.updates = pending
+		s.mu.Unlock()
+
+		if len(pending) > 0 || timeout == 0 {
+			writeResult(w, pending)
+			return
+		}
+
+		select {
+		case <-s.newUpdate:
+		case <-deadline:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		}
+	}
+}
+
+func (s *Server) sendMessage(w http.ResponseWriter, params url.Values) {
+	chatID, err := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Bad Request: chat not found", 0)
+		return
+	}
+	if s.blocked[chatID] {
+		writeError(w, http.StatusForbidden, "Forbidden: bot was blocked by the user", 0)
+		return
+	}
+	if params.Get("text") == "" {
+		writeError(w, http.StatusBadRequest, "Bad Request: message text is empty", 0)
+		return
+	}
+
+	m := &Message{
+		ChatID:      chatID,
+		MessageID:   s.nextMessageID,
+		Text:        params.Get("text"),
+		ReplyMarkup: params.Get("reply_markup"),
+	}
+	s.nextMessageID++
+	m.ReplyTo, _ = strconv.Atoi(params.Get("reply_to_message_id"))
+	if reply := params.Get("reply_parameters"); reply != "" {
+		var parameters struct {
+			MessageID int `json:"message_id"`
+		}
+		if err := json.Unmarshal([]byte(reply), &parameters); err == nil {
+			m.ReplyTo = parameters.MessageID
+		}
+	}
+
+	if s.messages[chatID] == nil {
+		s.messages[chatID] = make(map[int]*Message)
+	}
+	s.messages[chatID][m.MessageID] = m
+	writeResult(w, m.toAPI())
+}
+
+func (s *Server) editMessage(w http.ResponseWriter, params url.Values, text bool) {
+	m, ok := s.find(params)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Bad Request: message to edit not found", 0)
+		return
+	}
+
+	newText, newMarkup := m.Text, params.Get("reply_markup")
+	if text {
+		newText = params.Get("text")
+	}
+	if newText == m.Text && newMarkup == m.ReplyMarkup {
+		writeError(w, http.StatusBadRequest, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message", 0)
+		return
+	}
+
+	m.Text, m.ReplyMarkup = newText, newMarkup
+	m.Edits++
+	writeResult(w, m.toAPI())
+}
+
+func (s *Server) changeMessage(w http.ResponseWriter, params url.Values, method string) {
+	m, ok := s.find(params)
+	if !ok {
+		target := map[string]string{"pinChatMessage": "pin", "unpinChatMessage": "unpin", "deleteMessage": "delete", "setMessageReaction": "react"}[method]
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Bad Request: message to %s not found", target), 0)
+		return
+	}
+
+	switch method {
+	case "pinChatMessage":
+		m.Pinned = true
+	case "unpinChatMessage":
+		m.Pinned = false
+	case "deleteMessage":
+		m.Deleted = true
+	case "setMessageReaction":
+		var reactions []struct {
+			Emoji string `json:"emoji"`
+		}
+		if raw := params.Get("reaction"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &reactions); err != nil {
+				writeError(w, http.StatusBadRequest, "Bad Request: can't parse reaction types", 0)
+				return
+			}
+		}
+		m.Reactions = m.Reactions[:0]
+		for _, r := range reactions {
+			m.Reactions = append(m.Reactions, r.Emoji)
+		}
+	}
+	writeResult(w, true)
+}
+
+// find looks up the message a request points at. messages of users are not stored,
+// so pins and reactions on them are kept on a stub
+func (s *Server) find(params url.Values) (*Message, bool) {
+	chatID, err := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	messageID, err := strconv.Atoi(params.Get("message_id"))
+	if err != nil || messageID <= 0 || messageID >= s.nextMessageID {
+		return nil, false
+	}
+
+	if s.messages[chatID] == nil {
+		s.messages[chatID] = make(map[int]*Message)
+	}
+	m, ok := s.messages[chatID][messageID]
+	if !ok {
+		m = &Message{ChatID: chatID, MessageID: messageID}
+		s.messages[chatID][messageID] = m
+	}
+	return m, !m.Deleted
+}
+
+func (m *Message) toAPI() tgbotapi.Message {
+	chatType := "private"
+	if m.ChatID < 0 {
+		chatType = "supergroup"
+	}
+	message := tgbotapi.Message{
+		MessageID: m.MessageID,
+		From:      &BotUser,
+		Chat:      &tgbotapi.Chat{ID: m.ChatID, Type: chatType},
+		Date:      int(time.Now().Unix()),
+		Text:      m.Text,
+	}
+	if m.ReplyMarkup != "" {
+		var markup tgbotapi.InlineKeyboardMarkup
+		if err := json.Unmarshal([]byte(m.ReplyMarkup), &markup); err == nil {
+			message.ReplyMarkup = &markup
+		}
+	}
+	return message
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error(), 0)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: data})
+}
+
+func writeError(w http.ResponseWriter, code int, description string, retryAfter int) {
+	resp := tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description}
+	if retryAfter > 0 {
+		resp.Parameters = &tgbotapi.ResponseParameters{RetryAfter: retryAfter}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,88 @@
+package telegramtest
+
+import (
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func newClient(t *testing.T, s *Server) *tgbotapi.BotAPI {
+	t.Helper()
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(Token, s.URL+"/bot%s/%s")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	return api
+}
+
+func TestMessagesAndEdits(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	api := newClient(t, s)
+
+	sent, err := api.Send(tgbotapi.NewMessage(-100, "список"))
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if _, err := api.Request(tgbotapi.PinChatMessageConfig{ChatID: -100, MessageID: sent.MessageID}); err != nil {
+		t.Fatalf("pin failed: %v", err)
+	}
+	if _, err := api.Send(tgbotapi.NewEditMessageText(-100, sent.MessageID, "список 2")); err != nil {
+		t.Fatalf("edit failed: %v", err)
+	}
+	if _, err := api.Send(tgbotapi.NewEditMessageText(-100, sent.MessageID, "список 2")); err == nil {
+		t.Error("same text should be refused as not modified")
+	}
+	if _, err := api.Send(tgbotapi.NewEditMessageText(-100, 999, "нет")); err == nil {
+		t.Error("unknown message should not be editable")
+	}
+
+	m, ok := s.LastMessage(-100)
+	if !ok || m.Text != "список 2" || !m.Pinned || m.Edits != 1 {
+		t.Errorf("unexpected message state: %+v", m)
+	}
+}
+
+func TestUpdates(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	api := newClient(t, s)
+
+	chat := tgbotapi.Chat{ID: 42, Type: "private"}
+	user := tgbotapi.User{ID: 42, UserName: "player"}
+	s.SendText(chat, user, "/start hello")
+
+	updates := api.GetUpdatesChan(tgbotapi.UpdateConfig{Timeout: 1})
+	defer api.StopReceivingUpdates()
+
+	select {
+	case u := <-updates:
+		if !u.Message.IsCommand() || u.Message.Command() != "start" || u.Message.CommandArguments() != "hello" {
+			t.Errorf("unexpected update: %+v", u.Message)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no update received")
+	}
+}
+
+func TestFailuresAndBlocks(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	api := newClient(t, s)
+
+	s.Fail("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+	_, err := api.Send(tgbotapi.NewMessage(1, "a"))
+	apiErr, ok := err.(*tgbotapi.Error)
+	if !ok || apiErr.Code != 429 || apiErr.RetryAfter != 1 {
+		t.Errorf("expected flood error, got %v", err)
+	}
+
+	s.Block(2)
+	if _, err := api.Send(tgbotapi.NewMessage(2, "a")); err == nil {
+		t.Error("blocked chat should refuse messages")
+	}
+	if len(s.Requests("sendMessage")) != 2 {
+		t.Errorf("expected 2 recorded requests, got %d", len(s.Requests("sendMessage")))
+	}
+}
@@ -0,0 +1,255 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/rejoin"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+var (
+	ErrNotListed         = errors.New("player is not in the list")
+	ErrAlreadyCheckedOut = errors.New("player already checked out")
+)
+
+// CheckInOutcome says what CheckIn did
+type CheckInOutcome int
+
+const (
+	// CheckedIn means the player got a spot
+	CheckedIn CheckInOutcome = iota
+	// Queued means the tournament is full and the player waits in the queue
+	Queued
+	// AlreadyListed means the player was in the list before and nothing changed
+	AlreadyListed
+	// AlreadyLeft means the player checked out and their cooldown is not over yet
+	AlreadyLeft
+	// RejoinForbidden means the player checked out and the rejoin policy does not let them back
+	RejoinForbidden
+)
+
+// CheckOutResult says what CheckOut did
+type CheckOutResult struct {
+	// Player is the player as they were before checking out
+	Player types.Player
+	// Promoted got the freed spot, nil if nobody was waiting
+	Promoted *types.Player
+}
+
+// updateList changes the list through the store so that fn sees the stored list and
+// nothing written in between is lost; fn may run more than once. caller must hold the lock
+func (tm *TournamentManager) updateList(ctx context.Context, tournamentID string, fn func(list []types.Player) ([]types.Player, error)) error {
+	return tm.updateRoster(ctx, tournamentID, func(list, departed []types.Player) ([]types.Player, []types.Player, error) {
+		list, err := fn(list)
+		return list, departed, err
+	})
+}
+
+// updateRoster is updateList for changes that also touch the departed players.
+// the tournament in memory changes only after the store took the update
+func (tm *TournamentManager) updateRoster(ctx context.Context, tournamentID string, fn func(list, departed []types.Player) ([]types.Player, []types.Player, error)) error {
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return err
+	}
+	list, departed, err := tm.store.UpdateList(ctx, tournamentID, fn)
+	if err != nil {
+		return err
+	}
+	t.List, t.Departed = list, departed
+	return nil
+}
+
+func indexOf(list []types.Player, playerID int) int {
+	for i, player := range list {
+		if player.ID == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// activeCount counts the players who hold or wait for a spot
+func activeCount(list []types.Player) int {
+	count := 0
+	for _, player := range list {
+		switch player.State {
+		case types.StateInTournament, types.StatePending, types.StateQueued:
+			count++
+		}
+	}
+	return count
+}
+
+// CheckIn adds the player to the tournament, or to the queue when it is full.
+// the limit and the list are checked in the same transaction that writes the player,
+// so two check-ins cannot take the last spot and a double tap cannot add anyone twice.
+// a player who checked out comes back as the rejoin policy of the tournament says.
+// returns the player as listed
+func (tm *TournamentManager) CheckIn(ctx context.Context, tournamentID string, player types.Player) (CheckInOutcome, types.Player, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return CheckedIn, types.Player{}, err
+	}
+	limit := t.Metadata.Limit
+	policy := t.Metadata.RejoinPolicy
+	now := time.Now().UTC()
+
+	var outcome CheckInOutcome
+	var listed types.Player
+	err = tm.updateRoster(ctx, tournamentID, func(list, departed []types.Player) ([]types.Player, []types.Player, error) {
+		// the state is decided here, whatever the caller passed
+		listed = player
+		listed.State = ""
+		if i := indexOf(list, player.ID); i >= 0 {
+			left := list[i]
+			if left.State != types.StateCheckedOut {
+				outcome, listed = AlreadyListed, left
+				return list, departed, nil
+			}
+			if refused, ok := refuseRejoin(policy, left, now); ok {
+				outcome, listed = refused, left
+				return list, departed, nil
+			}
+
+			listed.Checkouts = left.Checkouts
+			if policy.KeepPlace {
+				listed.TimeAdded = left.TimeAdded
+				list[i] = listed
+			} else {
+				list = append(list[:i], list[i+1:]...)
+				i = len(list)
+				list = append(list, listed)
+			}
+			outcome, list[i].State = admit(list, limit)
+			listed = list[i]
+			return list, departed, nil
+		}
+
+		// a player cleaned up from the list after checking out is still bound by the policy
+		if left, ok := lastDeparture(departed, player.ID); ok {
+			if left.State == types.StateCheckedOut {
+				if refused, ok := refuseRejoin(policy, left, now); ok {
+					outcome, listed = refused, left
+					return list, departed, nil
+				}
+			}
+			listed.Checkouts = left.Checkouts
+		}
+		list = append(list, listed)
+		i := len(list) - 1
+		outcome, list[i].State = admit(list, limit)
+		listed = list[i]
+		return list, departed, nil
+	})
+	return outcome, listed, err
+}
+
+// refuseRejoin reports the outcome for a player who checked out and may not come back yet or at all
+func refuseRejoin(policy rejoin.Policy, left types.Player, now time.Time) (CheckInOutcome, bool) {
+	switch {
+	case !policy.Allows(left.Checkouts):
+		return RejoinForbidden, true
+	case now.Before(policy.RejoinAt(left.CheckedOutTime)):
+		return AlreadyLeft, true
+	}
+	return CheckedIn, false
+}
+
+// lastDeparture returns the latest entry of the player among those removed from the list
+func lastDeparture(departed []types.Player, playerID int) (types.Player, bool) {
+	for i := len(departed) - 1; i >= 0; i-- {
+		if departed[i].ID == playerID {
+			return departed[i], true
+		}
+	}
+	return types.Player{}, false
+}
+
+// admit decides whether a player joining a list gets a spot or waits in the queue.
+// the player must not hold a spot in list yet
+func admit(list []types.Player, limit int) (CheckInOutcome, string) {
+	if limit > 0 && activeCount(list) >= limit {
+		return Queued, types.StateQueued
+	}
+	return CheckedIn, types.StateInTournament
+}
+
+// CheckOut marks the player as checked out and, if they held a spot,
+// gives it to the first player in the queue in the same transaction.
+// fails with ErrNotListed or ErrAlreadyCheckedOut when there is nothing to do
+func (tm *TournamentManager) CheckOut(ctx context.Context, tournamentID string, playerID int) (CheckOutResult, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return CheckOutResult{}, err
+	}
+	confirmationMinutes := t.Metadata.ConfirmationMinutes
+
+	var result CheckOutResult
+	err = tm.updateList(ctx, tournamentID, func(list []types.Player) ([]types.Player, error) {
+		result = CheckOutResult{}
+		i := indexOf(list, playerID)
+		if i < 0 {
+			return nil, ErrNotListed
+		}
+		if list[i].State == types.StateCheckedOut {
+			return nil, ErrAlreadyCheckedOut
+		}
+
+		result.Player = list[i]
+		list[i].State = types.StateCheckedOut
+		list[i].CheckedOutTime = time.Now().UTC()
+		list[i].ConfirmBy = time.Time{}
+		list[i].Checkouts++
+
+		if result.Player.State == types.StateInTournament || result.Player.State == types.StatePending {
+			result.Promoted = promoteFirst(list, confirmationMinutes)
+		}
+		return list, nil
+	})
+	return result, err
+}
+
+// Promote moves the first queued player into the tournament.
+// when the tournament asks for confirmation the player becomes pending until ConfirmBy.
+// returns nil if nobody is waiting in the queue
+func (tm *TournamentManager) Promote(ctx context.Context, tournamentID string) (*types.Player, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	confirmationMinutes := t.Metadata.ConfirmationMinutes
+
+	var promoted *types.Player
+	err = tm.updateList(ctx, tournamentID, func(list []types.Player) ([]types.Player, error) {
+		promoted = promoteFirst(list, confirmationMinutes)
+		return list, nil
+	})
+	return promoted, err
+}
+
+// promoteFirst changes the state of the first queued player in list and returns a copy of them
+func promoteFirst(list []types.Player, confirmationMinutes int) *types.Player {
+	for i, player := range list {
+		if player.State != types.StateQueued {
+			continue
+		}
+		if confirmationMinutes > 0 {
+			list[i].State = types.StatePending
+			list[i].ConfirmBy = time.Now().UTC().Add(time.Duration(confirmationMinutes) * time.Minute)
+		} else {
+			list[i].State = types.StateInTournament
+		}
+		promoted := list[i]
+		return &promoted
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+var ErrAllRoundsPlayed = errors.New("all rounds of the round-robin have been paired")
+
+// PairNextRound pairs and stores the next round among players in the tournament.
+// the first round fixes the seeding and the pairing system; an empty system picks the default for the field size
+func (tm *TournamentManager) PairNextRound(ctx context.Context, tournamentID string, system pairing.System) (types.Round, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return types.Round{}, err
+	}
+
+	active := make(map[int]bool)
+	for _, player := range t.List {
+		if player.State == types.StateInTournament {
+			active[player.ID] = true
+		}
+	}
+
+	metadata := t.Metadata
+	if len(t.Rounds) == 0 {
+		metadata.Seeds = seed(t.List, active)
+		if system == "" {
+			system = pairing.DefaultSystem(len(metadata.Seeds))
+		}
+		metadata.PairingSystem = string(system)
+	}
+
+	number := len(t.Rounds) + 1
+	history := make([]pairing.Round, len(t.Rounds))
+	for i, round := range t.Rounds {
+		history[i] = round.Round
+	}
+
+	var games []pairing.Game
+	switch pairing.System(metadata.PairingSystem) {
+	case pairing.SystemRoundRobin:
+		if number > pairing.RoundRobinRounds(len(metadata.Seeds)) {
+			return types.Round{}, ErrAllRoundsPlayed
+		}
+		games, err = pairing.RoundRobin(metadata.Seeds, number)
+	default:
+		// late entries join at the bottom of the seeding, withdrawn players are left out
+		metadata.Seeds = append(metadata.Seeds, seed(t.List, lateEntries(active, metadata.Seeds))...)
+		var players []int
+		for _, id := range metadata.Seeds {
+			if active[id] {
+				players = append(players, id)
+			}
+		}
+		games, err = pairing.Swiss(players, history)
+	}
+	if err != nil {
+		return types.Round{}, err
+	}
+
+	round := types.Round{Round: pairing.Round{Number: number, Games: games}}
+	rounds := append(append([]types.Round(nil), t.Rounds...), round)
+
+	if err := tm.store.SetRounds(ctx, tournamentID, rounds); err != nil {
+		fmt.Printf("error happened while updating the redis rounds: %s", err)
+		return types.Round{}, err
+	}
+	if err := tm.store.SetMetadata(ctx, tournamentID, metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
+		return types.Round{}, err
+	}
+	t.Rounds = rounds
+	t.Metadata = metadata
+
+	return round, nil
+}
+
+// SetRoundMessageID remembers the main group message with the pairings of a round
+func (tm *TournamentManager) SetRoundMessageID(ctx context.Context, tournamentID string, number int, messageID int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return err
+	}
+	if number < 1 || number > len(t.Rounds) {
+		return fmt.Errorf("tournament %s has no round %d", tournamentID, number)
+	}
+
+	rounds := append([]types.Round(nil), t.Rounds...)
+	rounds[number-1].MessageID = messageID
+	if err := tm.store.SetRounds(ctx, tournamentID, rounds); err != nil {
+		fmt.Printf("error happened while updating the redis rounds: %s", err)
+		return err
+	}
+	t.Rounds = rounds
+	return nil
+}
+
+// ReportResult records the result a player claims for their game in a round
+func (tm *TournamentManager) ReportResult(ctx context.Context, tournamentID string, number, board, playerID int, result pairing.Result) (pairing.Game, pairing.ReportOutcome, error) {
+	var outcome pairing.ReportOutcome
+	game, err := tm.updateGame(ctx, tournamentID, number, board, func(g *pairing.Game) error {
+		var err error
+		outcome, err = g.Report(playerID, result)
+		return err
+	})
+	return game, outcome, err
+}
+
+// OverrideResult sets the final result of a game on behalf of an arbiter
+func (tm *TournamentManager) OverrideResult(ctx context.Context, tournamentID string, number, board int, result pairing.Result) (pairing.Game, error) {
+	return tm.updateGame(ctx, tournamentID, number, board, func(g *pairing.Game) error {
+		if g.IsBye() {
+			return fmt.Errorf("board %d is a bye", board)
+		}
+		g.Override(result)
+		return nil
+	})
+}
+
+// updateGame applies fn to one game and persists the rounds
+func (tm *TournamentManager) updateGame(ctx context.Context, tournamentID string, number, board int, fn func(*pairing.Game) error) (pairing.Game, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return pairing.Game{}, err
+	}
+	if number < 1 || number > len(t.Rounds) {
+		return pairing.Game{}, fmt.Errorf("tournament %s has no round %d", tournamentID, number)
+	}
+
+	// the tournament keeps its rounds until the store has the new ones
+	rounds := append([]types.Round(nil), t.Rounds...)
+	games := append([]pairing.Game(nil), rounds[number-1].Games...)
+	rounds[number-1].Games = games
+	for i := range games {
+		if games[i].Board != board {
+			continue
+		}
+		if err := fn(&games[i]); err != nil {
+			return games[i], err
+		}
+		if err := tm.store.SetRounds(ctx, tournamentID, rounds); err != nil {
+			fmt.Printf("error happened while updating the redis rounds: %s", err)
+			return games[i], err
+		}
+		t.Rounds = rounds
+		return games[i], nil
+	}
+
+	return pairing.Game{}, fmt.Errorf("round %d of tournament %s has no board %d", number, tournamentID, board)
+}
+
+func (tm *TournamentManager) SetStandingsMessageID(ctx context.Context, tournamentID string, messageID int) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.StandingsMessageID = messageID
+	})
+}
+
+// seed orders the given players from the strongest by peak blitz rating, then by check-in time
+func seed(list []types.Player, include map[int]bool) []int {
+	var players []types.Player
+	for _, player := range list {
+		if include[player.ID] {
+			players = append(players, player)
+		}
+	}
+	sort.SliceStable(players, func(i, j int) bool {
+		ri, rj := peakBlitz(players[i]), peakBlitz(players[j])
+		if ri != rj {
+			return ri > rj
+		}
+		return players[i].TimeAdded.Before(players[j].TimeAdded)
+	})
+
+	ids := make([]int, len(players))
+	for i, player := range players {
+		ids[i] = player.ID
+	}
+	return ids
+}
+
+func lateEntries(active map[int]bool, seeds []int) map[int]bool {
+	late := make(map[int]bool, len(active))
+	for id := range active {
+		late[id] = true
+	}
+	for _, id := range seeds {
+		delete(late, id)
+	}
+	return late
+}
+
+func peakBlitz(player types.Player) int {
+	return player.BlitzPeak()
+}
+
+// PlayerName returns the tournament name of anyone who was ever in the list
+func (t Tournament) PlayerName(playerID int) string {
+	for _, player := range t.AllPlayers() {
+		if player.ID == playerID {
+			return player.SavedName
+		}
+	}
+	return fmt.Sprintf("игрок %d", playerID)
+}
+
+// Game returns the game on the board in the round
+func (t Tournament) Game(number, board int) (pairing.Game, bool) {
+	for _, round := range t.Rounds {
+		if round.Number != number {
+			continue
+		}
+		for _, game := range round.Games {
+			if game.Board == board {
+				return game, true
+			}
+		}
+	}
+	return pairing.Game{}, false
+}
+
+// PairingsMessage renders the pairings of a round for the main group
+func (t Tournament) PairingsMessage(round types.Round) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, тур %d\n\n", t.DisplayName(), round.Number)
+
+	for _, game := range round.Games {
+		if game.IsBye() {
+			fmt.Fprintf(&b, "\nотдыхает: %s\n", t.PlayerName(game.White))
+			continue
+		}
+		fmt.Fprintf(&b, "%d. %s — %s", game.Board, t.PlayerName(game.White), t.PlayerName(game.Black))
+		switch {
+		case game.Result != pairing.NoResult:
+			fmt.Fprintf(&b, "  %s", game.Result)
+		case game.ReportedBy != 0:
+			fmt.Fprintf(&b, "  %s? (ждём подтверждения)", game.Reported)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Standings returns the current table of the tournament
+func (t Tournament) Standings() []pairing.Standing {
+	history := make([]pairing.Round, len(t.Rounds))
+	for i, round := range t.Rounds {
+		history[i] = round.Round
+	}
+	return pairing.Standings(t.Metadata.Seeds, history)
+}
+
+// StandingsMessage renders the live table for the main group
+func (t Tournament) StandingsMessage() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s, таблица после %d тура\n\n", t.DisplayName(), len(t.Rounds))
+
+	for i, s := range t.Standings() {
+		fmt.Fprintf(&b, "%d. %s — %s (бух. %s, з-б %s)\n", i+1, t.PlayerName(s.Player), points(s.Score), points(s.Buchholz), points(s.SonnebornBerger))
+	}
+
+	return b.String()
+}
+
+// points prints scores the chess way: 2½ instead of 2.5
+func points(score float64) string {
+	whole := int(score)
+	rest := score - float64(whole)
+	switch {
+	case rest == 0:
+		return fmt.Sprintf("%d", whole)
+	case rest == 0.5 && whole == 0:
+		return "½"
+	case rest == 0.5:
+		return fmt.Sprintf("%d½", whole)
+	}
+	return fmt.Sprintf("%.2f", score)
+}
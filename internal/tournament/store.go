@@ -0,0 +1,182 @@
+package tournament
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+// TournamentStore persists open tournaments part by part.
+// the legacy methods read and drop the single tournament kept before tournaments had ids
+type TournamentStore interface {
+	GetTournamentIDs(ctx context.Context) ([]string, error)
+	// AddTournamentID registers the id and reports false if it was registered already
+	AddTournamentID(ctx context.Context, tournamentID string) (bool, error)
+	DeleteTournament(ctx context.Context, tournamentID string) error
+	GetList(ctx context.Context, tournamentID string) ([]types.Player, error)
+	SetList(ctx context.Context, tournamentID string, list []types.Player) error
+	// UpdateList replaces the list and the departed players with what fn makes of the stored ones, atomically:
+	// fn runs again if another writer changed either in between. an error from fn aborts
+	UpdateList(ctx context.Context, tournamentID string, fn func(list, departed []types.Player) ([]types.Player, []types.Player, error)) ([]types.Player, []types.Player, error)
+	GetDeparted(ctx context.Context, tournamentID string) ([]types.Player, error)
+	SetDeparted(ctx context.Context, tournamentID string, list []types.Player) error
+	GetMetadata(ctx context.Context, tournamentID string) (types.TournamentMetadata, error)
+	SetMetadata(ctx context.Context, tournamentID string, metadata types.TournamentMetadata) error
+	GetRounds(ctx context.Context, tournamentID string) ([]types.Round, error)
+	SetRounds(ctx context.Context, tournamentID string, rounds []types.Round) error
+	GetLegacyTournament(ctx context.Context) ([]types.Player, types.TournamentMetadata, error)
+	DeleteLegacyTournament(ctx context.Context) error
+}
+
+// MemoryStore keeps tournaments in memory, for tests and local runs.
+// values are stored encoded, like redis does, so callers never share slices with it
+type MemoryStore struct {
+	mu     sync.Mutex
+	ids    map[string]bool
+	values map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{ids: make(map[string]bool), values: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) set(key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = data
+	return nil
+}
+
+// get decodes the value under key into value, leaving it untouched if there is none
+func (s *MemoryStore) get(key string, value any) error {
+	s.mu.Lock()
+	data, exists := s.values[key]
+	s.mu.Unlock()
+	if !exists {
+		return nil
+	}
+	return json.Unmarshal(data, value)
+}
+
+func (s *MemoryStore) GetTournamentIDs(_ context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.ids))
+	for id := range s.ids {
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) AddTournamentID(_ context.Context, tournamentID string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids[tournamentID] {
+		return false, nil
+	}
+	s.ids[tournamentID] = true
+	return true, nil
+}
+
+func (s *MemoryStore) DeleteTournament(_ context.Context, tournamentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, tournamentID)
+	for _, part := range []string{"list", "departed", "metadata", "rounds"} {
+		delete(s.values, tournamentID+":"+part)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetList(_ context.Context, tournamentID string) ([]types.Player, error) {
+	list := []types.Player{}
+	if err := s.get(tournamentID+":list", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) SetList(_ context.Context, tournamentID string, list []types.Player) error {
+	return s.set(tournamentID+":list", list)
+}
+
+func (s *MemoryStore) UpdateList(_ context.Context, tournamentID string, fn func(list, departed []types.Player) ([]types.Player, []types.Player, error)) ([]types.Player, []types.Player, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listKey, departedKey := tournamentID+":list", tournamentID+":departed"
+	list, departed := []types.Player{}, []types.Player{}
+	for key, value := range map[string]*[]types.Player{listKey: &list, departedKey: &departed} {
+		if data, exists := s.values[key]; exists {
+			if err := json.Unmarshal(data, value); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	list, departed, err := fn(list, departed)
+	if err != nil {
+		return nil, nil, err
+	}
+	listData, err := json.Marshal(list)
+	if err != nil {
+		return nil, nil, err
+	}
+	departedData, err := json.Marshal(departed)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.values[listKey] = listData
+	s.values[departedKey] = departedData
+	return list, departed, nil
+}
+
+func (s *MemoryStore) GetDeparted(_ context.Context, tournamentID string) ([]types.Player, error) {
+	list := []types.Player{}
+	if err := s.get(tournamentID+":departed", &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (s *MemoryStore) SetDeparted(_ context.Context, tournamentID string, list []types.Player) error {
+	return s.set(tournamentID+":departed", list)
+}
+
+func (s *MemoryStore) GetMetadata(_ context.Context, tournamentID string) (types.TournamentMetadata, error) {
+	var metadata types.TournamentMetadata
+	if err := s.get(tournamentID+":metadata", &metadata); err != nil {
+		return types.TournamentMetadata{}, err
+	}
+	return metadata, nil
+}
+
+func (s *MemoryStore) SetMetadata(_ context.Context, tournamentID string, metadata types.TournamentMetadata) error {
+	return s.set(tournamentID+":metadata", metadata)
+}
+
+func (s *MemoryStore) GetRounds(_ context.Context, tournamentID string) ([]types.Round, error) {
+	var rounds []types.Round
+	if err := s.get(tournamentID+":rounds", &rounds); err != nil {
+		return nil, err
+	}
+	return rounds, nil
+}
+
+func (s *MemoryStore) SetRounds(_ context.Context, tournamentID string, rounds []types.Round) error {
+	return s.set(tournamentID+":rounds", rounds)
+}
+
+// the memory store never held a legacy tournament
+func (s *MemoryStore) GetLegacyTournament(_ context.Context) ([]types.Player, types.TournamentMetadata, error) {
+	return nil, types.TournamentMetadata{}, nil
+}
+
+func (s *MemoryStore) DeleteLegacyTournament(_ context.Context) error {
+	return nil
+}
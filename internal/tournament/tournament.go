@@ -4,16 +4,44 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/sukalov/mshkbot/internal/redis"
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/rejoin"
+	"github.com/sukalov/mshkbot/internal/schedule"
 	"github.com/sukalov/mshkbot/internal/types"
 )
 
+// id given to a tournament migrated from the old single-tournament keys
+// when no scheduled event matches it, see legacyEvent
+const legacyTournamentID = "default"
+
+var validID = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Tournament is a snapshot of one event, its registration list and its rounds.
+// players removed from the list are kept in Departed for the history
+type Tournament struct {
+	Metadata types.TournamentMetadata `json:"metadata"`
+	List     []types.Player           `json:"players"`
+	Departed []types.Player           `json:"departed,omitempty"`
+	Rounds   []types.Round            `json:"rounds,omitempty"`
+}
+
 type TournamentManager struct {
-	mu       sync.RWMutex
-	List     []types.Player
-	Metadata types.TournamentMetadata
+	mu          sync.RWMutex
+	store       TournamentStore
+	tournaments map[string]*Tournament
+}
+
+// NewManager returns a manager keeping tournaments in store; call Init to load them
+func NewManager(store TournamentStore) *TournamentManager {
+	return &TournamentManager{store: store, tournaments: make(map[string]*Tournament)}
 }
 
 type ByTimeAdded []types.Player
@@ -22,225 +50,498 @@ func (a ByTimeAdded) Len() int           { return len(a) }
 func (a ByTimeAdded) Less(i, j int) bool { return a[i].TimeAdded.Before(a[j].TimeAdded) }
 func (a ByTimeAdded) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
 
+// ValidateID checks that a tournament id is short and safe for callback data
+func ValidateID(id string) error {
+	if !validID.MatchString(id) {
+		return fmt.Errorf("invalid tournament id %q: use up to 32 latin letters, digits, '-' or '_'", id)
+	}
+	return nil
+}
+
 func (tm *TournamentManager) Init() error {
 	ctx := context.Background()
-	fmt.Println("initializing tournament")
+	fmt.Println("initializing tournaments")
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	list, err := redis.GetList(ctx)
-	if err != nil {
+
+	tm.tournaments = make(map[string]*Tournament)
+
+	if err := tm.migrateLegacy(ctx); err != nil {
 		return err
 	}
-	metadata, err := redis.GetMetadata(ctx)
+
+	ids, err := tm.store.GetTournamentIDs(ctx)
 	if err != nil {
 		return err
 	}
-	tm.List = list
-	tm.Metadata = metadata
-	if !tm.Metadata.Exists && len(tm.List) > 0 {
-		fmt.Println("tournament does not exist but list is not empty, clearing list")
-		if err := tm.removeTournament(ctx); err != nil {
+
+	for _, id := range ids {
+		metadata, err := tm.store.GetMetadata(ctx, id)
+		if err != nil {
+			return err
+		}
+		if !metadata.Exists {
+			fmt.Printf("tournament %s has no metadata, removing it\n", id)
+			if err := tm.store.DeleteTournament(ctx, id); err != nil {
+				return err
+			}
+			continue
+		}
+		list, err := tm.store.GetList(ctx, id)
+		if err != nil {
+			return err
+		}
+		departed, err := tm.store.GetDeparted(ctx, id)
+		if err != nil {
+			return err
+		}
+		rounds, err := tm.store.GetRounds(ctx, id)
+		if err != nil {
 			return err
 		}
+		tm.tournaments[id] = &Tournament{Metadata: metadata, List: list, Departed: departed, Rounds: rounds}
 	}
-	fmt.Println("tournament initialized")
+
+	fmt.Printf("tournaments initialized: %d open\n", len(tm.tournaments))
 	return nil
 }
 
-func (tm *TournamentManager) AddPlayer(ctx context.Context, player types.Player) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	tm.List = append(tm.List, player)
-	if err := redis.SetList(ctx, tm.List); err != nil {
-		fmt.Printf("error happened while adding to redis list: %s", err)
+// migrateLegacy moves a tournament stored under the old fixed keys to the keyed layout
+func (tm *TournamentManager) migrateLegacy(ctx context.Context) error {
+	list, metadata, err := tm.store.GetLegacyTournament(ctx)
+	if err != nil {
 		return err
 	}
-	return nil
-}
+	if !metadata.Exists && len(list) == 0 {
+		return nil
+	}
 
-func (tm *TournamentManager) CreateTournament(ctx context.Context, limit int, lichessRatingLimit int, chesscomRatingLimit int, announcementIntro string) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	if tm.Metadata.Exists {
-		return fmt.Errorf("tournament already exists")
-	}
-	tm.Metadata = types.TournamentMetadata{
-		Limit:               limit,
-		LichessRatingLimit:  lichessRatingLimit,
-		ChesscomRatingLimit: chesscomRatingLimit,
-		AnnouncementIntro:   announcementIntro,
-		Exists:              true,
-	}
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while saving metadata to redis: %s", err)
-		return err
+	if metadata.Exists {
+		ids, err := tm.store.GetTournamentIDs(ctx)
+		if err != nil {
+			return err
+		}
+		metadata.ID = legacyTournamentID
+		if event, ok := legacyEvent(metadata); ok && !slices.Contains(ids, event.Key) {
+			metadata.ID = event.Key
+			if metadata.Name == "" {
+				metadata.Name = event.Name
+			}
+		}
+		fmt.Printf("migrating legacy tournament as %s\n", metadata.ID)
+
+		if metadata.CreatedAt.IsZero() {
+			metadata.CreatedAt = time.Now().UTC()
+		}
+		if err := tm.persist(ctx, &Tournament{Metadata: metadata, List: list}); err != nil {
+			return err
+		}
+		if _, err := tm.store.AddTournamentID(ctx, metadata.ID); err != nil {
+			return err
+		}
 	}
-	return nil
+
+	return tm.store.DeleteLegacyTournament(ctx)
 }
 
-func (tm *TournamentManager) RemoveTournament(ctx context.Context) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-	if !tm.Metadata.Exists {
-		return fmt.Errorf("tournament does not exist")
-	}
-	tm.Metadata = types.TournamentMetadata{
-		Limit:                 0,
-		LichessRatingLimit:    0,
-		ChesscomRatingLimit:   0,
-		AnnouncementMessageID: 0,
-		AnnouncementIntro:     "",
-		Exists:                false,
-	}
-	if err := tm.clearList(ctx); err != nil {
-		fmt.Printf("error happened while clearing the redis list: %s", err)
-		return err
+// legacyEvent finds the scheduled event a legacy tournament was opened for, so the scheduler
+// closes and archives it like any other. the old scheduler opened only the default events,
+// told apart by their announcement, or else by the weekday the tournament was created on
+func legacyEvent(metadata types.TournamentMetadata) (schedule.Event, bool) {
+	events := schedule.DefaultEvents()
+	for _, event := range events {
+		if metadata.AnnouncementIntro != "" && event.AnnouncementIntro == metadata.AnnouncementIntro {
+			return event, true
+		}
 	}
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while saving metadata to redis: %s", err)
-		return err
+	if !metadata.CreatedAt.IsZero() {
+		weekday := metadata.CreatedAt.In(time.FixedZone("moscow", 3*60*60)).Weekday()
+		for _, event := range events {
+			if event.Weekday == weekday {
+				return event, true
+			}
+		}
 	}
-	return nil
+	return schedule.Event{}, false
 }
 
-func (tm *TournamentManager) removeTournament(ctx context.Context) error {
-	tm.Metadata = types.TournamentMetadata{
-		Limit:                 0,
-		LichessRatingLimit:    0,
-		ChesscomRatingLimit:   0,
-		AnnouncementMessageID: 0,
-		AnnouncementIntro:     "",
-		Exists:                false,
+func (tm *TournamentManager) persist(ctx context.Context, t *Tournament) error {
+	if err := tm.store.SetList(ctx, t.Metadata.ID, t.List); err != nil {
+		fmt.Printf("error happened while updating the redis list: %s", err)
+		return err
+	}
+	if err := tm.store.SetDeparted(ctx, t.Metadata.ID, t.Departed); err != nil {
+		fmt.Printf("error happened while updating the departed list: %s", err)
+		return err
 	}
-	if err := tm.clearList(ctx); err != nil {
-		fmt.Printf("error happened while clearing the redis list: %s", err)
+	if err := tm.store.SetMetadata(ctx, t.Metadata.ID, t.Metadata); err != nil {
+		fmt.Printf("error happened while updating the redis metadata: %s", err)
 		return err
 	}
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while saving metadata to redis: %s", err)
+	if err := tm.store.SetRounds(ctx, t.Metadata.ID, t.Rounds); err != nil {
+		fmt.Printf("error happened while updating the redis rounds: %s", err)
 		return err
 	}
 	return nil
 }
 
-func (tm *TournamentManager) clearList(ctx context.Context) error {
-	tm.List = []types.Player{}
-	if err := redis.SetList(ctx, tm.List); err != nil {
-		fmt.Printf("error happened while clearing the redis list: %s", err)
+// get returns the live tournament; caller must hold the lock
+func (tm *TournamentManager) get(tournamentID string) (*Tournament, error) {
+	t, exists := tm.tournaments[tournamentID]
+	if !exists {
+		return nil, fmt.Errorf("tournament %s does not exist", tournamentID)
 	}
-	return nil
+	return t, nil
 }
 
-func (tm *TournamentManager) EditPlayer(ctx context.Context, playerID int, updatedPlayer types.Player) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
+// Get returns a copy of the tournament with the given id
+func (tm *TournamentManager) Get(tournamentID string) (Tournament, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	t, exists := tm.tournaments[tournamentID]
+	if !exists {
+		return Tournament{}, false
+	}
+	return t.snapshot(), true
+}
 
-	for i, player := range tm.List {
-		if player.ID == playerID {
-			tm.List[i] = updatedPlayer
-			if err := redis.SetList(ctx, tm.List); err != nil {
-				fmt.Printf("error happened while updating the redis list: %s", err)
-				return err
-			}
-			return nil
+// Open returns copies of all open tournaments, oldest first
+func (tm *TournamentManager) Open() []Tournament {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	result := make([]Tournament, 0, len(tm.tournaments))
+	for _, t := range tm.tournaments {
+		result = append(result, t.snapshot())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Metadata.CreatedAt.Equal(result[j].Metadata.CreatedAt) {
+			return result[i].Metadata.ID < result[j].Metadata.ID
+		}
+		return result[i].Metadata.CreatedAt.Before(result[j].Metadata.CreatedAt)
+	})
+	return result
+}
+
+// Find looks a tournament up by id or by name, ignoring case
+func (tm *TournamentManager) Find(query string) (Tournament, bool) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return Tournament{}, false
+	}
+	for _, t := range tm.Open() {
+		if t.Metadata.ID == query || strings.ToLower(t.Metadata.Name) == query {
+			return t, true
 		}
 	}
+	return Tournament{}, false
+}
 
-	return fmt.Errorf("player with ID %d not found in list", playerID)
+func (t *Tournament) snapshot() Tournament {
+	list := make([]types.Player, len(t.List))
+	copy(list, t.List)
+	departed := make([]types.Player, len(t.Departed))
+	copy(departed, t.Departed)
+	rounds := make([]types.Round, len(t.Rounds))
+	for i, round := range t.Rounds {
+		rounds[i] = round
+		rounds[i].Games = append([]pairing.Game(nil), round.Games...)
+	}
+	metadata := t.Metadata
+	metadata.Seeds = append([]int(nil), t.Metadata.Seeds...)
+	return Tournament{Metadata: metadata, List: list, Departed: departed, Rounds: rounds}
 }
 
-func (tm *TournamentManager) RemovePlayer(ctx context.Context, playerID int) error {
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
+// DisplayName is the human readable name of the tournament
+func (t Tournament) DisplayName() string {
+	if t.Metadata.Name != "" {
+		return t.Metadata.Name
+	}
+	return t.Metadata.ID
+}
 
-	for i, player := range tm.List {
+// GetPlayer returns the player with the given id if they are in the list
+func (t Tournament) GetPlayer(playerID int) (types.Player, bool) {
+	for _, player := range t.List {
 		if player.ID == playerID {
-			tm.List = append(tm.List[:i], tm.List[i+1:]...)
-			if err := redis.SetList(ctx, tm.List); err != nil {
-				fmt.Printf("error happened while updating the redis list: %s", err)
-				return err
-			}
-			return nil
+			return player, true
 		}
 	}
-
-	return fmt.Errorf("player with ID %d not found in list", playerID)
+	return types.Player{}, false
 }
 
-func (tm *TournamentManager) Sync(ctx context.Context) error {
-	tm.mu.RLock()
-	defer tm.mu.RUnlock()
-	if err := redis.SetList(ctx, tm.List); err != nil {
-		fmt.Printf("error happened while updating the redis list: %s", err)
-		return err
+// ListMessage renders the public announcement text with participants and queue
+func (t Tournament) ListMessage() string {
+	messageIntro := t.Metadata.AnnouncementIntro
+	if messageIntro == "" {
+		messageIntro = "ТУРНИР НАЧАЛСЯ!!!"
 	}
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while updating the redis metadata: %s", err)
-		return err
+
+	message := fmt.Sprintf("%s\n\nучастники:\n", messageIntro)
+
+	count := 1
+	for _, player := range t.List {
+		switch player.State {
+		case types.StateInTournament:
+			message += fmt.Sprintf("%d. %s\n", count, player.SavedName)
+			count++
+		case types.StatePending:
+			message += fmt.Sprintf("%d. %s (ждём подтверждения)\n", count, player.SavedName)
+			count++
+		}
 	}
-	return nil
-}
 
-func (tm *TournamentManager) GetTournamentJSON() (string, error) {
-	tm.mu.RLock()
-	defer tm.mu.RUnlock()
+	if count == 1 {
+		message += "пока никого нет\n"
+	}
 
-	data := struct {
-		List     []types.Player           `json:"players"`
-		Metadata types.TournamentMetadata `json:"metadata"`
-	}{
-		List:     tm.List,
-		Metadata: tm.Metadata,
+	queuedPlayers := []types.Player{}
+	for _, player := range t.List {
+		if player.State == types.StateQueued {
+			queuedPlayers = append(queuedPlayers, player)
+		}
 	}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal tournament state: %w", err)
+	if len(queuedPlayers) > 0 {
+		message += "\nочередь:\n"
+		for i, player := range queuedPlayers {
+			message += fmt.Sprintf("%d. %s &#9816;\n", i+1, player.SavedName)
+		}
 	}
 
-	return string(jsonData), nil
+	return message
+}
+
+// AllPlayers returns everyone who was ever registered, current list first
+func (t Tournament) AllPlayers() []types.Player {
+	all := make([]types.Player, 0, len(t.List)+len(t.Departed))
+	all = append(all, t.List...)
+	return append(all, t.Departed...)
+}
+
+// TournamentsOf returns ids of open tournaments the player is listed in
+func (tm *TournamentManager) TournamentsOf(playerID int) []string {
+	var ids []string
+	for _, t := range tm.Open() {
+		if _, exists := t.GetPlayer(playerID); exists {
+			ids = append(ids, t.Metadata.ID)
+		}
+	}
+	return ids
 }
 
-func (tm *TournamentManager) SetLimit(ctx context.Context, limit int) error {
+// CreateTournament opens a new tournament described by metadata
+func (tm *TournamentManager) CreateTournament(ctx context.Context, metadata types.TournamentMetadata) error {
+	if err := ValidateID(metadata.ID); err != nil {
+		return err
+	}
+
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	tm.Metadata.Limit = limit
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while updating the redis metadata: %s", err)
+	if tm.tournaments == nil {
+		tm.tournaments = make(map[string]*Tournament)
+	}
+	if _, exists := tm.tournaments[metadata.ID]; exists {
+		return fmt.Errorf("tournament %s already exists", metadata.ID)
+	}
+
+	metadata.Exists = true
+	if metadata.CreatedAt.IsZero() {
+		metadata.CreatedAt = time.Now().UTC()
+	}
+
+	// the id is claimed in the store first, so another replica cannot open the same tournament
+	added, err := tm.store.AddTournamentID(ctx, metadata.ID)
+	if err != nil {
+		fmt.Printf("error happened while saving tournament id to redis: %s", err)
 		return err
 	}
+	if !added {
+		return fmt.Errorf("tournament %s already exists", metadata.ID)
+	}
+
+	t := &Tournament{Metadata: metadata, List: []types.Player{}, Departed: []types.Player{}}
+	if err := tm.persist(ctx, t); err != nil {
+		if err := tm.store.DeleteTournament(ctx, metadata.ID); err != nil {
+			fmt.Printf("error happened while releasing the tournament id: %s", err)
+		}
+		return err
+	}
+	tm.tournaments[metadata.ID] = t
 	return nil
 }
 
-func (tm *TournamentManager) SetLichessRatingLimit(ctx context.Context, ratingLimit int) error {
+func (tm *TournamentManager) RemoveTournament(ctx context.Context, tournamentID string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	tm.Metadata.LichessRatingLimit = ratingLimit
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while updating the redis metadata: %s", err)
+	if _, err := tm.get(tournamentID); err != nil {
 		return err
 	}
+	if err := tm.store.DeleteTournament(ctx, tournamentID); err != nil {
+		fmt.Printf("error happened while removing the tournament from redis: %s", err)
+		return err
+	}
+	delete(tm.tournaments, tournamentID)
 	return nil
 }
 
-func (tm *TournamentManager) SetChesscomRatingLimit(ctx context.Context, ratingLimit int) error {
+// SetPlayerName renames a listed player, leaving the rest of the entry as stored
+func (tm *TournamentManager) SetPlayerName(ctx context.Context, tournamentID string, playerID int, name string) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	tm.Metadata.ChesscomRatingLimit = ratingLimit
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
-		fmt.Printf("error happened while updating the redis metadata: %s", err)
-		return err
+
+	return tm.updateList(ctx, tournamentID, func(list []types.Player) ([]types.Player, error) {
+		i := indexOf(list, playerID)
+		if i < 0 {
+			return nil, fmt.Errorf("player with ID %d not found in list", playerID)
+		}
+		list[i].SavedName = name
+		return list, nil
+	})
+}
+
+// RemovePlayer moves the player from the list to the departed ones in one store transaction,
+// so a checked-out player keeps their checkouts
+func (tm *TournamentManager) RemovePlayer(ctx context.Context, tournamentID string, playerID int) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.updateRoster(ctx, tournamentID, func(list, departed []types.Player) ([]types.Player, []types.Player, error) {
+		i := indexOf(list, playerID)
+		if i < 0 {
+			return nil, nil, fmt.Errorf("player with ID %d not found in list", playerID)
+		}
+		removed := list[i]
+		if removed.State != types.StateCheckedOut {
+			removed.State = types.StateRemoved
+			removed.CheckedOutTime = time.Now().UTC()
+		}
+		return append(list[:i], list[i+1:]...), append(departed, removed), nil
+	})
+}
+
+// ConfirmPendingPlayer gives a pending player their spot for good.
+// returns false if the player is not pending anymore
+func (tm *TournamentManager) ConfirmPendingPlayer(ctx context.Context, tournamentID string, playerID int) (bool, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	confirmed := false
+	err := tm.updateList(ctx, tournamentID, func(list []types.Player) ([]types.Player, error) {
+		confirmed = false
+		i := indexOf(list, playerID)
+		if i < 0 || list[i].State != types.StatePending {
+			return list, nil
+		}
+		list[i].State = types.StateInTournament
+		list[i].ConfirmBy = time.Time{}
+		confirmed = true
+		return list, nil
+	})
+	return confirmed, err
+}
+
+// DropPendingPlayer checks out a pending player who declined or missed the deadline.
+// deadline must match the player's ConfirmBy so a stale timer cannot drop a newer promotion.
+// returns false if there was nothing to drop
+func (tm *TournamentManager) DropPendingPlayer(ctx context.Context, tournamentID string, playerID int, deadline time.Time) (bool, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	dropped := false
+	err := tm.updateList(ctx, tournamentID, func(list []types.Player) ([]types.Player, error) {
+		dropped = false
+		i := indexOf(list, playerID)
+		if i < 0 || list[i].State != types.StatePending {
+			return list, nil
+		}
+		if !deadline.IsZero() && !list[i].ConfirmBy.Equal(deadline) {
+			return list, nil
+		}
+		list[i].State = types.StateCheckedOut
+		list[i].CheckedOutTime = time.Now().UTC()
+		list[i].ConfirmBy = time.Time{}
+		dropped = true
+		return list, nil
+	})
+	return dropped, err
+}
+
+func (tm *TournamentManager) GetTournamentJSON() (string, error) {
+	data := struct {
+		Tournaments []Tournament `json:"tournaments"`
+	}{
+		Tournaments: tm.Open(),
 	}
-	return nil
+
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal tournament state: %w", err)
+	}
+
+	return string(jsonData), nil
 }
 
-func (tm *TournamentManager) SetAnnouncementMessageID(ctx context.Context, messageID int) error {
+// updateMetadata applies fn to the tournament metadata and persists it
+func (tm *TournamentManager) updateMetadata(ctx context.Context, tournamentID string, fn func(*types.TournamentMetadata)) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
-	tm.Metadata.AnnouncementMessageID = messageID
-	if err := redis.SetMetadata(ctx, tm.Metadata); err != nil {
+	t, err := tm.get(tournamentID)
+	if err != nil {
+		return err
+	}
+	fn(&t.Metadata)
+	if err := tm.store.SetMetadata(ctx, tournamentID, t.Metadata); err != nil {
 		fmt.Printf("error happened while updating the redis metadata: %s", err)
 		return err
 	}
 	return nil
 }
+
+func (tm *TournamentManager) SetConfirmationMinutes(ctx context.Context, tournamentID string, minutes int) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.ConfirmationMinutes = minutes
+	})
+}
+
+func (tm *TournamentManager) SetPeakPolicy(ctx context.Context, tournamentID string, policy ratings.Policy) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.PeakPolicy = policy
+	})
+}
+
+func (tm *TournamentManager) SetRejoinPolicy(ctx context.Context, tournamentID string, policy rejoin.Policy) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.RejoinPolicy = policy
+	})
+}
+
+func (tm *TournamentManager) SetRequireVerified(ctx context.Context, tournamentID string, required bool) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.RequireVerified = required
+	})
+}
+
+func (tm *TournamentManager) SetLimit(ctx context.Context, tournamentID string, limit int) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.Limit = limit
+	})
+}
+
+func (tm *TournamentManager) SetLichessRatingLimit(ctx context.Context, tournamentID string, ratingLimit int) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.LichessRatingLimit = ratingLimit
+	})
+}
+
+func (tm *TournamentManager) SetChesscomRatingLimit(ctx context.Context, tournamentID string, ratingLimit int) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.ChesscomRatingLimit = ratingLimit
+	})
+}
+
+func (tm *TournamentManager) SetAnnouncementMessageID(ctx context.Context, tournamentID string, messageID int) error {
+	return tm.updateMetadata(ctx, tournamentID, func(m *types.TournamentMetadata) {
+		m.AnnouncementMessageID = messageID
+	})
+}
@@ -0,0 +1,313 @@
+package tournament
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/rejoin"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+func TestManagerRestoresFromStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	tm := NewManager(store)
+	if err := tm.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz", Limit: 1}); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+	now := time.Now().UTC()
+	for id := 1; id <= 2; id++ {
+		if _, _, err := tm.CheckIn(ctx, "blitz", types.Player{ID: id, SavedName: "player", TimeAdded: now}); err != nil {
+			t.Fatalf("failed to check in: %v", err)
+		}
+	}
+	if err := tm.RemovePlayer(ctx, "blitz", 1); err != nil {
+		t.Fatalf("failed to remove player: %v", err)
+	}
+	promoted, err := tm.Promote(ctx, "blitz")
+	if err != nil || promoted == nil || promoted.ID != 2 {
+		t.Fatalf("promoted %+v, %v; want player 2", promoted, err)
+	}
+
+	restored := NewManager(store)
+	if err := restored.Init(); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+	got, exists := restored.Get("blitz")
+	if !exists {
+		t.Fatal("tournament was not restored")
+	}
+	if !got.Metadata.Exists || got.Metadata.Limit != 1 {
+		t.Errorf("metadata not restored: %+v", got.Metadata)
+	}
+	if len(got.List) != 1 || got.List[0].ID != 2 || got.List[0].State != types.StateInTournament {
+		t.Errorf("list not restored: %+v", got.List)
+	}
+	if len(got.Departed) != 1 || got.Departed[0].State != types.StateRemoved {
+		t.Errorf("departed not restored: %+v", got.Departed)
+	}
+
+	if err := restored.RemoveTournament(ctx, "blitz"); err != nil {
+		t.Fatalf("failed to remove tournament: %v", err)
+	}
+	if ids, _ := store.GetTournamentIDs(ctx); len(ids) != 0 {
+		t.Errorf("store still lists %v", ids)
+	}
+}
+
+func TestReplicasShareTheStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	first, second := NewManager(store), NewManager(store)
+
+	if err := first.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz"}); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+	if err := second.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz"}); err == nil {
+		t.Fatal("the second replica opened the same tournament again")
+	}
+	if err := second.Init(); err != nil {
+		t.Fatalf("failed to restore: %v", err)
+	}
+
+	for id := 1; id <= 2; id++ {
+		if _, _, err := first.CheckIn(ctx, "blitz", types.Player{ID: id}); err != nil {
+			t.Fatalf("failed to check in: %v", err)
+		}
+	}
+	// each replica removes one player, neither overwrites the departure of the other
+	if err := first.RemovePlayer(ctx, "blitz", 1); err != nil {
+		t.Fatalf("failed to remove player: %v", err)
+	}
+	if err := second.RemovePlayer(ctx, "blitz", 2); err != nil {
+		t.Fatalf("failed to remove player: %v", err)
+	}
+	departed, _ := store.GetDeparted(ctx, "blitz")
+	if len(departed) != 2 {
+		t.Errorf("departed %+v, want both players", departed)
+	}
+}
+
+func TestConcurrentCheckInsRespectTheLimit(t *testing.T) {
+	ctx := context.Background()
+	tm := NewManager(NewMemoryStore())
+	if err := tm.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz", Limit: 3}); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+
+	// every player taps twice
+	var wg sync.WaitGroup
+	for id := 1; id <= 10; id++ {
+		for tap := 0; tap < 2; tap++ {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				if _, _, err := tm.CheckIn(ctx, "blitz", types.Player{ID: id}); err != nil {
+					t.Errorf("check in of %d failed: %v", id, err)
+				}
+			}(id)
+		}
+	}
+	wg.Wait()
+
+	got, _ := tm.Get("blitz")
+	states := map[string]int{}
+	for _, player := range got.List {
+		states[player.State]++
+	}
+	if len(got.List) != 10 || states[types.StateInTournament] != 3 || states[types.StateQueued] != 7 {
+		t.Fatalf("got %d players with states %v, want 3 in the tournament and 7 queued", len(got.List), states)
+	}
+}
+
+func TestCheckOutHandsTheSpotToTheQueue(t *testing.T) {
+	ctx := context.Background()
+	tm := NewManager(NewMemoryStore())
+	if err := tm.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz", Limit: 1, ConfirmationMinutes: 5}); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+	for id := 1; id <= 2; id++ {
+		if _, _, err := tm.CheckIn(ctx, "blitz", types.Player{ID: id}); err != nil {
+			t.Fatalf("failed to check in: %v", err)
+		}
+	}
+
+	result, err := tm.CheckOut(ctx, "blitz", 1)
+	if err != nil {
+		t.Fatalf("failed to check out: %v", err)
+	}
+	if result.Player.State != types.StateInTournament {
+		t.Errorf("checked out player was %s, want %s", result.Player.State, types.StateInTournament)
+	}
+	if result.Promoted == nil || result.Promoted.ID != 2 || result.Promoted.State != types.StatePending || result.Promoted.ConfirmBy.IsZero() {
+		t.Errorf("unexpected promotion: %+v", result.Promoted)
+	}
+
+	if _, err := tm.CheckOut(ctx, "blitz", 1); !errors.Is(err, ErrAlreadyCheckedOut) {
+		t.Errorf("second check out returned %v, want ErrAlreadyCheckedOut", err)
+	}
+	if outcome, _, _ := tm.CheckIn(ctx, "blitz", types.Player{ID: 1}); outcome != AlreadyLeft {
+		t.Errorf("check in after leaving returned %v, want AlreadyLeft", outcome)
+	}
+}
+
+func TestRejoinPolicy(t *testing.T) {
+	ctx := context.Background()
+	noCooldown := 0
+	tests := []struct {
+		name    string
+		policy  rejoin.Policy
+		outcome CheckInOutcome
+		// index is where player 1 ends up in the list
+		index int
+	}{
+		{"back of the list", rejoin.Policy{CooldownMinutes: &noCooldown}, Queued, 2},
+		{"keeps the place", rejoin.Policy{CooldownMinutes: &noCooldown, KeepPlace: true}, Queued, 0},
+		{"forbidden", rejoin.Policy{Forbidden: true}, RejoinForbidden, 0},
+		{"last checkout is final", rejoin.Policy{CooldownMinutes: &noCooldown, MaxCheckouts: 1}, RejoinForbidden, 0},
+		{"cooldown", rejoin.Policy{}, AlreadyLeft, 0},
+	}
+	for _, tt := range tests {
+		tm := NewManager(NewMemoryStore())
+		if err := tm.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz", Limit: 1, RejoinPolicy: tt.policy}); err != nil {
+			t.Fatalf("failed to create tournament: %v", err)
+		}
+		for id := 1; id <= 3; id++ {
+			if _, _, err := tm.CheckIn(ctx, "blitz", types.Player{ID: id}); err != nil {
+				t.Fatalf("failed to check in: %v", err)
+			}
+		}
+		if _, err := tm.CheckOut(ctx, "blitz", 1); err != nil {
+			t.Fatalf("failed to check out: %v", err)
+		}
+
+		outcome, listed, err := tm.CheckIn(ctx, "blitz", types.Player{ID: 1})
+		if err != nil {
+			t.Fatalf("%s: failed to check in again: %v", tt.name, err)
+		}
+		got, _ := tm.Get("blitz")
+		if outcome != tt.outcome || got.List[tt.index].ID != 1 {
+			t.Errorf("%s: got %v with list %+v, want %v and player 1 at %d", tt.name, outcome, got.List, tt.outcome, tt.index)
+		}
+		if listed.Checkouts != 1 {
+			t.Errorf("%s: checkouts %d, want 1", tt.name, listed.Checkouts)
+		}
+	}
+}
+
+func TestRejoinPolicyAfterCleanup(t *testing.T) {
+	ctx := context.Background()
+	noCooldown := 0
+	tm := NewManager(NewMemoryStore())
+	policy := rejoin.Policy{CooldownMinutes: &noCooldown, MaxCheckouts: 2}
+	if err := tm.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz", RejoinPolicy: policy}); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+
+	// checks in and out twice, the checked-out entry is cleaned up every time
+	for round := 1; round <= 2; round++ {
+		outcome, _, err := tm.CheckIn(ctx, "blitz", types.Player{ID: 1})
+		if err != nil || outcome != CheckedIn {
+			t.Fatalf("check-in %d: got %v, %v", round, outcome, err)
+		}
+		if _, err := tm.CheckOut(ctx, "blitz", 1); err != nil {
+			t.Fatalf("failed to check out: %v", err)
+		}
+		if err := tm.RemovePlayer(ctx, "blitz", 1); err != nil {
+			t.Fatalf("failed to remove player: %v", err)
+		}
+	}
+
+	outcome, listed, err := tm.CheckIn(ctx, "blitz", types.Player{ID: 1})
+	if err != nil {
+		t.Fatalf("failed to check in again: %v", err)
+	}
+	if outcome != RejoinForbidden || listed.Checkouts != 2 {
+		t.Errorf("got %v with %d checkouts, want the rejoin forbidden after 2", outcome, listed.Checkouts)
+	}
+}
+
+// legacyStore holds a tournament under the old single-tournament keys
+type legacyStore struct {
+	*MemoryStore
+	list     []types.Player
+	metadata types.TournamentMetadata
+}
+
+func (s *legacyStore) GetLegacyTournament(_ context.Context) ([]types.Player, types.TournamentMetadata, error) {
+	return s.list, s.metadata, nil
+}
+
+func (s *legacyStore) DeleteLegacyTournament(_ context.Context) error {
+	s.list, s.metadata = nil, types.TournamentMetadata{}
+	return nil
+}
+
+func TestLegacyTournamentTakesTheKeyOfItsEvent(t *testing.T) {
+	store := &legacyStore{
+		MemoryStore: NewMemoryStore(),
+		list:        []types.Player{{ID: 1, State: types.StateInTournament}},
+		metadata: types.TournamentMetadata{
+			Exists:            true,
+			Limit:             24,
+			AnnouncementIntro: "открыта запись на зелёный турнир. нажмите /checkin чтобы записаться",
+		},
+	}
+
+	tm := NewManager(store)
+	if err := tm.Init(); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	got, exists := tm.Get("green")
+	if !exists || len(got.List) != 1 || got.Metadata.Name != "зелёный" {
+		t.Fatalf("legacy tournament was not migrated as green: %+v", tm.Open())
+	}
+	if store.metadata.Exists {
+		t.Error("legacy keys were not dropped")
+	}
+}
+
+// roundsDownStore fails to write rounds once down is set
+type roundsDownStore struct {
+	*MemoryStore
+	down bool
+}
+
+func (s *roundsDownStore) SetRounds(ctx context.Context, tournamentID string, rounds []types.Round) error {
+	if s.down {
+		return errors.New("store is down")
+	}
+	return s.MemoryStore.SetRounds(ctx, tournamentID, rounds)
+}
+
+func TestFailedResultKeepsTheGame(t *testing.T) {
+	ctx := context.Background()
+	store := &roundsDownStore{MemoryStore: NewMemoryStore()}
+
+	tm := NewManager(store)
+	if err := tm.CreateTournament(ctx, types.TournamentMetadata{ID: "blitz", Limit: 2}); err != nil {
+		t.Fatalf("failed to create tournament: %v", err)
+	}
+	for id := 1; id <= 2; id++ {
+		if _, _, err := tm.CheckIn(ctx, "blitz", types.Player{ID: id, SavedName: "player", TimeAdded: time.Now().UTC()}); err != nil {
+			t.Fatalf("failed to check in: %v", err)
+		}
+	}
+	if _, err := tm.PairNextRound(ctx, "blitz", ""); err != nil {
+		t.Fatalf("failed to pair: %v", err)
+	}
+
+	store.down = true
+	if _, err := tm.OverrideResult(ctx, "blitz", 1, 1, pairing.WhiteWins); err == nil {
+		t.Fatal("override succeeded with the store down")
+	}
+	got, _ := tm.Get("blitz")
+	if game := got.Rounds[0].Games[0]; game.Result != pairing.NoResult {
+		t.Errorf("game changed without being stored: %+v", game)
+	}
+}
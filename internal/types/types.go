@@ -2,38 +2,88 @@ package types
 
 import (
 	"time"
+
+	"github.com/sukalov/mshkbot/internal/pairing"
+	"github.com/sukalov/mshkbot/internal/ratings"
+	"github.com/sukalov/mshkbot/internal/rejoin"
 )
 
+// PeakRating is a snapshot of one linked account taken at check-in
 type PeakRating struct {
-	Site         string `json:"site"`
-	BlitzPeak    int    `json:"blitz_peak"`
-	SiteUsername string `json:"site_username"`
+	Site         string        `json:"site"`
+	BlitzPeak    int           `json:"blitz_peak"`
+	SiteUsername string        `json:"site_username"`
+	Peaks        ratings.Peaks `json:"peaks,omitempty"`
 }
 
 type Player struct {
-	ID             int         `json:"id"`
-	Username       string      `json:"username"`
-	SavedName      string      `json:"saved_name"`
-	TimeAdded      time.Time   `json:"time_added"`
-	State          string      `json:"state"`
-	CheckedOutTime time.Time   `json:"checked_out_time,omitempty"`
-	PeakRating     *PeakRating `json:"peak_rating,omitempty"`
+	ID             int          `json:"id"`
+	Username       string       `json:"username"`
+	SavedName      string       `json:"saved_name"`
+	TimeAdded      time.Time    `json:"time_added"`
+	State          string       `json:"state"`
+	CheckedOutTime time.Time    `json:"checked_out_time,omitempty"`
+	PeakRating     *PeakRating  `json:"peak_rating,omitempty"`
+	PeakRatings    []PeakRating `json:"peak_ratings,omitempty"`
+	ConfirmBy      time.Time    `json:"confirm_by,omitempty"`
+	Checkouts      int          `json:"checkouts,omitempty"`
+}
+
+// AllPeakRatings returns the snapshots of every linked account.
+// players checked in by older versions only have the single PeakRating
+func (p Player) AllPeakRatings() []PeakRating {
+	if len(p.PeakRatings) > 0 {
+		return p.PeakRatings
+	}
+	if p.PeakRating != nil {
+		return []PeakRating{*p.PeakRating}
+	}
+	return nil
+}
+
+// BlitzPeak is the best blitz peak over all linked accounts
+func (p Player) BlitzPeak() int {
+	best := 0
+	for _, peak := range p.AllPeakRatings() {
+		best = max(best, peak.BlitzPeak)
+	}
+	return best
 }
 
 const (
 	StateInTournament = "in_tournament"
 	StateQueued       = "queued"
+	StatePending      = "pending"
 	StateCheckedOut   = "checked_out"
+	StateRemoved      = "removed"
 )
 
 const SiteLichess = "lichess"
 const SiteChesscom = "chesscom"
 
 type TournamentMetadata struct {
-	Limit                 int    `json:"limit"`
-	LichessRatingLimit    int    `json:"lichess_rating_limit"`
-	ChesscomRatingLimit   int    `json:"chesscom_rating_limit"`
-	AnnouncementMessageID int    `json:"announcement_message_id"`
-	AnnouncementIntro     string `json:"announcement_intro"`
-	Exists                bool   `json:"exists"`
+	ID                    string         `json:"id"`
+	Name                  string         `json:"name"`
+	Limit                 int            `json:"limit"`
+	LichessRatingLimit    int            `json:"lichess_rating_limit"`
+	ChesscomRatingLimit   int            `json:"chesscom_rating_limit"`
+	ClubRatingLimit       int            `json:"club_rating_limit,omitempty"`
+	AnnouncementMessageID int            `json:"announcement_message_id"`
+	AnnouncementIntro     string         `json:"announcement_intro"`
+	Exists                bool           `json:"exists"`
+	CreatedAt             time.Time      `json:"created_at"`
+	StartsAt              time.Time      `json:"starts_at,omitempty"`
+	ConfirmationMinutes   int            `json:"confirmation_minutes,omitempty"`
+	PairingSystem         string         `json:"pairing_system,omitempty"`
+	Seeds                 []int          `json:"seeds,omitempty"`
+	StandingsMessageID    int            `json:"standings_message_id,omitempty"`
+	PeakPolicy            ratings.Policy `json:"peak_policy"`
+	RequireVerified       bool           `json:"require_verified,omitempty"`
+	RejoinPolicy          rejoin.Policy  `json:"rejoin_policy"`
+}
+
+// Round is a paired round of a tournament and the main group message announcing it
+type Round struct {
+	pairing.Round
+	MessageID int `json:"message_id,omitempty"`
 }
@@ -1,14 +1,13 @@
 package utils
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/sukalov/mshkbot/internal/ratings"
 )
 
 type TopRatings struct {
@@ -40,105 +39,25 @@ func ConvertToMoscowTime(t time.Time) string {
 	return t.In(moscowLocation).Format("15:04:05")
 }
 
+// GetLichessAllTimeHigh fetches peaks without caching.
+// Deprecated: handlers use the cached providers on the bot
 func GetLichessAllTimeHigh(username string) (TopRatings, error) {
-	url := fmt.Sprintf("https://lichess.org/api/user/%s/rating-history", username)
-	resp, err := http.Get(url)
-	if err != nil {
-		return TopRatings{}, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return TopRatings{}, fmt.Errorf("failed to fetch lichess data: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return TopRatings{}, err
-	}
-
-	var ratingHistory []struct {
-		Name   string  `json:"name"`
-		Points [][]int `json:"points"`
-	}
-
-	if err := json.Unmarshal(body, &ratingHistory); err != nil {
-		return TopRatings{}, err
-	}
-
-	var topRatings TopRatings
-
-	for _, gameType := range ratingHistory {
-		var maxRating int
-		for i, point := range gameType.Points {
-			if i < 5 {
-				continue
-			}
-			if len(point) >= 4 {
-				rating := point[3]
-				if rating > maxRating {
-					maxRating = rating
-				}
-			}
-		}
-
-		switch gameType.Name {
-		case "Blitz":
-			topRatings.Blitz = maxRating
-		case "Rapid":
-			topRatings.Rapid = maxRating
-		case "Classical":
-			topRatings.Classical = maxRating
-		}
-	}
-
-	return topRatings, nil
+	history, err := ratings.NewLichess(ratings.LichessURL, nil).History(context.Background(), username)
+	return topRatings(history), err
 }
 
+// GetChessComAllTimeHigh fetches peaks without caching.
+// Deprecated: handlers use the cached providers on the bot
 func GetChessComAllTimeHigh(username string) (TopRatings, error) {
-	url := fmt.Sprintf("https://api.chess.com/pub/player/%s/stats", username)
-	resp, err := http.Get(url)
-	if err != nil {
-		return TopRatings{}, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return TopRatings{}, fmt.Errorf("failed to fetch chess.com data: %s", resp.Status)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return TopRatings{}, err
-	}
-
-	var stats struct {
-		ChessRapid struct {
-			Best struct {
-				Rating int `json:"rating"`
-			} `json:"best"`
-		} `json:"chess_rapid"`
-		ChessBlitz struct {
-			Best struct {
-				Rating int `json:"rating"`
-			} `json:"best"`
-		} `json:"chess_blitz"`
-		ChessClassical struct {
-			Best struct {
-				Rating int `json:"rating"`
-			} `json:"best"`
-		} `json:"chess_daily"`
-	}
-
-	if err := json.Unmarshal(body, &stats); err != nil {
-		return TopRatings{}, err
-	}
+	history, err := ratings.NewChessCom(ratings.ChessComURL, nil).History(context.Background(), username)
+	return topRatings(history), err
+}
 
-	topRatings := TopRatings{
-		Blitz:     stats.ChessBlitz.Best.Rating,
-		Rapid:     stats.ChessRapid.Best.Rating,
-		Classical: stats.ChessClassical.Best.Rating,
+func topRatings(history ratings.History) TopRatings {
+	peaks := ratings.Policy{}.Peaks(history, time.Now())
+	return TopRatings{
+		Blitz:     peaks[ratings.Blitz].Rating,
+		Rapid:     peaks[ratings.Rapid].Rating,
+		Classical: peaks[ratings.Classical].Rating,
 	}
-
-	return topRatings, nil
 }
@@ -0,0 +1,263 @@
+package waitlist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/sukalov/mshkbot/internal/bot"
+	"github.com/sukalov/mshkbot/internal/jobs"
+	"github.com/sukalov/mshkbot/internal/types"
+)
+
+const (
+	// cleanupDelay is how long a checked-out player stays in the list before they are removed
+	cleanupDelay = 15 * time.Minute
+	// minReminderWindow is the shortest confirmation window that gets a reminder halfway through
+	minReminderWindow = 10 * time.Minute
+)
+
+// Promote hands a freed spot to the first player in the queue, see Offer
+func Promote(b *bot.Bot, tournamentID string) {
+	promoted, err := b.Tournament.Promote(context.Background(), tournamentID)
+	if err != nil {
+		log.Printf("failed to promote queued player: %v", err)
+		return
+	}
+	if promoted != nil {
+		Offer(b, tournamentID, *promoted)
+	}
+}
+
+// Offer tells a player who moved up from the queue about their spot.
+// in tournaments with a confirmation window the player is asked to confirm in private
+// and the spot moves on if they don't answer in time
+func Offer(b *bot.Bot, tournamentID string, promoted types.Player) {
+	log.Printf("promoted player %d (%s) from queue to tournament %s as %s", promoted.ID, promoted.Username, tournamentID, promoted.State)
+
+	if promoted.State != types.StatePending {
+		b.NotifyPromoted(tournamentID, promoted)
+		return
+	}
+
+	if err := askConfirmation(b, tournamentID, promoted); err != nil {
+		// nobody can press the buttons, so the player keeps the spot and gets the usual fallback
+		log.Printf("failed to ask player %d for confirmation, confirming right away: %v", promoted.ID, err)
+		if _, err := b.Tournament.ConfirmPendingPlayer(context.Background(), tournamentID, promoted.ID); err != nil {
+			log.Printf("failed to confirm player %d: %v", promoted.ID, err)
+		}
+		b.NotifyPromoted(tournamentID, promoted)
+		return
+	}
+
+	scheduleDeadline(b, tournamentID, promoted)
+}
+
+// Confirm keeps the spot of a pending player. returns false if the offer is no longer valid
+func Confirm(b *bot.Bot, tournamentID string, playerID int) (bool, error) {
+	confirmed, err := b.Tournament.ConfirmPendingPlayer(context.Background(), tournamentID, playerID)
+	if err != nil || !confirmed {
+		return false, err
+	}
+	log.Printf("player %d confirmed their spot in tournament %s", playerID, tournamentID)
+	cancelDeadline(b, tournamentID, playerID)
+
+	if err := b.UpdateAnnouncementMessage(tournamentID); err != nil {
+		log.Printf("failed to update announcement message: %v", err)
+	}
+	return true, nil
+}
+
+// Decline gives the spot of a pending player to the next one in the queue.
+// returns false if the offer is no longer valid
+func Decline(b *bot.Bot, tournamentID string, playerID int) (bool, error) {
+	dropped, err := drop(context.Background(), b, tournamentID, playerID, time.Time{})
+	if dropped {
+		cancelDeadline(b, tournamentID, playerID)
+	}
+	return dropped, err
+}
+
+// ScheduleCleanup removes the player from the list a while after they checked out
+func ScheduleCleanup(b *bot.Bot, tournamentID string, playerID int, checkedOutAt time.Time) {
+	job := jobs.Job{
+		ID:           jobs.ID(jobs.KindCleanup, tournamentID, int64(playerID)),
+		Kind:         jobs.KindCleanup,
+		RunAt:        checkedOutAt.Add(cleanupDelay),
+		TournamentID: tournamentID,
+		PlayerID:     int64(playerID),
+	}
+	if err := b.Jobs.Schedule(job); err != nil {
+		log.Printf("failed to schedule cleanup of player %d: %v", playerID, err)
+	}
+}
+
+// Resume registers the waitlist jobs and schedules them for players who were promoted
+// or checked out before the job queue existed; jobs that are already pending are replaced by the same ones
+func Resume(b *bot.Bot) {
+	b.Jobs.Handle(jobs.KindCleanup, func(ctx context.Context, job jobs.Job) error {
+		return cleanup(ctx, b, job.TournamentID, int(job.PlayerID))
+	})
+	b.Jobs.Handle(jobs.KindPromotionDeadline, func(ctx context.Context, job jobs.Job) error {
+		return expire(ctx, b, job.TournamentID, int(job.PlayerID), job.Deadline)
+	})
+	b.Jobs.Handle(jobs.KindPromotionReminder, func(ctx context.Context, job jobs.Job) error {
+		return remind(b, job.TournamentID, int(job.PlayerID), job.Deadline)
+	})
+
+	for _, t := range b.Tournament.Open() {
+		for _, player := range t.List {
+			switch player.State {
+			case types.StatePending:
+				scheduleDeadline(b, t.Metadata.ID, player)
+			case types.StateCheckedOut:
+				ScheduleCleanup(b, t.Metadata.ID, player.ID, player.CheckedOutTime)
+			}
+		}
+	}
+}
+
+func askConfirmation(b *bot.Bot, tournamentID string, player types.Player) error {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return fmt.Errorf("tournament %s not found", tournamentID)
+	}
+
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+	text := fmt.Sprintf("освободилось место в турнире «%s». подтвердите участие до %s, иначе место перейдёт следующему в очереди",
+		t.DisplayName(), player.ConfirmBy.In(moscowTZ).Format("15:04"))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("подтверждаю", "promotion_confirm:"+tournamentID),
+		tgbotapi.NewInlineKeyboardButtonData("не смогу", "promotion_decline:"+tournamentID),
+	))
+
+	msg := tgbotapi.NewMessage(int64(player.ID), text)
+	msg.ReplyMarkup = keyboard
+	_, err := b.Send(msg)
+	return err
+}
+
+// scheduleDeadline schedules the end of the confirmation window of a pending player
+// and, if the window is long enough, a reminder halfway through
+func scheduleDeadline(b *bot.Bot, tournamentID string, player types.Player) {
+	job := jobs.Job{
+		ID:           jobs.ID(jobs.KindPromotionDeadline, tournamentID, int64(player.ID)),
+		Kind:         jobs.KindPromotionDeadline,
+		RunAt:        player.ConfirmBy,
+		TournamentID: tournamentID,
+		PlayerID:     int64(player.ID),
+		Deadline:     player.ConfirmBy,
+	}
+	if err := b.Jobs.Schedule(job); err != nil {
+		log.Printf("failed to schedule confirmation deadline of player %d: %v", player.ID, err)
+	}
+
+	window := time.Duration(0)
+	if t, exists := b.Tournament.Get(tournamentID); exists {
+		window = time.Duration(t.Metadata.ConfirmationMinutes) * time.Minute
+	}
+	if window < minReminderWindow {
+		return
+	}
+	job.ID = jobs.ID(jobs.KindPromotionReminder, tournamentID, int64(player.ID))
+	job.Kind = jobs.KindPromotionReminder
+	job.RunAt = player.ConfirmBy.Add(-window / 2)
+	if err := b.Jobs.Schedule(job); err != nil {
+		log.Printf("failed to schedule confirmation reminder of player %d: %v", player.ID, err)
+	}
+}
+
+// cancelDeadline drops the deadline and the reminder of a player who answered
+func cancelDeadline(b *bot.Bot, tournamentID string, playerID int) {
+	for _, kind := range []jobs.Kind{jobs.KindPromotionDeadline, jobs.KindPromotionReminder} {
+		if err := b.Jobs.Cancel(jobs.ID(kind, tournamentID, int64(playerID))); err != nil {
+			log.Printf("failed to cancel %s of player %d: %v", kind, playerID, err)
+		}
+	}
+}
+
+func expire(ctx context.Context, b *bot.Bot, tournamentID string, playerID int, deadline time.Time) error {
+	dropped, err := drop(ctx, b, tournamentID, playerID, deadline)
+	if err != nil {
+		return fmt.Errorf("failed to expire pending player %d: %w", playerID, err)
+	}
+	if !dropped {
+		return nil
+	}
+
+	log.Printf("pending player %d missed the deadline in tournament %s", playerID, tournamentID)
+	if err := b.SendMessage(int64(playerID), "время на подтверждение вышло, место передано следующему в очереди"); err != nil {
+		log.Printf("failed to tell player %d about the missed deadline: %v", playerID, err)
+	}
+	return nil
+}
+
+// remind asks a player who is still pending with the same deadline to confirm
+func remind(b *bot.Bot, tournamentID string, playerID int, deadline time.Time) error {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return nil
+	}
+	player, listed := t.GetPlayer(playerID)
+	if !listed || player.State != types.StatePending || !player.ConfirmBy.Equal(deadline) {
+		return nil
+	}
+
+	moscowTZ := time.FixedZone("moscow", 3*60*60)
+	text := fmt.Sprintf("напоминаем: подтвердите участие в турнире «%s» до %s, иначе место перейдёт следующему в очереди",
+		t.DisplayName(), deadline.In(moscowTZ).Format("15:04"))
+	if err := b.SendMessage(int64(playerID), text); err != nil {
+		log.Printf("failed to remind player %d to confirm: %v", playerID, err)
+	}
+	return nil
+}
+
+// cleanup removes the player from the list if they are still checked out.
+// the list entry keeps the place of a player who may come back to it, so it stays.
+// a removed player goes to the departed ones, where check-in still finds their checkouts
+func cleanup(ctx context.Context, b *bot.Bot, tournamentID string, playerID int) error {
+	t, exists := b.Tournament.Get(tournamentID)
+	if !exists {
+		return nil
+	}
+	player, listed := t.GetPlayer(playerID)
+	if !listed || player.State != types.StateCheckedOut {
+		return nil
+	}
+	if policy := t.Metadata.RejoinPolicy; policy.KeepPlace && policy.Allows(player.Checkouts) {
+		return nil
+	}
+
+	if err := b.Tournament.RemovePlayer(ctx, tournamentID, playerID); err != nil {
+		return fmt.Errorf("failed to cleanup checked-out player %d: %w", playerID, err)
+	}
+	log.Printf("cleaned up checked-out player %d from tournament %s", playerID, tournamentID)
+	return nil
+}
+
+// drop checks out a pending player, gives their spot to the queue and schedules their cleanup
+func drop(ctx context.Context, b *bot.Bot, tournamentID string, playerID int, deadline time.Time) (bool, error) {
+	if _, exists := b.Tournament.Get(tournamentID); !exists {
+		return false, nil
+	}
+
+	dropped, err := b.Tournament.DropPendingPlayer(ctx, tournamentID, playerID, deadline)
+	if err != nil || !dropped {
+		return false, err
+	}
+
+	if err := b.Users.DecrementTimesPlayed(int64(playerID)); err != nil {
+		log.Printf("failed to decrement times played for user %d: %v", playerID, err)
+	}
+	ScheduleCleanup(b, tournamentID, playerID, time.Now().UTC())
+
+	Promote(b, tournamentID)
+
+	if err := b.UpdateAnnouncementMessage(tournamentID); err != nil {
+		log.Printf("failed to update announcement message: %v", err)
+	}
+	return true, nil
+}